@@ -11,10 +11,22 @@ import (
 	_ "time/tzdata"
 
 	"github.com/joho/godotenv"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/authtoken"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/bufferutil"
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/freerooms"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/icalsubscription"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/metrics"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/ratelimit"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/search"
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/server"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/snapshot"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/tracing"
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekmock"
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/webhook"
 )
 
 var cfg config.Config
@@ -24,6 +36,8 @@ var cancelCtx context.CancelFunc
 
 var mockDownloadUrl string
 
+const encryptionBufferPoolBaseBuffSize = 4 * 1024
+
 func main() {
 	os.Exit(run())
 }
@@ -32,14 +46,14 @@ func run() int {
 	godotenv.Overload()
 	cfg = config.FromEnv()
 
-	logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+	logger = slog.New(tracing.NewLogHandler(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
 		Level: func() slog.Level {
 			if cfg.Debug {
 				return slog.LevelDebug
 			}
 			return slog.LevelInfo
 		}(),
-	}))
+	})))
 	slog.SetDefault(logger)
 
 	flag.StringVar(&mockDownloadUrl, "mockdl", "", "url to download mock data from")
@@ -82,13 +96,152 @@ func runServer() int {
 		}
 	}
 
-	uekClient, err := uekschedule.NewClient(uekHttpClient, logger, cfg.UEK)
+	// the store is always needed for the list of revoked tokens
+	store, err := filestore.New(cfg.DataDirectoryPath)
+	if err != nil {
+		logger.Error("Failed to open data directory", slog.Any("err", err))
+		return 1
+	}
+
+	encryptionKey, err := encryption.NewKey(cfg.Server.EncryptionKeyId, cfg.Server.EncryptionKey, cfg.Server.EncryptionKeySalt)
+	if err != nil {
+		logger.Error("Invalid encryption key, check UEKPZ4_SERVER_ENCRYPTION_KEY", slog.Any("err", err))
+		return 1
+	}
+
+	decryptionKeys := make([]encryption.Key, 0, len(cfg.Server.DecryptionKeys))
+	for _, rawDecryptionKey := range cfg.Server.DecryptionKeys {
+		decryptionKey, err := encryption.ParseKey(rawDecryptionKey, cfg.Server.EncryptionKeySalt)
+		if err != nil {
+			logger.Error("Invalid decryption key, check UEKPZ4_SERVER_DECRYPTION_KEYS", slog.Any("err", err))
+			return 1
+		}
+		decryptionKeys = append(decryptionKeys, decryptionKey)
+	}
+
+	encryptionBufferPool := bufferutil.NewBufferPool(encryptionBufferPoolBaseBuffSize)
+	encryptionService, err := encryption.NewService(encryptionKey, decryptionKeys, encryptionBufferPool)
+	if err != nil {
+		logger.Error("Failed to create encryption service", slog.Any("err", err))
+		return 1
+	}
+
+	var uekOfflineStore *filestore.Store
+	if cfg.UEK.OfflineFallback {
+		uekOfflineStore = store
+	}
+
+	metricsRegistry := metrics.NewRegistry()
+
+	uekClient, err := uekschedule.NewClient(uekHttpClient, logger, cfg.UEK, uekOfflineStore, encryptionService, metricsRegistry)
 	if err != nil {
 		logger.Error("Failed to create UEK client", slog.Any("err", err))
 		return 1
 	}
+	go uekClient.RunOfflineStorePruning(ctx)
+
+	tokenService, err := authtoken.NewService(cfg.Tokens, encryptionService, store, logger)
+	if err != nil {
+		logger.Error("Failed to create token service", slog.Any("err", err))
+		return 1
+	}
+	go tokenService.Run(ctx)
+
+	var icalSubscriptionService *icalsubscription.Service
+	if cfg.ICalSubscriptions.Enabled {
+		icalSubscriptionService, err = icalsubscription.NewService(cfg.ICalSubscriptions, encryptionService, tokenService, store, logger)
+		if err != nil {
+			logger.Error("Failed to create iCal subscription service", slog.Any("err", err))
+			return 1
+		}
+	}
+
+	var snapshotService *snapshot.Service
+	if len(cfg.Snapshot.Schedules) > 0 {
+		snapshotService, err = snapshot.NewService(cfg.Snapshot, uekClient, store, logger)
+		if err != nil {
+			logger.Error("Failed to create snapshot service", slog.Any("err", err))
+			return 1
+		}
+		go snapshotService.Run(ctx)
+	}
+
+	var webhookService *webhook.Service
+	if cfg.Webhook.Enabled {
+		webhookNotifier := webhook.NewHTTPNotifier(webhook.NewHTTPClient(cfg.Webhook.RequestTimeout, cfg.Webhook.AllowPrivateTargets), cfg.Webhook.MaxAttempts, cfg.Webhook.RetryDelay, uekClient.Location())
+		webhookService, err = webhook.NewService(cfg.Webhook, uekClient, encryptionService, store, webhookNotifier, logger)
+		if err != nil {
+			logger.Error("Failed to create webhook service", slog.Any("err", err))
+			return 1
+		}
+		go webhookService.Run(ctx)
+	}
+
+	var freeRoomsService *freerooms.Service
+	if cfg.FreeRooms.Enabled {
+		freeRoomsService, err = freerooms.NewService(cfg.FreeRooms, uekClient, logger)
+		if err != nil {
+			logger.Error("Failed to create free rooms service", slog.Any("err", err))
+			return 1
+		}
+		go freeRoomsService.Run(ctx)
+	}
+
+	var searchService *search.Service
+	if cfg.Search.Enabled {
+		searchService, err = search.NewService(cfg.Search, uekClient, logger)
+		if err != nil {
+			logger.Error("Failed to create search service", slog.Any("err", err))
+			return 1
+		}
+		go searchService.Run(ctx)
+	}
+
+	var tracer *tracing.Tracer
+	if cfg.Tracing.Enabled {
+		var spanExporter tracing.Exporter
+		if cfg.Tracing.OTLPEndpoint != "" {
+			otlpExporter, err := tracing.NewOTLPExporter(&http.Client{Timeout: 10 * time.Second}, cfg.Tracing.OTLPEndpoint, cfg.Tracing.ServiceName, cfg.Tracing.OTLPFlushInterval, logger)
+			if err != nil {
+				logger.Error("Failed to create OTLP span exporter", slog.Any("err", err))
+				return 1
+			}
+			go otlpExporter.Run(ctx)
+			spanExporter = otlpExporter
+		}
+		tracer = tracing.NewTracer(logger, cfg.Tracing.LogSpans, spanExporter)
+	}
+
+	var ipRateLimiter, credentialRateLimiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		if ipRateLimiter, err = ratelimit.NewLimiter(cfg.RateLimit.PerIPRate, cfg.RateLimit.PerIPBurst, cfg.RateLimit.MaxTrackedClients); err != nil {
+			logger.Error("Failed to create IP rate limiter", slog.Any("err", err))
+			return 1
+		}
+		if credentialRateLimiter, err = ratelimit.NewLimiter(cfg.RateLimit.PerCredentialRate, cfg.RateLimit.PerCredentialBurst, cfg.RateLimit.MaxTrackedClients); err != nil {
+			logger.Error("Failed to create credential rate limiter", slog.Any("err", err))
+			return 1
+		}
+	}
 
-	srv, err := server.New(cfg.Server, uekClient, logger)
+	srv, err := server.New(cfg.Server, server.Dependencies{
+		UEKSchedule:           uekClient,
+		Tokens:                tokenService,
+		Snapshots:             snapshotService,
+		Webhooks:              webhookService,
+		FreeRooms:             freeRoomsService,
+		Search:                searchService,
+		ICalSubscriptions:     icalSubscriptionService,
+		Store:                 store,
+		Metrics:               metricsRegistry,
+		Tracer:                tracer,
+		IPRateLimiter:         ipRateLimiter,
+		CredentialRateLimiter: credentialRateLimiter,
+		Encryption:            encryptionService,
+		BufferPools: map[string]*bufferutil.BufferPool{
+			"encryption": encryptionBufferPool,
+		},
+	}, logger)
 	if err != nil {
 		logger.Error("Failed to initialize HTTP server", slog.Any("err", err))
 		return 1
@@ -97,10 +250,19 @@ func runServer() int {
 		logger.Info("Server started",
 			slog.Bool("debug", cfg.Debug),
 			slog.String("addr", cfg.Server.Addr),
+			slog.String("metricsAddr", cfg.Server.MetricsAddr),
 			slog.Group("uek",
 				slog.String("userAgent", cfg.UEK.UserAgent),
-				slog.Int("maxConcurrentRequests", cfg.UEK.MaxConcurrentRequests)),
+				slog.Int("maxConcurrentRequests", cfg.UEK.MaxConcurrentRequests),
+				slog.Int("cacheMaxEntries", cfg.UEK.CacheMaxEntries),
+				slog.Bool("offlineFallback", cfg.UEK.OfflineFallback)),
 			slog.Bool("mock", cfg.Mock.Enabled),
+			slog.Int("snapshotSchedules", len(cfg.Snapshot.Schedules)),
+			slog.Bool("webhooks", cfg.Webhook.Enabled),
+			slog.Bool("freeRooms", cfg.FreeRooms.Enabled),
+			slog.Bool("search", cfg.Search.Enabled),
+			slog.Bool("tracing", cfg.Tracing.Enabled),
+			slog.Bool("rateLimit", cfg.RateLimit.Enabled),
 		)
 		if err := srv.Run(); err != nil {
 			logger.Error("Server stopped unexpectedly", slog.Any("err", err))
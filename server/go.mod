@@ -4,7 +4,6 @@ go 1.25.5
 
 require (
 	github.com/go-xmlfmt/xmlfmt v1.1.3
-	github.com/google/uuid v1.6.0
 	github.com/joho/godotenv v1.5.1
 	golang.org/x/sync v0.19.0
 )
@@ -0,0 +1,221 @@
+package authtoken
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+)
+
+const errPrefix = "authtoken: "
+
+const storeKeyPrefix = "revoked-tokens/"
+
+const pruneInterval = time.Hour
+
+const (
+	AudienceAPI  = "api"
+	AudienceICal = "ical"
+)
+
+var ErrInvalidToken = errors.New(errPrefix + "invalid token")
+var ErrTokenExpired = errors.New(errPrefix + "token expired")
+var ErrTokenRevoked = errors.New(errPrefix + "token revoked")
+var ErrWrongAudience = errors.New(errPrefix + "token is not valid for this audience")
+
+// ErrLegacyToken is returned when revoking tokens without claims, they cannot be told apart
+var ErrLegacyToken = errors.New(errPrefix + "token has no id")
+
+// revokedToken is kept until the token would expire anyway
+type revokedToken struct {
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Service issues tokens, which are UEK credentials encrypted together with their claims, and keeps a list of revoked ones
+type Service struct {
+	cfg           config.Tokens
+	encryption    *encryption.Service
+	store         *filestore.Store
+	logger        *slog.Logger
+	mu            sync.RWMutex
+	revokedTokens map[string]time.Time
+}
+
+func NewService(cfg config.Tokens, encryptionService *encryption.Service, store *filestore.Store, logger *slog.Logger) (*Service, error) {
+	if cfg.APITTL <= 0 || cfg.ICalTTL <= 0 {
+		return nil, fmt.Errorf(errPrefix + "token ttl should be greater than 0")
+	}
+
+	s := &Service{
+		cfg:           cfg,
+		encryption:    encryptionService,
+		store:         store,
+		logger:        logger,
+		revokedTokens: map[string]time.Time{},
+	}
+
+	keys, err := store.Keys(storeKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		revoked := revokedToken{}
+		if ok, err := store.Get(key, &revoked); err != nil {
+			return nil, err
+		} else if ok {
+			s.revokedTokens[strings.TrimPrefix(key, storeKeyPrefix)] = revoked.ExpiresAt
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Service) getTTL(audience string) (time.Duration, bool) {
+	switch audience {
+	case AudienceAPI:
+		return s.cfg.APITTL, true
+	case AudienceICal:
+		return s.cfg.ICalTTL, true
+	default:
+		return 0, false
+	}
+}
+
+func (s *Service) Issue(basicAuthValue string, audience string, now time.Time) (string, encryption.TokenClaims, error) {
+	ttl, ok := s.getTTL(audience)
+	if !ok {
+		return "", encryption.TokenClaims{}, ErrWrongAudience
+	}
+
+	idBuff := make([]byte, 16)
+	if _, err := rand.Read(idBuff); err != nil {
+		return "", encryption.TokenClaims{}, fmt.Errorf(errPrefix+"failed to generate token id: %w", err)
+	}
+
+	claims := encryption.TokenClaims{
+		Id:        hex.EncodeToString(idBuff),
+		Audience:  audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+
+	token, err := s.encryption.EncryptToken(basicAuthValue, claims)
+	if err != nil {
+		return "", encryption.TokenClaims{}, err
+	}
+
+	return token, claims, nil
+}
+
+// Verify returns credentials from the token, if it was issued for audience, an empty audience accepts every audience
+func (s *Service) Verify(token string, audience string, now time.Time) (string, encryption.TokenClaims, error) {
+	basicAuthValue, claims, err := s.encryption.DecryptToken(token)
+	if err != nil {
+		return "", encryption.TokenClaims{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if claims.Id == "" {
+		if !s.cfg.AllowLegacy {
+			return "", encryption.TokenClaims{}, ErrTokenExpired
+		}
+
+		return basicAuthValue, claims, nil
+	}
+
+	if audience != "" && claims.Audience != audience {
+		return "", encryption.TokenClaims{}, ErrWrongAudience
+	}
+
+	if now.Unix() >= claims.ExpiresAt {
+		return "", encryption.TokenClaims{}, ErrTokenExpired
+	}
+
+	s.mu.RLock()
+	_, revoked := s.revokedTokens[claims.Id]
+	s.mu.RUnlock()
+	if revoked {
+		return "", encryption.TokenClaims{}, ErrTokenRevoked
+	}
+
+	return basicAuthValue, claims, nil
+}
+
+// Reencrypt moves a token to the active key, keeping its claims, so that it expires at the same time
+func (s *Service) Reencrypt(token string, now time.Time) (string, error) {
+	basicAuthValue, claims, err := s.Verify(token, "", now)
+	if err != nil {
+		return "", err
+	}
+
+	if claims.Id == "" {
+		return s.encryption.ReencryptText(token)
+	}
+
+	return s.encryption.EncryptToken(basicAuthValue, claims)
+}
+
+// Revoke makes a token, and all of its re-encrypted copies, invalid before it expires
+func (s *Service) Revoke(token string, now time.Time) error {
+	_, claims, err := s.Verify(token, "", now)
+	if err != nil {
+		return err
+	}
+
+	if claims.Id == "" {
+		return ErrLegacyToken
+	}
+
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if err := s.store.Put(storeKeyPrefix+claims.Id, revokedToken{ExpiresAt: expiresAt}); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.revokedTokens[claims.Id] = expiresAt
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Run forgets revoked tokens once they expire, until ctx is canceled
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.pruneRevokedTokens(time.Now())
+	}
+}
+
+func (s *Service) pruneRevokedTokens(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, expiresAt := range s.revokedTokens {
+		if now.Before(expiresAt) {
+			continue
+		}
+
+		if err := s.store.Delete(storeKeyPrefix + id); err != nil {
+			s.logger.Error("Failed to delete revoked token", slog.String("tokenId", id), slog.Any("err", err))
+			continue
+		}
+		delete(s.revokedTokens, id)
+	}
+}
@@ -0,0 +1,165 @@
+package authtoken_test
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/authtoken"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/bufferutil"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+)
+
+const testBasicAuthValue = "dXNlcjpwYXNz"
+
+var testConfig = config.Tokens{
+	APITTL:      time.Hour,
+	ICalTTL:     24 * time.Hour,
+	AllowLegacy: true,
+}
+
+func createTestService(cfg config.Tokens, store *filestore.Store) (*authtoken.Service, *encryption.Service, error) {
+	encryptionService, err := encryption.NewService(encryption.Key{Id: "1", Value: []byte("g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI="), OwnerHashValue: []byte("owner-g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI=")}, nil, bufferutil.NewBufferPool(8*1024))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	service, err := authtoken.NewService(cfg, encryptionService, store, slog.New(slog.DiscardHandler))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return service, encryptionService, nil
+}
+
+func TestServiceVerify(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+	service, _, err := createTestService(testConfig, store)
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+
+	now := time.Now()
+	token, _, err := service.Issue(testBasicAuthValue, authtoken.AudienceICal, now)
+	if err != nil {
+		t.Errorf("Failed to issue token: %s", err)
+		return
+	}
+
+	for _, testCase := range []struct {
+		name        string
+		audience    string
+		now         time.Time
+		expectedErr error
+	}{
+		{name: "valid", audience: authtoken.AudienceICal, now: now},
+		{name: "any audience", audience: "", now: now},
+		{name: "wrong audience", audience: authtoken.AudienceAPI, now: now, expectedErr: authtoken.ErrWrongAudience},
+		{name: "expired", audience: authtoken.AudienceICal, now: now.Add(25 * time.Hour), expectedErr: authtoken.ErrTokenExpired},
+	} {
+		basicAuthValue, _, err := service.Verify(token, testCase.audience, testCase.now)
+		if !errors.Is(err, testCase.expectedErr) {
+			t.Errorf("%s: expected error %v, got: %v", testCase.name, testCase.expectedErr, err)
+			continue
+		}
+
+		if err == nil && basicAuthValue != testBasicAuthValue {
+			t.Errorf("%s: expected %s, got: %s", testCase.name, testBasicAuthValue, basicAuthValue)
+		}
+	}
+}
+
+func TestServiceRevoke(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+	service, _, err := createTestService(testConfig, store)
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+
+	now := time.Now()
+	token, _, err := service.Issue(testBasicAuthValue, authtoken.AudienceAPI, now)
+	if err != nil {
+		t.Errorf("Failed to issue token: %s", err)
+		return
+	}
+
+	reencryptedToken, err := service.Reencrypt(token, now)
+	if err != nil {
+		t.Errorf("Failed to re-encrypt token: %s", err)
+		return
+	}
+
+	if err := service.Revoke(token, now); err != nil {
+		t.Errorf("Failed to revoke token: %s", err)
+		return
+	}
+
+	// revocations are persisted, and apply to re-encrypted copies
+	restartedService, _, err := createTestService(testConfig, store)
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+	for _, s := range []*authtoken.Service{service, restartedService} {
+		for _, token := range []string{token, reencryptedToken} {
+			if _, _, err := s.Verify(token, authtoken.AudienceAPI, now); !errors.Is(err, authtoken.ErrTokenRevoked) {
+				t.Errorf("Expected ErrTokenRevoked, got: %v", err)
+				return
+			}
+		}
+	}
+}
+
+func TestServiceLegacyTokens(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+	service, encryptionService, err := createTestService(testConfig, store)
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+
+	legacyToken, err := encryptionService.EncryptText(testBasicAuthValue)
+	if err != nil {
+		t.Errorf("Failed to encrypt text: %s", err)
+		return
+	}
+
+	if basicAuthValue, _, err := service.Verify(legacyToken, authtoken.AudienceICal, time.Now()); err != nil || basicAuthValue != testBasicAuthValue {
+		t.Errorf("Legacy token should be accepted, got: %s %v", basicAuthValue, err)
+		return
+	}
+
+	if err := service.Revoke(legacyToken, time.Now()); !errors.Is(err, authtoken.ErrLegacyToken) {
+		t.Errorf("Expected ErrLegacyToken, got: %v", err)
+		return
+	}
+
+	cfg := testConfig
+	cfg.AllowLegacy = false
+	strictService, _, err := createTestService(cfg, store)
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+	if _, _, err := strictService.Verify(legacyToken, authtoken.AudienceICal, time.Now()); err == nil {
+		t.Error("Legacy token should be rejected when legacy tokens are not allowed")
+		return
+	}
+}
@@ -1,23 +1,37 @@
 package bufferutil
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+)
 
 type BufferPool struct {
-	pool sync.Pool
+	pool        sync.Pool
+	gets        atomic.Uint64
+	puts        atomic.Uint64
+	allocations atomic.Uint64
+}
+
+type BufferPoolStats struct {
+	Gets uint64
+	// Allocations counts gets which could not reuse a buffer
+	Allocations uint64
+	InUse       uint64
 }
 
 func NewBufferPool(initialSize int) *BufferPool {
-	return &BufferPool{
-		pool: sync.Pool{
-			New: func() any {
-				buff := make([]byte, initialSize)
-				return &buff
-			},
-		},
+	bp := &BufferPool{}
+	bp.pool.New = func() any {
+		bp.allocations.Add(1)
+		buff := make([]byte, initialSize)
+		return &buff
 	}
+
+	return bp
 }
 
 func (bp *BufferPool) Get() []byte {
+	bp.gets.Add(1)
 	return *bp.pool.Get().(*[]byte)
 }
 
@@ -26,5 +40,17 @@ func (bp *BufferPool) GetEmpty() []byte {
 }
 
 func (bp *BufferPool) Put(buff []byte) {
+	bp.puts.Add(1)
 	bp.pool.Put(&buff)
 }
+
+func (bp *BufferPool) Stats() BufferPoolStats {
+	puts := bp.puts.Load()
+	gets := bp.gets.Load()
+
+	return BufferPoolStats{
+		Gets:        gets,
+		Allocations: bp.allocations.Load(),
+		InUse:       gets - min(puts, gets),
+	}
+}
@@ -51,3 +51,15 @@ func TestBufferPoolReusesBuffs(t *testing.T) {
 		t.Errorf("Returned buffer is fresh, got length: %d, want: %d", buffLen, resizedSize)
 	}
 }
+
+func TestBufferPoolStats(t *testing.T) {
+	pool := bufferutil.NewBufferPool(16)
+
+	first := pool.Get()
+	pool.Get()
+	pool.Put(first)
+
+	if stats := pool.Stats(); stats.Gets != 2 || stats.InUse != 1 || stats.Allocations != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
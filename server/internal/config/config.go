@@ -8,20 +8,57 @@ import (
 )
 
 type Config struct {
-	Debug  bool
-	Server Server
-	UEK    UEK
-	Mock   Mock
+	Debug             bool
+	DataDirectoryPath string
+	Server            Server
+	UEK               UEK
+	Mock              Mock
+	Snapshot          Snapshot
+	Webhook           Webhook
+	FreeRooms         FreeRooms
+	Search            Search
+	Tracing           Tracing
+	RateLimit         RateLimit
+	Tokens            Tokens
+	ICalSubscriptions ICalSubscriptions
 }
 
 type Server struct {
-	Addr          string
-	EncryptionKey string
+	Addr string
+	// EncryptionKey encrypts tokens, which are prefixed with EncryptionKeyId, so that they can still be decrypted after the key is rotated
+	// EncryptionKey is either a raw AES key, or hex:, base64: or passphrase: followed by a key, from which the AES key is derived
+	EncryptionKey   string
+	EncryptionKeyId string
+	// EncryptionKeySalt is needed to derive keys from passphrases, it should be random and never change while a passphrase is in use
+	EncryptionKeySalt string
+	// DecryptionKeys are previous encryption keys in the id:key format, tokens encrypted with them are still accepted, but no new tokens are
+	DecryptionKeys []string
+	// TrustedProxies are IPs and CIDR ranges of reverse proxies, whose X-Forwarded-For entries are believed when looking for the client IP
+	TrustedProxies []string
+	// ProxyPreset is either empty or "fly", which takes the client IP from the Fly-Client-IP header set by the Fly.io proxy
+	ProxyPreset string
+	// MetricsAddr is where the Prometheus metrics endpoint listens, separately from the public server, it is disabled if empty
+	MetricsAddr string
 }
 
 type UEK struct {
 	UserAgent             string
 	MaxConcurrentRequests int
+	RequestTimeout        time.Duration
+	MaxRetries            int
+	RetryBaseDelay        time.Duration
+	RetryMaxDelay         time.Duration
+	// BreakerFailureThreshold is the number of consecutive failed attempts after which calls fail fast for BreakerOpenDuration, 0 disables the breaker
+	BreakerFailureThreshold   int
+	BreakerOpenDuration       time.Duration
+	CacheMaxEntries           int
+	CacheGroupingsTTL         time.Duration
+	CacheHeadersTTL           time.Duration
+	CacheScheduleTTL          time.Duration
+	CacheStaleWhileRevalidate time.Duration
+	// OfflineFallback persists responses, to serve them when UEK is unavailable
+	OfflineFallback       bool
+	OfflineFallbackMaxAge time.Duration
 }
 
 type Mock struct {
@@ -32,20 +69,116 @@ type Mock struct {
 	DownloadCredentials string
 }
 
+type Snapshot struct {
+	Schedules    []string
+	Credentials  string
+	Interval     time.Duration
+	DaysBack     int
+	DaysAhead    int
+	MaxSnapshots int
+}
+
+type Webhook struct {
+	Enabled                 bool
+	PollInterval            time.Duration
+	DaysAhead               int
+	MaxAttempts             int
+	RetryDelay              time.Duration
+	RequestTimeout          time.Duration
+	AllowInsecureTargets    bool
+	AllowPrivateTargets     bool
+	MaxSubscriptionsPerUser int
+}
+
+type FreeRooms struct {
+	Enabled         bool
+	Credentials     string
+	RefreshInterval time.Duration
+	DaysAhead       int
+}
+
+type Search struct {
+	Enabled         bool
+	Credentials     string
+	RefreshInterval time.Duration
+}
+
+// RateLimit rates are in requests per minute, bursts are how many requests can be made at once after a period of inactivity
+type RateLimit struct {
+	Enabled            bool
+	PerIPRate          int
+	PerIPBurst         int
+	PerCredentialRate  int
+	PerCredentialBurst int
+	// MaxTrackedClients bounds memory use, least recently seen clients are forgotten past it
+	MaxTrackedClients int
+}
+
+// Tokens are encrypted credentials given to clients, ones for the API and ones embedded in iCal subscription URLs
+type Tokens struct {
+	APITTL  time.Duration
+	ICalTTL time.Duration
+	// AllowLegacy accepts tokens issued before tokens had claims, they never expire and are accepted for every audience
+	AllowLegacy bool
+}
+
+type ICalSubscriptions struct {
+	Enabled                 bool
+	MaxSubscriptionsPerUser int
+}
+
+type Tracing struct {
+	Enabled bool
+	// LogSpans logs every finished span
+	LogSpans bool
+	// OTLPEndpoint is the base url of an OpenTelemetry collector accepting OTLP over HTTP, spans are not exported if it is empty
+	OTLPEndpoint      string
+	OTLPFlushInterval time.Duration
+	ServiceName       string
+}
+
 func FromEnv() Config {
 	const serverEnvPrefix = "SERVER_"
 	const uekEnvPrefix = "UEK_"
 	const mockEnvPrefix = "MOCK_"
+	const snapshotEnvPrefix = "SNAPSHOT_"
+	const webhookEnvPrefix = "WEBHOOK_"
+	const freeRoomsEnvPrefix = "FREE_ROOMS_"
+	const searchEnvPrefix = "SEARCH_"
+	const tracingEnvPrefix = "TRACING_"
+	const rateLimitEnvPrefix = "RATE_LIMIT_"
+	const tokensEnvPrefix = "TOKENS_"
+	const icalSubscriptionsEnvPrefix = "ICAL_SUBSCRIPTIONS_"
 
 	return Config{
-		Debug: getEnvBoolWithDefault("DEBUG", false),
+		Debug:             getEnvBoolWithDefault("DEBUG", false),
+		DataDirectoryPath: getEnvStringWithDefault("DATA_DIR", "./data"),
 		Server: Server{
-			Addr:          getEnvStringWithDefault(serverEnvPrefix+"ADDR", ":3001"),
-			EncryptionKey: getEnvString(serverEnvPrefix + "ENCRYPTION_KEY"),
+			Addr:              getEnvStringWithDefault(serverEnvPrefix+"ADDR", ":3001"),
+			EncryptionKey:     getEnvString(serverEnvPrefix + "ENCRYPTION_KEY"),
+			EncryptionKeyId:   getEnvStringWithDefault(serverEnvPrefix+"ENCRYPTION_KEY_ID", "1"),
+			EncryptionKeySalt: getEnvString(serverEnvPrefix + "ENCRYPTION_KEY_SALT"),
+			DecryptionKeys:    getEnvStringList(serverEnvPrefix + "DECRYPTION_KEYS"),
+			TrustedProxies:    getEnvStringList(serverEnvPrefix + "TRUSTED_PROXIES"),
+			ProxyPreset:       getEnvString(serverEnvPrefix + "PROXY_PRESET"),
+			MetricsAddr:       getEnvString(serverEnvPrefix + "METRICS_ADDR"),
 		},
 		UEK: UEK{
-			UserAgent:             getEnvString(uekEnvPrefix + "USER_AGENT"),
-			MaxConcurrentRequests: getEnvIntWithDefault(uekEnvPrefix+"MAX_CONCURRENT_REQUESTS", 1),
+			UserAgent:                 getEnvString(uekEnvPrefix + "USER_AGENT"),
+			MaxConcurrentRequests:     getEnvIntWithDefault(uekEnvPrefix+"MAX_CONCURRENT_REQUESTS", 1),
+			RequestTimeout:            getEnvDurationWithDefault(uekEnvPrefix+"REQUEST_TIMEOUT", 15*time.Second),
+			MaxRetries:                getEnvIntWithDefault(uekEnvPrefix+"MAX_RETRIES", 2),
+			RetryBaseDelay:            getEnvDurationWithDefault(uekEnvPrefix+"RETRY_BASE_DELAY", 250*time.Millisecond),
+			RetryMaxDelay:             getEnvDurationWithDefault(uekEnvPrefix+"RETRY_MAX_DELAY", 4*time.Second),
+			BreakerFailureThreshold:   getEnvIntWithDefault(uekEnvPrefix+"BREAKER_FAILURE_THRESHOLD", 5),
+			BreakerOpenDuration:       getEnvDurationWithDefault(uekEnvPrefix+"BREAKER_OPEN_DURATION", 30*time.Second),
+			CacheMaxEntries:           getEnvIntWithDefault(uekEnvPrefix+"CACHE_MAX_ENTRIES", 1000),
+			CacheGroupingsTTL:         getEnvDurationWithDefault(uekEnvPrefix+"CACHE_GROUPINGS_TTL", 6*time.Hour),
+			CacheHeadersTTL:           getEnvDurationWithDefault(uekEnvPrefix+"CACHE_HEADERS_TTL", time.Hour),
+			CacheScheduleTTL:          getEnvDurationWithDefault(uekEnvPrefix+"CACHE_SCHEDULE_TTL", 5*time.Minute),
+			CacheStaleWhileRevalidate: getEnvDurationWithDefault(uekEnvPrefix+"CACHE_STALE_WHILE_REVALIDATE", time.Hour),
+			OfflineFallback:           getEnvBoolWithDefault(uekEnvPrefix+"OFFLINE_FALLBACK", false),
+			OfflineFallbackMaxAge:     getEnvDurationWithDefault(uekEnvPrefix+"OFFLINE_FALLBACK_MAX_AGE", 30*24*time.Hour),
 		},
 		Mock: Mock{
 			Enabled:             getEnvBoolWithDefault(mockEnvPrefix+"ENABLED", false),
@@ -54,6 +187,60 @@ func FromEnv() Config {
 			DirectoryPath:       getEnvStringWithDefault(mockEnvPrefix+"DIR", "./mock"),
 			DownloadCredentials: getEnvString(mockEnvPrefix + "DOWNLOAD_CREDENTIALS"),
 		},
+		Snapshot: Snapshot{
+			Schedules:    getEnvStringList(snapshotEnvPrefix + "SCHEDULES"),
+			Credentials:  getEnvString(snapshotEnvPrefix + "CREDENTIALS"),
+			Interval:     getEnvDurationWithDefault(snapshotEnvPrefix+"INTERVAL", 30*time.Minute),
+			DaysBack:     getEnvIntWithDefault(snapshotEnvPrefix+"DAYS_BACK", 7),
+			DaysAhead:    getEnvIntWithDefault(snapshotEnvPrefix+"DAYS_AHEAD", 120),
+			MaxSnapshots: getEnvIntWithDefault(snapshotEnvPrefix+"MAX_SNAPSHOTS", 50),
+		},
+		Webhook: Webhook{
+			Enabled:                 getEnvBoolWithDefault(webhookEnvPrefix+"ENABLED", false),
+			PollInterval:            getEnvDurationWithDefault(webhookEnvPrefix+"POLL_INTERVAL", 15*time.Minute),
+			DaysAhead:               getEnvIntWithDefault(webhookEnvPrefix+"DAYS_AHEAD", 60),
+			MaxAttempts:             getEnvIntWithDefault(webhookEnvPrefix+"MAX_ATTEMPTS", 4),
+			RetryDelay:              getEnvDurationWithDefault(webhookEnvPrefix+"RETRY_DELAY", 2*time.Second),
+			RequestTimeout:          getEnvDurationWithDefault(webhookEnvPrefix+"REQUEST_TIMEOUT", 10*time.Second),
+			AllowInsecureTargets:    getEnvBoolWithDefault(webhookEnvPrefix+"ALLOW_INSECURE_TARGETS", false),
+			AllowPrivateTargets:     getEnvBoolWithDefault(webhookEnvPrefix+"ALLOW_PRIVATE_TARGETS", false),
+			MaxSubscriptionsPerUser: getEnvIntWithDefault(webhookEnvPrefix+"MAX_SUBSCRIPTIONS_PER_USER", 5),
+		},
+		FreeRooms: FreeRooms{
+			Enabled:         getEnvBoolWithDefault(freeRoomsEnvPrefix+"ENABLED", false),
+			Credentials:     getEnvString(freeRoomsEnvPrefix + "CREDENTIALS"),
+			RefreshInterval: getEnvDurationWithDefault(freeRoomsEnvPrefix+"REFRESH_INTERVAL", 6*time.Hour),
+			DaysAhead:       getEnvIntWithDefault(freeRoomsEnvPrefix+"DAYS_AHEAD", 14),
+		},
+		Search: Search{
+			Enabled:         getEnvBoolWithDefault(searchEnvPrefix+"ENABLED", false),
+			Credentials:     getEnvString(searchEnvPrefix + "CREDENTIALS"),
+			RefreshInterval: getEnvDurationWithDefault(searchEnvPrefix+"REFRESH_INTERVAL", 12*time.Hour),
+		},
+		Tracing: Tracing{
+			Enabled:           getEnvBoolWithDefault(tracingEnvPrefix+"ENABLED", false),
+			LogSpans:          getEnvBoolWithDefault(tracingEnvPrefix+"LOG_SPANS", true),
+			OTLPEndpoint:      getEnvString(tracingEnvPrefix + "OTLP_ENDPOINT"),
+			OTLPFlushInterval: getEnvDurationWithDefault(tracingEnvPrefix+"OTLP_FLUSH_INTERVAL", 5*time.Second),
+			ServiceName:       getEnvStringWithDefault(tracingEnvPrefix+"SERVICE_NAME", "uek-planzajec-v4"),
+		},
+		RateLimit: RateLimit{
+			Enabled:            getEnvBoolWithDefault(rateLimitEnvPrefix+"ENABLED", false),
+			PerIPRate:          getEnvIntWithDefault(rateLimitEnvPrefix+"PER_IP_RATE", 120),
+			PerIPBurst:         getEnvIntWithDefault(rateLimitEnvPrefix+"PER_IP_BURST", 60),
+			PerCredentialRate:  getEnvIntWithDefault(rateLimitEnvPrefix+"PER_CREDENTIAL_RATE", 240),
+			PerCredentialBurst: getEnvIntWithDefault(rateLimitEnvPrefix+"PER_CREDENTIAL_BURST", 120),
+			MaxTrackedClients:  getEnvIntWithDefault(rateLimitEnvPrefix+"MAX_TRACKED_CLIENTS", 10000),
+		},
+		Tokens: Tokens{
+			APITTL:      getEnvDurationWithDefault(tokensEnvPrefix+"API_TTL", 90*24*time.Hour),
+			ICalTTL:     getEnvDurationWithDefault(tokensEnvPrefix+"ICAL_TTL", 365*24*time.Hour),
+			AllowLegacy: getEnvBoolWithDefault(tokensEnvPrefix+"ALLOW_LEGACY", true),
+		},
+		ICalSubscriptions: ICalSubscriptions{
+			Enabled:                 getEnvBoolWithDefault(icalSubscriptionsEnvPrefix+"ENABLED", true),
+			MaxSubscriptionsPerUser: getEnvIntWithDefault(icalSubscriptionsEnvPrefix+"MAX_SUBSCRIPTIONS_PER_USER", 20),
+		},
 	}
 }
 
@@ -70,6 +257,16 @@ func getEnvStringWithDefault(key string, defaultValue string) string {
 	return value
 }
 
+func getEnvStringList(key string) []string {
+	values := []string{}
+	for value := range strings.SplitSeq(getEnvString(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getEnvBoolWithDefault(key string, defaultValue bool) bool {
 	value, err := strconv.ParseBool(getEnvString(key))
 	if err != nil {
@@ -0,0 +1,146 @@
+package encryption
+
+import (
+	"crypto/hkdf"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	keyFormatHex        = "hex:"
+	keyFormatBase64     = "base64:"
+	keyFormatPassphrase = "passphrase:"
+)
+
+const (
+	minMasterKeyLength      = 16
+	minPassphraseLength     = 16
+	minPassphraseSaltLength = 8
+	// passphraseIterations follows the OWASP recommendation for PBKDF2-HMAC-SHA256
+	passphraseIterations = 600_000
+	derivedKeyLength     = 32
+)
+
+// PurposeTokenEncryption is the purpose of the subkey used by Service, other purposes get unrelated subkeys of the same master key
+const PurposeTokenEncryption = "token-encryption"
+
+// MasterKey is the secret given by the operator, it is never used directly, except for raw keys, which were used directly before subkeys existed
+type MasterKey struct {
+	secret []byte
+	raw    bool
+}
+
+// ParseMasterKey accepts hex:<key>, base64:<key>, passphrase:<passphrase> and raw 16, 24 or 32 byte AES keys.
+// passphraseSalt is only used for passphrases, it should be random and stay the same for as long as the key is used
+func ParseMasterKey(rawKey string, passphraseSalt string) (MasterKey, error) {
+	switch {
+	case rawKey == "":
+		return MasterKey{}, fmt.Errorf(errPrefix + "key is empty")
+	case strings.HasPrefix(rawKey, keyFormatHex):
+		secret, err := hex.DecodeString(strings.TrimPrefix(rawKey, keyFormatHex))
+		if err != nil {
+			return MasterKey{}, fmt.Errorf(errPrefix+"key is not valid hex: %w", err)
+		}
+		return newMasterKey(secret)
+	case strings.HasPrefix(rawKey, keyFormatBase64):
+		encodedSecret := strings.TrimPrefix(rawKey, keyFormatBase64)
+		secret, err := base64.StdEncoding.DecodeString(encodedSecret)
+		if err != nil {
+			// keys generated for urls are just as good
+			if secret, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(encodedSecret, "=")); err != nil {
+				return MasterKey{}, fmt.Errorf(errPrefix+"key is not valid base64: %w", err)
+			}
+		}
+		return newMasterKey(secret)
+	case strings.HasPrefix(rawKey, keyFormatPassphrase):
+		passphrase := strings.TrimPrefix(rawKey, keyFormatPassphrase)
+		if len(passphrase) < minPassphraseLength {
+			return MasterKey{}, fmt.Errorf(errPrefix+"passphrase should be at least %d characters long", minPassphraseLength)
+		}
+		if len(passphraseSalt) < minPassphraseSaltLength {
+			return MasterKey{}, fmt.Errorf(errPrefix+"passphrase salt should be at least %d characters long", minPassphraseSaltLength)
+		}
+
+		secret, err := pbkdf2.Key(sha256.New, passphrase, []byte(passphraseSalt), passphraseIterations, derivedKeyLength)
+		if err != nil {
+			return MasterKey{}, fmt.Errorf(errPrefix+"failed to derive key from passphrase: %w", err)
+		}
+		return newMasterKey(secret)
+	}
+
+	switch len(rawKey) {
+	case 16, 24, 32:
+		return MasterKey{
+			secret: []byte(rawKey),
+			raw:    true,
+		}, nil
+	default:
+		return MasterKey{}, fmt.Errorf(errPrefix+"raw key should be 16, 24 or 32 bytes long, got %d bytes, use the hex:, base64: or passphrase: prefix for other keys", len(rawKey))
+	}
+}
+
+func newMasterKey(secret []byte) (MasterKey, error) {
+	if len(secret) < minMasterKeyLength {
+		return MasterKey{}, fmt.Errorf(errPrefix+"key should be at least %d bytes long, got %d bytes", minMasterKeyLength, len(secret))
+	}
+
+	return MasterKey{
+		secret: secret,
+	}, nil
+}
+
+// Subkey derives a key for purpose with HKDF-SHA256, so that a key leaked from one use does not compromise the others
+func (k MasterKey) Subkey(purpose string) ([]byte, error) {
+	// raw keys keep encrypting tokens as they did before subkeys, so that their tokens remain valid
+	if k.raw && purpose == PurposeTokenEncryption {
+		return k.secret, nil
+	}
+
+	return hkdf.Key(sha256.New, k.secret, nil, "uek-planzajec-v4 "+purpose, derivedKeyLength)
+}
+
+// Key is one key of the keyring, its id is stored in every ciphertext encrypted with it
+type Key struct {
+	Id string
+	// Value is the token encryption subkey
+	Value          []byte
+	OwnerHashValue []byte
+}
+
+// NewKey creates a keyring key from subkeys of rawKey, see ParseMasterKey for accepted formats
+func NewKey(id string, rawKey string, passphraseSalt string) (Key, error) {
+	masterKey, err := ParseMasterKey(rawKey, passphraseSalt)
+	if err != nil {
+		return Key{}, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	value, err := masterKey.Subkey(PurposeTokenEncryption)
+	if err != nil {
+		return Key{}, fmt.Errorf(errPrefix+"key %s: failed to derive subkey: %w", id, err)
+	}
+
+	ownerHashValue, err := masterKey.Subkey(PurposeOwnerHash)
+	if err != nil {
+		return Key{}, fmt.Errorf(errPrefix+"key %s: failed to derive subkey: %w", id, err)
+	}
+
+	return Key{
+		Id:             id,
+		Value:          value,
+		OwnerHashValue: ownerHashValue,
+	}, nil
+}
+
+// ParseKey parses keys in the id:key format
+func ParseKey(rawKey string, passphraseSalt string) (Key, error) {
+	id, value, ok := strings.Cut(rawKey, ":")
+	if !ok {
+		return Key{}, fmt.Errorf(errPrefix + "key should be in the id:key format")
+	}
+
+	return NewKey(id, value, passphraseSalt)
+}
@@ -0,0 +1,93 @@
+package encryption_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+)
+
+const testPassphraseSalt = "HUrp3yEAfVv9wQk2"
+
+func TestParseMasterKey(t *testing.T) {
+	for _, testCase := range []struct {
+		rawKey      string
+		salt        string
+		expectedErr bool
+	}{
+		{rawKey: "g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI="},
+		{rawKey: "0123456789abcdef"},
+		{rawKey: "hex:000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"},
+		{rawKey: "base64:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8="},
+		{rawKey: "base64:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8"},
+		{rawKey: "passphrase:correct horse battery staple", salt: testPassphraseSalt},
+		{rawKey: "", expectedErr: true},
+		{rawKey: "too short raw key", expectedErr: true},
+		{rawKey: "hex:0g", expectedErr: true},
+		{rawKey: "hex:00010203", expectedErr: true},
+		{rawKey: "base64:!!!", expectedErr: true},
+		{rawKey: "passphrase:short", salt: testPassphraseSalt, expectedErr: true},
+		{rawKey: "passphrase:correct horse battery staple", expectedErr: true},
+	} {
+		_, err := encryption.ParseMasterKey(testCase.rawKey, testCase.salt)
+		if testCase.expectedErr && err == nil {
+			t.Errorf("%q: expected an error", testCase.rawKey)
+		} else if !testCase.expectedErr && err != nil {
+			t.Errorf("%q: unexpected error: %s", testCase.rawKey, err)
+		}
+	}
+}
+
+func TestMasterKeySubkey(t *testing.T) {
+	const rawKey = "g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI="
+
+	// tokens encrypted before subkeys existed have to remain valid
+	rawMasterKey, err := encryption.ParseMasterKey(rawKey, "")
+	if err != nil {
+		t.Errorf("Failed to parse raw key: %s", err)
+		return
+	}
+	if subkey, err := rawMasterKey.Subkey(encryption.PurposeTokenEncryption); err != nil || !bytes.Equal(subkey, []byte(rawKey)) {
+		t.Errorf("Token encryption subkey of a raw key should be the raw key, got: %x %v", subkey, err)
+		return
+	}
+
+	hexMasterKey, err := encryption.ParseMasterKey("hex:000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "")
+	if err != nil {
+		t.Errorf("Failed to parse hex key: %s", err)
+		return
+	}
+	base64MasterKey, err := encryption.ParseMasterKey("base64:AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=", "")
+	if err != nil {
+		t.Errorf("Failed to parse base64 key: %s", err)
+		return
+	}
+
+	hexSubkey, _ := hexMasterKey.Subkey(encryption.PurposeTokenEncryption)
+	base64Subkey, _ := base64MasterKey.Subkey(encryption.PurposeTokenEncryption)
+	if len(hexSubkey) != 32 || !bytes.Equal(hexSubkey, base64Subkey) {
+		t.Errorf("Same key in different encodings should have the same subkey, got: %x and %x", hexSubkey, base64Subkey)
+		return
+	}
+
+	otherSubkey, _ := hexMasterKey.Subkey("signing")
+	if bytes.Equal(hexSubkey, otherSubkey) {
+		t.Error("Subkeys for different purposes should differ")
+		return
+	}
+
+	passphraseKey1, err := encryption.NewKey("1", "passphrase:correct horse battery staple", testPassphraseSalt)
+	if err != nil {
+		t.Errorf("Failed to create key from passphrase: %s", err)
+		return
+	}
+	passphraseKey2, err := encryption.NewKey("1", "passphrase:correct horse battery staple", testPassphraseSalt+"!")
+	if err != nil {
+		t.Errorf("Failed to create key from passphrase: %s", err)
+		return
+	}
+	if bytes.Equal(passphraseKey1.Value, passphraseKey2.Value) {
+		t.Error("Keys derived from the same passphrase with different salts should differ")
+		return
+	}
+}
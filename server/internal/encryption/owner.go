@@ -0,0 +1,63 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// PurposeOwnerHash is the purpose of the subkey used by HashOwner
+const PurposeOwnerHash = "owner-hash"
+
+var ErrInvalidBasicAuth = errors.New(errPrefix + "invalid basic auth value")
+
+// HashOwner identifies the owner of stored data by the UEK login in basicAuthValue, so that owners keep access after changing their password.
+// The login is hashed with HMAC-SHA256 under a subkey of the active key, so that it cannot be recovered from stored data without the key.
+// The hash does not prove knowledge of the password, owners should be verified with UEK before they are given access
+func (s *Service) HashOwner(basicAuthValue string) (string, error) {
+	return s.hashOwner(s.activeKeyId, basicAuthValue)
+}
+
+// IsOwner checks ownerHash with the key it was created with
+func (s *Service) IsOwner(ownerHash string, basicAuthValue string) bool {
+	keyId, _, ok := strings.Cut(ownerHash, keyIdSeparator)
+	if !ok {
+		return false
+	}
+
+	expectedOwnerHash, err := s.hashOwner(keyId, basicAuthValue)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal([]byte(ownerHash), []byte(expectedOwnerHash))
+}
+
+// IsOwnerHashedWithActiveKey tells if HashOwner would give a different hash for the same owner
+func (s *Service) IsOwnerHashedWithActiveKey(ownerHash string) bool {
+	return s.IsEncryptedWithActiveKey(ownerHash)
+}
+
+func (s *Service) hashOwner(keyId string, basicAuthValue string) (string, error) {
+	ownerHashKey, ok := s.ownerHashKeyByKeyId[keyId]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	credentials, err := base64.StdEncoding.DecodeString(basicAuthValue)
+	if err != nil {
+		return "", ErrInvalidBasicAuth
+	}
+
+	login, _, ok := strings.Cut(string(credentials), ":")
+	if !ok || login == "" {
+		return "", ErrInvalidBasicAuth
+	}
+
+	mac := hmac.New(sha256.New, ownerHashKey)
+	mac.Write([]byte(login))
+	return keyId + keyIdSeparator + hex.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,68 @@
+package encryption_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/bufferutil"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+)
+
+func TestServiceHashOwner(t *testing.T) {
+	oldService, err := encryption.NewService(testEncryptionKey1, nil, bufferutil.NewBufferPool(8*1024))
+	if err != nil {
+		t.Errorf("Failed to create old encryption service: %s", err)
+		return
+	}
+
+	newService, err := encryption.NewService(testEncryptionKey3, []encryption.Key{testEncryptionKey1}, bufferutil.NewBufferPool(8*1024))
+	if err != nil {
+		t.Errorf("Failed to create new encryption service: %s", err)
+		return
+	}
+
+	basicAuthValue := base64.StdEncoding.EncodeToString([]byte("student123:password"))
+	changedPasswordBasicAuthValue := base64.StdEncoding.EncodeToString([]byte("student123:changed-password"))
+	otherBasicAuthValue := base64.StdEncoding.EncodeToString([]byte("student456:password"))
+
+	ownerHash, err := oldService.HashOwner(basicAuthValue)
+	if err != nil {
+		t.Errorf("Failed to hash owner: %s", err)
+		return
+	}
+
+	if strings.Contains(ownerHash, "student123") {
+		t.Errorf("Owner hash should not contain the login, got: %s", ownerHash)
+		return
+	}
+
+	if !newService.IsOwner(ownerHash, changedPasswordBasicAuthValue) {
+		t.Error("Owner should be recognized after changing the password and rotating the key")
+		return
+	}
+
+	if newService.IsOwner(ownerHash, otherBasicAuthValue) {
+		t.Error("Other logins should not be recognized as the owner")
+		return
+	}
+
+	if newService.IsOwnerHashedWithActiveKey(ownerHash) {
+		t.Error("Owner hash created with a decryption key should not be reported as hashed with the active key")
+		return
+	}
+
+	// without a key id, a hash could only have been made without the key
+	unkeyedOwnerHash := sha256.Sum256([]byte(basicAuthValue))
+	if newService.IsOwner(hex.EncodeToString(unkeyedOwnerHash[:]), basicAuthValue) {
+		t.Error("Owner hashes without a key id should not be recognized")
+		return
+	}
+
+	if _, err := newService.HashOwner(base64.StdEncoding.EncodeToString([]byte("no-separator"))); err == nil {
+		t.Error("Should return an error if the basic auth value has no login")
+		return
+	}
+}
@@ -5,91 +5,247 @@ import (
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
 
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/bufferutil"
 )
 
+const errPrefix = "encryption: "
+
+// keyIdSeparator separates the key id from the ciphertext in encrypted text, it is not in the base64 url alphabet
+const keyIdSeparator = "."
+
+const maxKeyIdLength = 16
+
+var ErrUnknownKey = errors.New(errPrefix + "ciphertext was encrypted with an unknown key")
+
+// Service encrypts with the active key, and decrypts with any key of the keyring, so that tokens keep working after the active key is rotated
 type Service struct {
-	gcm        cipher.AEAD
+	activeKeyId string
+	gcmByKeyId  map[string]cipher.AEAD
+	// ownerHashKeyByKeyId are subkeys of the same master keys, for HashOwner
+	ownerHashKeyByKeyId map[string][]byte
+	// keyIds are in the order keys were given, starting with the active key
+	keyIds     []string
 	bufferPool *bufferutil.BufferPool
 }
 
-func NewService(encryptionKey []byte, bufferPool *bufferutil.BufferPool) (*Service, error) {
-	block, err := aes.NewCipher(encryptionKey)
-	if err != nil {
-		return nil, err
+// decryptionKeys are previous active keys, they are never used to encrypt
+func NewService(activeKey Key, decryptionKeys []Key, bufferPool *bufferutil.BufferPool) (*Service, error) {
+	s := &Service{
+		activeKeyId:         activeKey.Id,
+		gcmByKeyId:          map[string]cipher.AEAD{},
+		ownerHashKeyByKeyId: map[string][]byte{},
+		bufferPool:          bufferPool,
 	}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
+	for _, key := range append([]Key{activeKey}, decryptionKeys...) {
+		if err := validateKeyId(key.Id); err != nil {
+			return nil, err
+		}
+
+		if _, ok := s.gcmByKeyId[key.Id]; ok {
+			return nil, fmt.Errorf(errPrefix+"duplicate key id: %s", key.Id)
+		}
+
+		block, err := aes.NewCipher(key.Value)
+		if err != nil {
+			return nil, fmt.Errorf(errPrefix+"invalid key %s: %w", key.Id, err)
+		}
+
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf(errPrefix+"invalid key %s: %w", key.Id, err)
+		}
+
+		if len(key.OwnerHashValue) == 0 {
+			return nil, fmt.Errorf(errPrefix+"key %s has no owner hash subkey", key.Id)
+		}
+
+		s.gcmByKeyId[key.Id] = gcm
+		s.ownerHashKeyByKeyId[key.Id] = key.OwnerHashValue
+		s.keyIds = append(s.keyIds, key.Id)
 	}
 
-	return &Service{
-		gcm:        gcm,
-		bufferPool: bufferPool,
-	}, nil
+	return s, nil
 }
 
-func (s *Service) Encrypt(plainBuff []byte) ([]byte, error) {
+func validateKeyId(keyId string) error {
+	if keyId == "" || len(keyId) > maxKeyIdLength {
+		return fmt.Errorf(errPrefix+"key id should be between 1 and %d characters long: %q", maxKeyIdLength, keyId)
+	}
+
+	for _, r := range keyId {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return fmt.Errorf(errPrefix+"key id should only contain letters, digits, '-' and '_': %q", keyId)
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) ActiveKeyId() string {
+	return s.activeKeyId
+}
+
+// encrypt returns the encoded ciphertext, pooled buffers are only used until it is encoded, since they can be reused as soon as they are put back
+func (s *Service) encrypt(gcm cipher.AEAD, plainBuff []byte, additionalData []byte) (string, error) {
 	nonceBuff := s.bufferPool.Get()
-	defer s.bufferPool.Put(nonceBuff)
+	defer func() { s.bufferPool.Put(nonceBuff) }()
 
-	nonceBuff = bufferutil.EnsureBufferSize(nonceBuff, s.gcm.NonceSize())
+	nonceBuff = bufferutil.EnsureBufferSize(nonceBuff, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonceBuff); err != nil {
-		return nil, err
+		return "", err
 	}
 
 	cipherBuff := s.bufferPool.GetEmpty()
-	defer s.bufferPool.Put(cipherBuff)
+	defer func() { s.bufferPool.Put(cipherBuff) }()
 
 	cipherBuff = append(cipherBuff, nonceBuff...)
-	cipherBuff = s.gcm.Seal(cipherBuff, nonceBuff, plainBuff, nil)
+	cipherBuff = gcm.Seal(cipherBuff, nonceBuff, plainBuff, additionalData)
 
-	return cipherBuff, nil
+	return base64.URLEncoding.EncodeToString(cipherBuff), nil
 }
 
+// EncryptText returns the ciphertext prefixed with the id of the active key
 func (s *Service) EncryptText(plainText string) (string, error) {
-	cipherBuff, err := s.Encrypt([]byte(plainText))
+	encodedCipherText, err := s.encrypt(s.gcmByKeyId[s.activeKeyId], []byte(plainText), nil)
 	if err != nil {
 		return "", err
 	}
 
-	return base64.URLEncoding.EncodeToString(cipherBuff), nil
+	return s.activeKeyId + keyIdSeparator + encodedCipherText, nil
 }
 
-func (s *Service) Decrypt(cipherBuff []byte) ([]byte, error) {
-	nonceSize := s.gcm.NonceSize()
+// decrypt copies the plaintext out of the pooled buffer, like encrypt does with the ciphertext
+func (s *Service) decrypt(gcm cipher.AEAD, cipherBuff []byte, additionalData []byte) (string, error) {
+	nonceSize := gcm.NonceSize()
 	if len(cipherBuff) < nonceSize {
-		return nil, errors.New("ciphertext too short")
+		return "", errors.New(errPrefix + "ciphertext too short")
 	}
 
 	nonce := cipherBuff[:nonceSize]
 	ciphertext := cipherBuff[nonceSize:]
 
 	plainBuff := s.bufferPool.GetEmpty()
-	defer s.bufferPool.Put(plainBuff)
+	defer func() { s.bufferPool.Put(plainBuff) }()
 
-	return s.gcm.Open(plainBuff, nonce, ciphertext, nil)
+	var err error
+	if plainBuff, err = gcm.Open(plainBuff, nonce, ciphertext, additionalData); err != nil {
+		return "", err
+	}
+
+	return string(plainBuff), nil
 }
 
+// DecryptText also accepts ciphertexts without a key id, from before keys could be rotated, by trying every key
 func (s *Service) DecryptText(cipherText string) (string, error) {
+	keyIds := s.keyIds
+	keyId, encodedCipherText, hasKeyId := strings.Cut(cipherText, keyIdSeparator)
+	if hasKeyId {
+		if _, ok := s.gcmByKeyId[keyId]; !ok {
+			return "", ErrUnknownKey
+		}
+		keyIds = []string{keyId}
+	} else {
+		encodedCipherText = cipherText
+	}
+
+	return s.decryptEncodedText(keyIds, encodedCipherText, nil)
+}
+
+func (s *Service) decryptEncodedText(keyIds []string, encodedCipherText string, additionalData []byte) (string, error) {
 	cipherBuff := s.bufferPool.Get()
-	defer s.bufferPool.Put(cipherBuff)
+	defer func() { s.bufferPool.Put(cipherBuff) }()
 
-	cipherBuff = bufferutil.EnsureBufferSizeAtLeast(cipherBuff, base64.URLEncoding.DecodedLen(len(cipherText)))
-	n, err := base64.URLEncoding.Decode(cipherBuff, []byte(cipherText))
+	cipherBuff = bufferutil.EnsureBufferSizeAtLeast(cipherBuff, base64.URLEncoding.DecodedLen(len(encodedCipherText)))
+	n, err := base64.URLEncoding.Decode(cipherBuff, []byte(encodedCipherText))
 	if err != nil {
 		return "", err
 	}
 	cipherBuff = cipherBuff[:n]
 
-	plainBuff, err := s.Decrypt(cipherBuff)
+	var plainText string
+	for _, keyId := range keyIds {
+		if plainText, err = s.decrypt(s.gcmByKeyId[keyId], cipherBuff, additionalData); err == nil {
+			return plainText, nil
+		}
+	}
+
+	return "", err
+}
+
+// IsEncryptedWithActiveKey tells if ReencryptText would change the key of cipherText, it does not check if cipherText can be decrypted
+func (s *Service) IsEncryptedWithActiveKey(cipherText string) bool {
+	keyId, _, hasKeyId := strings.Cut(cipherText, keyIdSeparator)
+	return hasKeyId && keyId == s.activeKeyId
+}
+
+// ReencryptText decrypts cipherText with whichever key it was encrypted with, and encrypts it again with the active key
+func (s *Service) ReencryptText(cipherText string) (string, error) {
+	plainText, err := s.DecryptText(cipherText)
 	if err != nil {
 		return "", err
 	}
 
-	return string(plainBuff), nil
+	return s.EncryptText(plainText)
+}
+
+// TokenClaims are readable by anyone holding the token, but cannot be changed without the key, times are unix seconds
+type TokenClaims struct {
+	Id        string `json:"jti"`
+	Audience  string `json:"aud"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// EncryptToken is like EncryptText, but the ciphertext comes with claims, which are authenticated as additional data
+func (s *Service) EncryptToken(plainText string, claims TokenClaims) (string, error) {
+	claimsBuff, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf(errPrefix+"failed to encode claims: %w", err)
+	}
+
+	// the key id is authenticated along with the claims
+	prefix := s.activeKeyId + keyIdSeparator + base64.URLEncoding.EncodeToString(claimsBuff)
+	encodedCipherText, err := s.encrypt(s.gcmByKeyId[s.activeKeyId], []byte(plainText), []byte(prefix))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + keyIdSeparator + encodedCipherText, nil
+}
+
+// DecryptToken also accepts ciphertexts from EncryptText, their claims are zero, which tells them apart from tokens
+func (s *Service) DecryptToken(token string) (string, TokenClaims, error) {
+	parts := strings.Split(token, keyIdSeparator)
+	if len(parts) != 3 {
+		plainText, err := s.DecryptText(token)
+		return plainText, TokenClaims{}, err
+	}
+
+	if _, ok := s.gcmByKeyId[parts[0]]; !ok {
+		return "", TokenClaims{}, ErrUnknownKey
+	}
+
+	claimsBuff, err := base64.URLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", TokenClaims{}, err
+	}
+
+	plainText, err := s.decryptEncodedText(parts[:1], parts[2], []byte(parts[0]+keyIdSeparator+parts[1]))
+	if err != nil {
+		return "", TokenClaims{}, err
+	}
+
+	claims := TokenClaims{}
+	if err := json.Unmarshal(claimsBuff, &claims); err != nil {
+		return "", TokenClaims{}, fmt.Errorf(errPrefix+"failed to decode claims: %w", err)
+	}
+
+	return plainText, claims, nil
 }
@@ -1,19 +1,26 @@
 package encryption_test
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/bufferutil"
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
 )
 
-var testEncryptionKey1 = []byte("g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI=")
-var testEncryptionKey2 = []byte("0N35xLl1ve1nWJHI/g0ZH6qmSSVPSik=")
+var testEncryptionKey1 = encryption.Key{Id: "1", Value: []byte("g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI="), OwnerHashValue: []byte("owner-g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI=")}
+var testEncryptionKey2 = encryption.Key{Id: "1", Value: []byte("0N35xLl1ve1nWJHI/g0ZH6qmSSVPSik="), OwnerHashValue: []byte("owner-0N35xLl1ve1nWJHI/g0ZH6qmSSVPSik=")}
+var testEncryptionKey3 = encryption.Key{Id: "2", Value: []byte("0N35xLl1ve1nWJHI/g0ZH6qmSSVPSik="), OwnerHashValue: []byte("owner-0N35xLl1ve1nWJHI/g0ZH6qmSSVPSik=")}
 
 const textToEncrypt = "87f374f93f78dm89swd7293dh2db7sbfd7wbf768ds78fbdsfb29bd28d2 hd29d 9xx🥀"
 
 func TestServiceEncryptDecrypt(t *testing.T) {
-	service, err := encryption.NewService(testEncryptionKey1, bufferutil.NewBufferPool(8*1024))
+	service, err := encryption.NewService(testEncryptionKey1, nil, bufferutil.NewBufferPool(8*1024))
 	if err != nil {
 		t.Errorf("Failed to create encryption service: %s", err)
 		return
@@ -36,8 +43,44 @@ func TestServiceEncryptDecrypt(t *testing.T) {
 	}
 }
 
+// pooled buffers are reused by other goroutines as soon as they are put back, so results must not share memory with them
+func TestServiceConcurrentEncryptDecrypt(t *testing.T) {
+	service, err := encryption.NewService(testEncryptionKey1, nil, bufferutil.NewBufferPool(8*1024))
+	if err != nil {
+		t.Errorf("Failed to create encryption service: %s", err)
+		return
+	}
+
+	wg := sync.WaitGroup{}
+	for i := range 16 {
+		wg.Go(func() {
+			for j := range 200 {
+				plainText := strings.Repeat(strconv.Itoa(i), j%32+1)
+
+				encryptedText, err := service.EncryptText(plainText)
+				if err != nil {
+					t.Errorf("Failed to encrypt text: %s", err)
+					return
+				}
+
+				decryptedText, err := service.DecryptText(encryptedText)
+				if err != nil {
+					t.Errorf("Failed to decrypt text: %s", err)
+					return
+				}
+
+				if decryptedText != plainText {
+					t.Errorf("Decrypted text does not match original, got: %s, want: %s", decryptedText, plainText)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
 func TestServiceEncryptDecryptKeyMismatch(t *testing.T) {
-	service1, err := encryption.NewService(testEncryptionKey1, bufferutil.NewBufferPool(8*1024))
+	service1, err := encryption.NewService(testEncryptionKey1, nil, bufferutil.NewBufferPool(8*1024))
 	if err != nil {
 		t.Errorf("Failed to create encryption service 1: %s", err)
 		return
@@ -49,7 +92,7 @@ func TestServiceEncryptDecryptKeyMismatch(t *testing.T) {
 		return
 	}
 
-	service2, err := encryption.NewService(testEncryptionKey2, bufferutil.NewBufferPool(8*1024))
+	service2, err := encryption.NewService(testEncryptionKey2, nil, bufferutil.NewBufferPool(8*1024))
 	if err != nil {
 		t.Errorf("Failed to create encryption service 2: %s", err)
 		return
@@ -60,3 +103,126 @@ func TestServiceEncryptDecryptKeyMismatch(t *testing.T) {
 		return
 	}
 }
+
+func TestServiceKeyRotation(t *testing.T) {
+	oldService, err := encryption.NewService(testEncryptionKey1, nil, bufferutil.NewBufferPool(8*1024))
+	if err != nil {
+		t.Errorf("Failed to create old encryption service: %s", err)
+		return
+	}
+
+	oldEncryptedText, err := oldService.EncryptText(textToEncrypt)
+	if err != nil {
+		t.Errorf("Failed to encrypt text: %s", err)
+		return
+	}
+
+	if !strings.HasPrefix(oldEncryptedText, testEncryptionKey1.Id+".") {
+		t.Errorf("Encrypted text should be prefixed with the key id, got: %s", oldEncryptedText)
+		return
+	}
+
+	newService, err := encryption.NewService(testEncryptionKey3, []encryption.Key{testEncryptionKey1}, bufferutil.NewBufferPool(8*1024))
+	if err != nil {
+		t.Errorf("Failed to create new encryption service: %s", err)
+		return
+	}
+
+	// tokens from before key ids were added have no prefix
+	_, legacyEncryptedText, _ := strings.Cut(oldEncryptedText, ".")
+	for _, encryptedText := range []string{oldEncryptedText, legacyEncryptedText} {
+		if decryptedText, err := newService.DecryptText(encryptedText); err != nil {
+			t.Errorf("Failed to decrypt text encrypted with a decryption key %s: %s", encryptedText, err)
+			return
+		} else if decryptedText != textToEncrypt {
+			t.Errorf("Decrypted text does not match original, got: %s, want: %s", decryptedText, textToEncrypt)
+			return
+		}
+	}
+
+	if newService.IsEncryptedWithActiveKey(oldEncryptedText) {
+		t.Error("Text encrypted with a decryption key should not be reported as encrypted with the active key")
+		return
+	}
+
+	reencryptedText, err := newService.ReencryptText(oldEncryptedText)
+	if err != nil {
+		t.Errorf("Failed to re-encrypt text: %s", err)
+		return
+	}
+
+	if !newService.IsEncryptedWithActiveKey(reencryptedText) {
+		t.Errorf("Re-encrypted text should be encrypted with the active key, got: %s", reencryptedText)
+		return
+	}
+
+	if _, err := oldService.DecryptText(reencryptedText); !errors.Is(err, encryption.ErrUnknownKey) {
+		t.Errorf("Should return ErrUnknownKey if encrypted with a key missing from the keyring, got: %v", err)
+		return
+	}
+}
+
+func TestServiceInvalidKeyring(t *testing.T) {
+	if _, err := encryption.NewService(testEncryptionKey1, []encryption.Key{testEncryptionKey2}, bufferutil.NewBufferPool(8*1024)); err == nil {
+		t.Error("Should return an error if key ids are duplicated")
+		return
+	}
+
+	if _, err := encryption.NewService(encryption.Key{Id: "a.b", Value: testEncryptionKey1.Value}, nil, bufferutil.NewBufferPool(8*1024)); err == nil {
+		t.Error("Should return an error if the key id contains the separator")
+		return
+	}
+}
+
+func TestServiceTokenClaimsAreAuthenticated(t *testing.T) {
+	service, err := encryption.NewService(testEncryptionKey1, nil, bufferutil.NewBufferPool(8*1024))
+	if err != nil {
+		t.Errorf("Failed to create encryption service: %s", err)
+		return
+	}
+
+	claims := encryption.TokenClaims{
+		Id:        "abc",
+		Audience:  "ical",
+		IssuedAt:  1700000000,
+		ExpiresAt: 1800000000,
+	}
+	token, err := service.EncryptToken(textToEncrypt, claims)
+	if err != nil {
+		t.Errorf("Failed to encrypt token: %s", err)
+		return
+	}
+
+	decryptedText, decryptedClaims, err := service.DecryptToken(token)
+	if err != nil {
+		t.Errorf("Failed to decrypt token: %s", err)
+		return
+	}
+
+	if decryptedText != textToEncrypt || decryptedClaims != claims {
+		t.Errorf("Decrypted token does not match original, got: %s %+v, want: %s %+v", decryptedText, decryptedClaims, textToEncrypt, claims)
+		return
+	}
+
+	parts := strings.Split(token, ".")
+	tamperedClaims := claims
+	tamperedClaims.ExpiresAt = 1900000000
+	tamperedClaimsBuff, _ := json.Marshal(tamperedClaims)
+	tamperedToken := parts[0] + "." + base64.URLEncoding.EncodeToString(tamperedClaimsBuff) + "." + parts[2]
+	if _, _, err := service.DecryptToken(tamperedToken); err == nil {
+		t.Error("Should return an error if claims were changed")
+		return
+	}
+
+	// text without claims is still accepted, with zero claims
+	encryptedText, err := service.EncryptText(textToEncrypt)
+	if err != nil {
+		t.Errorf("Failed to encrypt text: %s", err)
+		return
+	}
+
+	if decryptedText, decryptedClaims, err := service.DecryptToken(encryptedText); err != nil || decryptedText != textToEncrypt || decryptedClaims != (encryption.TokenClaims{}) {
+		t.Errorf("Failed to decrypt text without claims, got: %s %+v %v", decryptedText, decryptedClaims, err)
+		return
+	}
+}
@@ -0,0 +1,125 @@
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const errPrefix = "filestore: "
+
+const fileExtension = ".json"
+
+// Store keeps JSON encoded values in a directory, one file per key
+type Store struct {
+	dirPath string
+	mu      sync.RWMutex
+}
+
+func New(dirPath string) (*Store, error) {
+	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		return nil, fmt.Errorf(errPrefix+"failed to create directory: %w", err)
+	}
+
+	return &Store{
+		dirPath: dirPath,
+	}, nil
+}
+
+// Get decodes value stored under key into val, and reports whether it existed
+func (s *Store) Get(key string, val any) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	f, err := os.Open(s.getFilePath(key))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf(errPrefix+"failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(val); err != nil {
+		return false, fmt.Errorf(errPrefix+"failed to decode value: %w", err)
+	}
+
+	return true, nil
+}
+
+// Put replaces value stored under key, readers never observe partially written values
+func (s *Store) Put(key string, val any) error {
+	tmpFile, err := os.CreateTemp(s.dirPath, "*.tmp")
+	if err != nil {
+		return fmt.Errorf(errPrefix+"failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if err := json.NewEncoder(tmpFile).Encode(val); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf(errPrefix+"failed to encode value: %w", err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf(errPrefix+"failed to write temporary file: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Rename(tmpFile.Name(), s.getFilePath(key)); err != nil {
+		return fmt.Errorf(errPrefix+"failed to replace file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.getFilePath(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf(errPrefix+"failed to remove file: %w", err)
+	}
+
+	return nil
+}
+
+// Keys lists all stored keys starting with prefix
+func (s *Store) Keys(prefix string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dirEntries, err := os.ReadDir(s.dirPath)
+	if err != nil {
+		return nil, fmt.Errorf(errPrefix+"failed to read directory: %w", err)
+	}
+
+	keys := []string{}
+	for _, dirEntry := range dirEntries {
+		fileName, ok := strings.CutSuffix(dirEntry.Name(), fileExtension)
+		if !ok || dirEntry.IsDir() {
+			continue
+		}
+
+		key, err := url.QueryUnescape(fileName)
+		if err != nil || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// keys are escaped so that any string is a valid file name on every platform
+func (s *Store) getFilePath(key string) string {
+	return filepath.Join(s.dirPath, url.QueryEscape(key)+fileExtension)
+}
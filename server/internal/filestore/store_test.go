@@ -0,0 +1,81 @@
+package filestore_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+)
+
+type testValue struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestStorePutGet(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+
+	const key = "schedules/G:123 ąę"
+	if err := store.Put(key, testValue{Name: "a", Count: 2}); err != nil {
+		t.Errorf("Failed to put value: %s", err)
+		return
+	}
+
+	got := testValue{}
+	ok, err := store.Get(key, &got)
+	if err != nil || !ok {
+		t.Errorf("Failed to get value, ok: %t, err: %v", ok, err)
+		return
+	}
+
+	if got.Name != "a" || got.Count != 2 {
+		t.Errorf("Got different value than stored: %+v", got)
+	}
+}
+
+func TestStoreGetMissing(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+
+	ok, err := store.Get("missing", &testValue{})
+	if err != nil || ok {
+		t.Errorf("Should report missing key without error, ok: %t, err: %v", ok, err)
+	}
+}
+
+func TestStoreKeysAndDelete(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+
+	for _, key := range []string{"a/1", "a/2", "b/1"} {
+		if err := store.Put(key, testValue{}); err != nil {
+			t.Errorf("Failed to put value: %s", err)
+			return
+		}
+	}
+
+	if err := store.Delete("a/1"); err != nil {
+		t.Errorf("Failed to delete value: %s", err)
+		return
+	}
+
+	keys, err := store.Keys("a/")
+	if err != nil {
+		t.Errorf("Failed to list keys: %s", err)
+		return
+	}
+
+	if !slices.Equal(keys, []string{"a/2"}) {
+		t.Errorf("Unexpected keys, got: %v, want: %v", keys, []string{"a/2"})
+	}
+}
@@ -0,0 +1,251 @@
+package freerooms
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const errPrefix = "freerooms: "
+
+var ErrIndexNotReady = errors.New(errPrefix + "index is not ready")
+var ErrOutOfIndexRange = errors.New(errPrefix + "interval is outside of indexed range")
+
+type Room struct {
+	Id       int    `json:"id"`
+	Name     string `json:"name"`
+	Building string `json:"building"`
+}
+
+type busyInterval struct {
+	start time.Time
+	end   time.Time
+}
+
+type indexedRoom struct {
+	Room
+	busyIntervals []busyInterval
+	// to is where busyIntervals end, rooms reused from a previous index are not known to be free after it
+	to time.Time
+}
+
+type index struct {
+	builtAt time.Time
+	from    time.Time
+	to      time.Time
+	rooms   []*indexedRoom
+}
+
+// Service keeps an index of room occupancy, refreshed in the background, so that finding free rooms does not require calling UEK
+type Service struct {
+	cfg         config.FreeRooms
+	uekSchedule *uekschedule.Client
+	logger      *slog.Logger
+	callParams  uekschedule.UEKCallParams
+	index       *index
+	indexMu     sync.RWMutex
+}
+
+func NewService(cfg config.FreeRooms, uekScheduleClient *uekschedule.Client, logger *slog.Logger) (*Service, error) {
+	if cfg.RefreshInterval <= 0 {
+		return nil, fmt.Errorf(errPrefix + "refresh interval should be greater than 0")
+	}
+
+	if cfg.DaysAhead < 0 {
+		return nil, fmt.Errorf(errPrefix + "days ahead should not be negative")
+	}
+
+	if cfg.Credentials == "" {
+		return nil, fmt.Errorf(errPrefix + "credentials are required to refresh the index")
+	}
+
+	return &Service{
+		cfg:         cfg,
+		uekSchedule: uekScheduleClient,
+		logger:      logger,
+		callParams: uekschedule.UEKCallParams{
+			BasicAuthHeaderValue: base64.StdEncoding.EncodeToString([]byte(cfg.Credentials)),
+		},
+	}, nil
+}
+
+// Run refreshes the index until ctx is canceled
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			s.logger.Error("Failed to refresh free rooms index", slog.Any("err", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh rebuilds the index, rooms whose schedules cannot be fetched keep their data from the previous index, and are only reported free within its range
+func (s *Service) Refresh(ctx context.Context) error {
+	now := time.Now().In(s.uekSchedule.Location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	newIndex := &index{
+		builtAt: now,
+		from:    today,
+		to:      today.AddDate(0, 0, s.cfg.DaysAhead+1),
+		rooms:   []*indexedRoom{},
+	}
+
+	rooms, err := s.getRooms(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.indexMu.RLock()
+	previousIndex := s.index
+	s.indexMu.RUnlock()
+
+	// schedules are fetched one at a time, so that the refresh does not take all UEK request slots from users
+	failedRoomCount := 0
+	for _, room := range rooms {
+		schedule, _, err := s.uekSchedule.GetScheduleInRange(ctx, s.callParams, uekschedule.ScheduleTypeRoom, room.Id, newIndex.from, newIndex.to)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			failedRoomCount++
+			s.logger.Warn("Failed to fetch room schedule for free rooms index", slog.Int("roomId", room.Id), slog.Any("err", err))
+			if previousRoom := previousIndex.findRoom(room.Id); previousRoom != nil {
+				newIndex.rooms = append(newIndex.rooms, previousRoom)
+			}
+			continue
+		}
+
+		newIndex.rooms = append(newIndex.rooms, createIndexedRoom(room, schedule.Items, newIndex.to))
+	}
+
+	s.indexMu.Lock()
+	s.index = newIndex
+	s.indexMu.Unlock()
+
+	s.logger.Debug("Refreshed free rooms index", slog.Int("roomCount", len(newIndex.rooms)), slog.Int("failedRoomCount", failedRoomCount), slog.String("timeTaken", time.Since(now).String()))
+	return nil
+}
+
+func (s *Service) getRooms(ctx context.Context) ([]Room, error) {
+	groupings, err := s.uekSchedule.GetGroupings(ctx, s.callParams)
+	if err != nil {
+		return nil, err
+	}
+
+	rooms := []Room{}
+	for _, grouping := range groupings {
+		if grouping.Type != uekschedule.ScheduleTypeRoom {
+			continue
+		}
+
+		headers, err := s.uekSchedule.GetHeaders(ctx, s.callParams, uekschedule.ScheduleTypeRoom, grouping.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, header := range headers {
+			if slices.ContainsFunc(rooms, func(room Room) bool {
+				return room.Id == header.Id
+			}) {
+				continue
+			}
+
+			rooms = append(rooms, Room{
+				Id:       header.Id,
+				Name:     header.Name,
+				Building: grouping.Name,
+			})
+		}
+	}
+
+	return rooms, nil
+}
+
+func createIndexedRoom(room Room, items []*uekschedule.ScheduleItem, to time.Time) *indexedRoom {
+	busyIntervals := make([]busyInterval, 0, len(items))
+	for _, item := range items {
+		if !item.OccupiesTime() {
+			continue
+		}
+
+		busyIntervals = append(busyIntervals, busyInterval{
+			start: item.Start,
+			end:   item.End,
+		})
+	}
+
+	return &indexedRoom{
+		Room:          room,
+		busyIntervals: busyIntervals,
+		to:            to,
+	}
+}
+
+func (idx *index) findRoom(roomId int) *indexedRoom {
+	if idx == nil {
+		return nil
+	}
+
+	for _, room := range idx.rooms {
+		if room.Id == roomId {
+			return room
+		}
+	}
+
+	return nil
+}
+
+// FindFreeRooms returns rooms with no classes overlapping [from, to), optionally only in the given building (case insensitive), along with the time the index was built
+func (s *Service) FindFreeRooms(from time.Time, to time.Time, building string) ([]Room, time.Time, error) {
+	s.indexMu.RLock()
+	currentIndex := s.index
+	s.indexMu.RUnlock()
+
+	if currentIndex == nil {
+		return nil, time.Time{}, ErrIndexNotReady
+	}
+
+	if from.Before(currentIndex.from) || to.After(currentIndex.to) {
+		return nil, time.Time{}, ErrOutOfIndexRange
+	}
+
+	freeRooms := []Room{}
+	for _, room := range currentIndex.rooms {
+		if (building != "" && !strings.EqualFold(room.Building, building)) || to.After(room.to) {
+			continue
+		}
+
+		if slices.ContainsFunc(room.busyIntervals, func(interval busyInterval) bool {
+			return interval.start.Before(to) && interval.end.After(from)
+		}) {
+			continue
+		}
+
+		freeRooms = append(freeRooms, room.Room)
+	}
+
+	slices.SortFunc(freeRooms, func(a Room, b Room) int {
+		return cmp.Or(strings.Compare(a.Building, b.Building), strings.Compare(a.Name, b.Name))
+	})
+
+	return freeRooms, currentIndex.builtAt, nil
+}
@@ -0,0 +1,130 @@
+package freerooms_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/freerooms"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+// roomsRoundTripper serves groupings, headers and room schedules, with classes on the given day
+type roomsRoundTripper struct {
+	day time.Time
+}
+
+func (rt *roomsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	queryParams := req.URL.Query()
+	periods := fmt.Sprintf(`<okres od="%s" do="%s"/>`, rt.day.AddDate(0, 0, -30).Format(time.DateOnly), rt.day.AddDate(0, 0, 60).Format(time.DateOnly))
+	createItem := func(from string, to string, itemType string) string {
+		return fmt.Sprintf(`<zajecia><termin>%s</termin><od-godz>%s</od-godz><do-godz>%s</do-godz><przedmiot>Algebra</przedmiot><typ>%s</typ></zajecia>`, rt.day.Format(time.DateOnly), from, to, itemType)
+	}
+
+	var body string
+	switch {
+	case queryParams.Get("id") == "1":
+		body = `<plan-zajec typ="S" id="1" nazwa="Paw. A 101">` + periods + createItem("08:00", "09:30", "wykład") + `</plan-zajec>`
+	case queryParams.Get("id") == "2":
+		body = `<plan-zajec typ="S" id="2" nazwa="Paw. A 102">` + periods + createItem("10:00", "11:30", "ćwiczenia") + `</plan-zajec>`
+	case queryParams.Get("id") == "3":
+		body = `<plan-zajec typ="S" id="3" nazwa="Bud. Główny 1">` + periods + createItem("08:00", "09:30", "przeniesienie zajęć") + `</plan-zajec>`
+	case queryParams.Get("grupa") == "Paw. A":
+		body = `<plan-zajec><zasob typ="S" id="1" nazwa="Paw. A 101"/><zasob typ="S" id="2" nazwa="Paw. A 102"/></plan-zajec>`
+	case queryParams.Get("grupa") == "Bud. Główny":
+		body = `<plan-zajec><zasob typ="S" id="3" nazwa="Bud. Główny 1"/></plan-zajec>`
+	default:
+		body = `<plan-zajec><grupowanie typ="S" grupa="Paw. A"/><grupowanie typ="S" grupa="Bud. Główny"/><grupowanie typ="G" grupa="Group"/></plan-zajec>`
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func TestFindFreeRooms(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Errorf("Failed to load location: %s", err)
+		return
+	}
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	uekClient, err := uekschedule.NewClient(&http.Client{Transport: &roomsRoundTripper{day: today}}, slog.New(slog.DiscardHandler), config.UEK{
+		MaxConcurrentRequests: 1,
+	}, nil, nil, nil)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	if _, err := freerooms.NewService(config.FreeRooms{
+		RefreshInterval: time.Hour,
+	}, uekClient, slog.New(slog.DiscardHandler)); err == nil {
+		t.Errorf("Expected an error when credentials are missing")
+		return
+	}
+
+	service, err := freerooms.NewService(config.FreeRooms{
+		Credentials:     "user:pass",
+		RefreshInterval: time.Hour,
+		DaysAhead:       7,
+	}, uekClient, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+
+	if _, _, err := service.FindFreeRooms(today, today.Add(time.Hour), ""); err != freerooms.ErrIndexNotReady {
+		t.Errorf("Unexpected error before refresh: %v", err)
+	}
+
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Errorf("Failed to refresh index: %s", err)
+		return
+	}
+
+	atHour := func(hour int) time.Time {
+		return time.Date(today.Year(), today.Month(), today.Day(), hour, 0, 0, 0, loc)
+	}
+
+	for _, testCase := range []struct {
+		fromHour  int
+		toHour    int
+		building  string
+		wantRooms []string
+	}{
+		{8, 9, "", []string{"Bud. Główny 1", "Paw. A 102"}},
+		{9, 10, "", []string{"Bud. Główny 1", "Paw. A 102"}},
+		{9, 11, "paw. a", []string{}},
+		{12, 13, "Paw. A", []string{"Paw. A 101", "Paw. A 102"}},
+	} {
+		rooms, _, err := service.FindFreeRooms(atHour(testCase.fromHour), atHour(testCase.toHour), testCase.building)
+		if err != nil {
+			t.Errorf("Failed to find free rooms: %s", err)
+			continue
+		}
+
+		gotRooms := []string{}
+		for _, room := range rooms {
+			gotRooms = append(gotRooms, room.Name)
+		}
+
+		if strings.Join(gotRooms, ",") != strings.Join(testCase.wantRooms, ",") {
+			t.Errorf("Unexpected free rooms for %d-%d %q, got: %v, want: %v", testCase.fromHour, testCase.toHour, testCase.building, gotRooms, testCase.wantRooms)
+		}
+	}
+
+	if _, _, err := service.FindFreeRooms(today.AddDate(0, 0, -1), today, ""); err != freerooms.ErrOutOfIndexRange {
+		t.Errorf("Unexpected error for interval before index range: %v", err)
+	}
+}
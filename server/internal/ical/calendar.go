@@ -0,0 +1,120 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const errPrefix = "ical: "
+
+const utcTimestampFormat = "20060102T150405Z"
+const localTimestampFormat = "20060102T150405"
+
+type Calendar struct {
+	ProductId string
+	Name      string
+	// TimeZone is used for event start and end times, if nil they are written in UTC
+	TimeZone *TimeZone
+	Events   []*Event
+}
+
+type Event struct {
+	UID          string
+	Sequence     int
+	Stamp        time.Time
+	LastModified time.Time
+	Start        time.Time
+	End          time.Time
+	Summary      string
+	Description  string
+	Location     string
+	Categories   []string
+	Organizer    *Organizer
+}
+
+type Organizer struct {
+	CommonName string
+	// Address is a URI, usually with mailto scheme
+	Address string
+}
+
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	clw := &contentLineWriter{
+		w: bufio.NewWriter(w),
+	}
+
+	clw.writeLine("BEGIN:VCALENDAR")
+	clw.writeProperty("VERSION", "2.0")
+	clw.writeTextProperty("PRODID", c.ProductId)
+	clw.writeProperty("CALSCALE", "GREGORIAN")
+	if c.Name != "" {
+		clw.writeTextProperty("NAME", c.Name)
+		clw.writeTextProperty("X-WR-CALNAME", c.Name)
+	}
+	if c.TimeZone != nil {
+		clw.writeTextProperty("X-WR-TIMEZONE", c.TimeZone.ID())
+		c.TimeZone.write(clw)
+	}
+
+	for _, event := range c.Events {
+		event.write(clw, c.TimeZone)
+	}
+
+	clw.writeLine("END:VCALENDAR")
+
+	if clw.err == nil {
+		clw.err = clw.w.Flush()
+	}
+
+	return clw.n, clw.err
+}
+
+func (e *Event) write(clw *contentLineWriter, tz *TimeZone) {
+	clw.writeLine("BEGIN:VEVENT")
+	clw.writeTextProperty("UID", e.UID)
+	clw.writeProperty("SEQUENCE", strconv.Itoa(e.Sequence))
+	clw.writeProperty("DTSTAMP", formatUTCTimestamp(e.Stamp))
+	if !e.LastModified.IsZero() {
+		clw.writeProperty("LAST-MODIFIED", formatUTCTimestamp(e.LastModified))
+	}
+	writeDateTimeProperty(clw, "DTSTART", e.Start, tz)
+	writeDateTimeProperty(clw, "DTEND", e.End, tz)
+	clw.writeTextProperty("SUMMARY", e.Summary)
+	if e.Description != "" {
+		clw.writeTextProperty("DESCRIPTION", e.Description)
+	}
+	if e.Organizer != nil {
+		if e.Organizer.CommonName != "" {
+			clw.writeProperty("ORGANIZER", e.Organizer.Address, "CN", e.Organizer.CommonName)
+		} else {
+			clw.writeProperty("ORGANIZER", e.Organizer.Address)
+		}
+	}
+	if e.Location != "" {
+		clw.writeTextProperty("LOCATION", e.Location)
+	}
+	if len(e.Categories) > 0 {
+		escapedCategories := make([]string, 0, len(e.Categories))
+		for _, category := range e.Categories {
+			escapedCategories = append(escapedCategories, escapeText(category))
+		}
+		clw.writeProperty("CATEGORIES", strings.Join(escapedCategories, ","))
+	}
+	clw.writeLine("END:VEVENT")
+}
+
+func writeDateTimeProperty(clw *contentLineWriter, name string, t time.Time, tz *TimeZone) {
+	if tz == nil {
+		clw.writeProperty(name, formatUTCTimestamp(t))
+		return
+	}
+
+	clw.writeProperty(name, t.In(tz.Location).Format(localTimestampFormat), "TZID", tz.ID())
+}
+
+func formatUTCTimestamp(t time.Time) string {
+	return t.UTC().Format(utcTimestampFormat)
+}
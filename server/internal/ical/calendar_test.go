@@ -0,0 +1,153 @@
+package ical_test
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/ical"
+)
+
+var updateGoldenFiles = flag.Bool("update", false, "update golden files")
+
+func createTestCalendar(tz *ical.TimeZone) (*ical.Calendar, error) {
+	loc, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		return nil, err
+	}
+
+	stamp := time.Date(2025, time.October, 1, 12, 0, 0, 0, time.UTC)
+
+	return &ical.Calendar{
+		ProductId: "-//UEK-PLANZAJEC-V4//PL",
+		Name:      "(UEK) ZIISS1-3312, Grupa; B",
+		TimeZone:  tz,
+		Events: []*ical.Event{
+			{
+				UID:          "3f0a8c3e@uek-planzajec-v4",
+				Sequence:     2,
+				Stamp:        stamp,
+				LastModified: stamp.Add(-time.Hour),
+				Start:        time.Date(2025, time.October, 6, 9, 45, 0, 0, loc),
+				End:          time.Date(2025, time.October, 6, 11, 15, 0, 0, loc),
+				Summary:      "[!] [wykład] Zarządzanie, organizacja; etyka\\prawo",
+				Description:  "Zajęcia odwołane\n\nhttps://teams.microsoft.com/l/meetup-join/19%3ameeting_ZmQ2ZTBkMGUtYjE4Zi00ZjQ5LWJmYjUtZTg5NWE0ZjYxYzA2%40thread.v2/0",
+				Location:     "Online",
+				Categories:   []string{"wykład", "a,b"},
+				Organizer: &ical.Organizer{
+					CommonName: `dr Jan "Janek" Kowalski, prof. UEK`,
+					Address:    "mailto:unknown@invalid.invalid",
+				},
+			},
+			{
+				UID:     "b71c2d94@uek-planzajec-v4",
+				Stamp:   stamp,
+				Start:   time.Date(2025, time.December, 1, 8, 0, 0, 0, loc),
+				End:     time.Date(2025, time.December, 1, 9, 30, 0, 0, loc),
+				Summary: "[ćwiczenia] Źdźbło żółwia gęśli jaźń ąęśćżźńół ĄĘŚĆŻŹŃÓŁ ąęśćżźńół ĄĘŚĆŻŹŃÓŁ ąęśćżźńół",
+			},
+		},
+	}, nil
+}
+
+func assertGolden(t *testing.T, goldenFileName string, got []byte) {
+	goldenFilePath := filepath.Join("testdata", goldenFileName)
+
+	if *updateGoldenFiles {
+		if err := os.WriteFile(goldenFilePath, got, 0644); err != nil {
+			t.Errorf("Failed to update golden file: %s", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(goldenFilePath)
+	if err != nil {
+		t.Errorf("Failed to read golden file: %s", err)
+		return
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("Output does not match golden file %s, got:\n%s\nwant:\n%s", goldenFileName, got, want)
+	}
+}
+
+func TestCalendarWriteToWithTimeZone(t *testing.T) {
+	tz, err := ical.NewEuropeWarsawTimeZone()
+	if err != nil {
+		t.Errorf("Failed to create time zone: %s", err)
+		return
+	}
+
+	calendar, err := createTestCalendar(tz)
+	if err != nil {
+		t.Errorf("Failed to create calendar: %s", err)
+		return
+	}
+
+	buff := &bytes.Buffer{}
+	n, err := calendar.WriteTo(buff)
+	if err != nil {
+		t.Errorf("Failed to write calendar: %s", err)
+		return
+	}
+
+	if n != int64(buff.Len()) {
+		t.Errorf("Returned byte count does not match written bytes, got: %d, want: %d", n, buff.Len())
+	}
+
+	assertGolden(t, "calendar_timezone.golden.ics", buff.Bytes())
+}
+
+func TestCalendarWriteToUTC(t *testing.T) {
+	calendar, err := createTestCalendar(nil)
+	if err != nil {
+		t.Errorf("Failed to create calendar: %s", err)
+		return
+	}
+
+	buff := &bytes.Buffer{}
+	if _, err := calendar.WriteTo(buff); err != nil {
+		t.Errorf("Failed to write calendar: %s", err)
+		return
+	}
+
+	assertGolden(t, "calendar_utc.golden.ics", buff.Bytes())
+}
+
+func TestCalendarWriteToContentLines(t *testing.T) {
+	calendar, err := createTestCalendar(nil)
+	if err != nil {
+		t.Errorf("Failed to create calendar: %s", err)
+		return
+	}
+
+	buff := &bytes.Buffer{}
+	if _, err := calendar.WriteTo(buff); err != nil {
+		t.Errorf("Failed to write calendar: %s", err)
+		return
+	}
+
+	output := buff.String()
+	if !strings.HasSuffix(output, "\r\n") {
+		t.Error("Output does not end with CRLF")
+	}
+
+	for i, line := range strings.Split(strings.TrimSuffix(output, "\r\n"), "\r\n") {
+		if strings.ContainsAny(line, "\r\n") {
+			t.Errorf("Line %d contains a bare line break: %q", i, line)
+		}
+
+		if len(line) > 75 {
+			t.Errorf("Line %d is longer than 75 octets, got: %d", i, len(line))
+		}
+
+		if !utf8.ValidString(line) {
+			t.Errorf("Line %d splits a multi-byte character: %q", i, line)
+		}
+	}
+}
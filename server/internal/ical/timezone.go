@@ -0,0 +1,68 @@
+package ical
+
+import (
+	"fmt"
+	"time"
+)
+
+type TimeZone struct {
+	Location    *time.Location
+	observances []timeZoneObservance
+}
+
+type timeZoneObservance struct {
+	kind       string
+	name       string
+	offsetFrom string
+	offsetTo   string
+	start      string
+	rrule      string
+}
+
+func NewEuropeWarsawTimeZone() (*TimeZone, error) {
+	loc, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		return nil, fmt.Errorf(errPrefix+"failed to load timezone data: %w", err)
+	}
+
+	return &TimeZone{
+		Location: loc,
+		observances: []timeZoneObservance{
+			{
+				kind:       "DAYLIGHT",
+				name:       "CEST",
+				offsetFrom: "+0100",
+				offsetTo:   "+0200",
+				start:      "19700329T020000",
+				rrule:      "FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU",
+			},
+			{
+				kind:       "STANDARD",
+				name:       "CET",
+				offsetFrom: "+0200",
+				offsetTo:   "+0100",
+				start:      "19701025T030000",
+				rrule:      "FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU",
+			},
+		},
+	}, nil
+}
+
+func (tz *TimeZone) ID() string {
+	return tz.Location.String()
+}
+
+func (tz *TimeZone) write(clw *contentLineWriter) {
+	clw.writeLine("BEGIN:VTIMEZONE")
+	clw.writeProperty("TZID", tz.ID())
+	for _, observance := range tz.observances {
+		clw.writeLine("BEGIN:" + observance.kind)
+		clw.writeProperty("TZOFFSETFROM", observance.offsetFrom)
+		clw.writeProperty("TZOFFSETTO", observance.offsetTo)
+		clw.writeProperty("TZNAME", observance.name)
+		clw.writeProperty("DTSTART", observance.start)
+		clw.writeProperty("RRULE", observance.rrule)
+		clw.writeLine("END:" + observance.kind)
+	}
+	clw.writeLine("END:VTIMEZONE")
+}
@@ -0,0 +1,94 @@
+package ical
+
+import (
+	"bufio"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxContentLineOctets = 75
+
+// contentLineWriter writes RFC 5545 content lines, folding them at 75 octets without splitting multi-byte characters
+type contentLineWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (clw *contentLineWriter) writeRaw(s string) {
+	if clw.err != nil {
+		return
+	}
+
+	n, err := clw.w.WriteString(s)
+	clw.n += int64(n)
+	clw.err = err
+}
+
+func (clw *contentLineWriter) writeLine(line string) {
+	lineOctets := 0
+	for len(line) > 0 {
+		_, runeSize := utf8.DecodeRuneInString(line)
+		if lineOctets+runeSize > maxContentLineOctets {
+			clw.writeRaw("\r\n ")
+			// the leading space of a continuation line counts towards its length
+			lineOctets = 1
+		}
+
+		clw.writeRaw(line[:runeSize])
+		lineOctets += runeSize
+		line = line[runeSize:]
+	}
+	clw.writeRaw("\r\n")
+}
+
+func (clw *contentLineWriter) writeProperty(name string, value string, params ...string) {
+	lineBuilder := strings.Builder{}
+	lineBuilder.WriteString(name)
+	for i := 0; i+1 < len(params); i += 2 {
+		lineBuilder.WriteByte(';')
+		lineBuilder.WriteString(params[i])
+		lineBuilder.WriteByte('=')
+		lineBuilder.WriteString(formatParamValue(params[i+1]))
+	}
+	lineBuilder.WriteByte(':')
+	lineBuilder.WriteString(value)
+
+	clw.writeLine(lineBuilder.String())
+}
+
+func (clw *contentLineWriter) writeTextProperty(name string, value string, params ...string) {
+	clw.writeProperty(name, escapeText(value), params...)
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", "",
+)
+
+func escapeText(value string) string {
+	return textEscaper.Replace(value)
+}
+
+// param values cannot contain DQUOTE or control characters at all, and must be quoted if they contain any of ":;,"
+func formatParamValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		if r == '"' {
+			return '\''
+		}
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+
+	if strings.ContainsAny(value, ":;,") {
+		return `"` + value + `"`
+	}
+
+	return value
+}
@@ -0,0 +1,384 @@
+package icalsubscription
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/authtoken"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const errPrefix = "icalsubscription: "
+
+const storeKeyPrefix = "ical-subscriptions/"
+
+// slugByteCount makes slugs unguessable, since anyone knowing a slug can read the calendar
+const slugByteCount = 12
+
+var ErrInvalidSubscription = errors.New(errPrefix + "invalid subscription")
+var ErrSubscriptionNotFound = errors.New(errPrefix + "subscription not found")
+var ErrTooManySubscriptions = errors.New(errPrefix + "too many subscriptions")
+
+// ErrSubscriptionExpired is returned when the token of the subscription expired or was revoked, updating the subscription issues a new one
+var ErrSubscriptionExpired = errors.New(errPrefix + "subscription expired")
+
+// Params are what the calendar of a subscription shows, the period is resolved when the calendar is fetched
+type Params struct {
+	ScheduleKeys   []uekschedule.ScheduleKey   `json:"scheduleKeys"`
+	PeriodIdx      int                         `json:"periodIdx"`
+	From           string                      `json:"from,omitempty"`
+	To             string                      `json:"to,omitempty"`
+	DaysBack       *int                        `json:"daysBack,omitempty"`
+	DaysAhead      *int                        `json:"daysAhead,omitempty"`
+	HiddenSubjects []string                    `json:"hiddenSubjects"`
+	Filter         uekschedule.ItemFilterRules `json:"filter"`
+}
+
+type Subscription struct {
+	Slug      string
+	Params    Params
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type storedSubscription struct {
+	Slug string `json:"slug"`
+	// OwnerHash is the keyed hash of the UEK login of the owner, which stays the same when the owner changes their password
+	OwnerHash string `json:"ownerHash"`
+	// EncryptedPayload holds the token and params, hidden subjects say enough about a student to be kept secret too
+	EncryptedPayload string    `json:"encryptedPayload"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// payload holds an iCal token rather than credentials, so that subscriptions expire and can be revoked like any other token
+type payload struct {
+	Token  string `json:"token"`
+	Params Params `json:"params"`
+}
+
+// Service keeps a registry of iCal subscriptions, so that subscription urls can be short and free of credentials
+type Service struct {
+	cfg        config.ICalSubscriptions
+	encryption *encryption.Service
+	tokens     *authtoken.Service
+	store      *filestore.Store
+	logger     *slog.Logger
+	mu         sync.Mutex
+}
+
+func NewService(cfg config.ICalSubscriptions, encryptionService *encryption.Service, tokenService *authtoken.Service, store *filestore.Store, logger *slog.Logger) (*Service, error) {
+	if cfg.MaxSubscriptionsPerUser < 1 {
+		return nil, fmt.Errorf(errPrefix + "max subscriptions per user should be greater than 0")
+	}
+
+	return &Service{
+		cfg:        cfg,
+		encryption: encryptionService,
+		tokens:     tokenService,
+		store:      store,
+		logger:     logger,
+	}, nil
+}
+
+func (s *Service) CreateSubscription(basicAuthValue string, params Params) (*Subscription, error) {
+	if len(params.ScheduleKeys) == 0 {
+		return nil, ErrInvalidSubscription
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ownerHash, err := s.encryption.HashOwner(basicAuthValue)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidSubscription, err)
+	}
+
+	existingSubscriptions, err := s.getOwnerSubscriptions(basicAuthValue)
+	if err != nil {
+		return nil, err
+	}
+	if len(existingSubscriptions) >= s.cfg.MaxSubscriptionsPerUser {
+		return nil, ErrTooManySubscriptions
+	}
+
+	slugBuff := make([]byte, slugByteCount)
+	if _, err := rand.Read(slugBuff); err != nil {
+		return nil, fmt.Errorf(errPrefix+"failed to generate slug: %w", err)
+	}
+
+	now := time.Now()
+	token, claims, err := s.tokens.Issue(basicAuthValue, authtoken.AudienceICal, now)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription := &storedSubscription{
+		Slug:      base64.RawURLEncoding.EncodeToString(slugBuff),
+		OwnerHash: ownerHash,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.put(subscription, basicAuthValue, &payload{Token: token, Params: params}); err != nil {
+		return nil, err
+	}
+
+	return &Subscription{
+		Slug:      subscription.Slug,
+		Params:    params,
+		CreatedAt: subscription.CreatedAt,
+		UpdatedAt: subscription.UpdatedAt,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+// UpdateSubscription also replaces the token with a new one for the given credentials,
+// so that owners can fix subscriptions after changing their password, and renew expired ones
+func (s *Service) UpdateSubscription(basicAuthValue string, slug string, params Params) (*Subscription, error) {
+	if len(params.ScheduleKeys) == 0 {
+		return nil, ErrInvalidSubscription
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscription, err := s.getOwnerSubscription(basicAuthValue, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	previousPayload, err := s.decryptPayload(subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	token, claims, err := s.tokens.Issue(basicAuthValue, authtoken.AudienceICal, now)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription.UpdatedAt = now
+	if err := s.put(subscription, basicAuthValue, &payload{Token: token, Params: params}); err != nil {
+		return nil, err
+	}
+	s.revokeToken(previousPayload.Token, now)
+
+	return &Subscription{
+		Slug:      subscription.Slug,
+		Params:    params,
+		CreatedAt: subscription.CreatedAt,
+		UpdatedAt: subscription.UpdatedAt,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+func (s *Service) ListSubscriptions(basicAuthValue string) ([]*Subscription, error) {
+	storedSubscriptions, err := s.getOwnerSubscriptions(basicAuthValue)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := make([]*Subscription, 0, len(storedSubscriptions))
+	for _, storedSubscription := range storedSubscriptions {
+		p, err := s.decryptPayload(storedSubscription)
+		if err != nil {
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, &Subscription{
+			Slug:      storedSubscription.Slug,
+			Params:    p.Params,
+			CreatedAt: storedSubscription.CreatedAt,
+			UpdatedAt: storedSubscription.UpdatedAt,
+			ExpiresAt: s.getTokenExpiresAt(p.Token),
+		})
+	}
+
+	slices.SortFunc(subscriptions, func(a *Subscription, b *Subscription) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return subscriptions, nil
+}
+
+func (s *Service) DeleteSubscription(basicAuthValue string, slug string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscription, err := s.getOwnerSubscription(basicAuthValue, slug)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.Delete(storeKeyPrefix + slug); err != nil {
+		return err
+	}
+
+	// copies of the payload, e.g. in backups, should not be usable either
+	if p, err := s.decryptPayload(subscription); err == nil {
+		s.revokeToken(p.Token, time.Now())
+	}
+
+	return nil
+}
+
+// GetSubscription returns the subscription with credentials of its owner, for serving its calendar
+func (s *Service) GetSubscription(slug string) (*Subscription, string, error) {
+	subscription, err := s.get(slug)
+	if err != nil {
+		return nil, "", err
+	}
+
+	p, err := s.decryptPayload(subscription)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	basicAuthValue, _, err := s.tokens.Verify(p.Token, authtoken.AudienceICal, now)
+	if err != nil {
+		if errors.Is(err, authtoken.ErrTokenExpired) || errors.Is(err, authtoken.ErrTokenRevoked) {
+			return nil, "", ErrSubscriptionExpired
+		}
+		return nil, "", fmt.Errorf(errPrefix+"failed to verify token: %w", err)
+	}
+
+	// payloads, tokens and owner hashes are moved to the active key as they are used, so that previous keys can eventually be dropped
+	if !s.encryption.IsEncryptedWithActiveKey(subscription.EncryptedPayload) || !s.encryption.IsOwnerHashedWithActiveKey(subscription.OwnerHash) {
+		if !s.encryption.IsEncryptedWithActiveKey(p.Token) {
+			// the token keeps its expiry
+			if p.Token, err = s.tokens.Reencrypt(p.Token, now); err != nil {
+				return nil, "", fmt.Errorf(errPrefix+"failed to re-encrypt token: %w", err)
+			}
+		}
+
+		s.mu.Lock()
+		if current, err := s.get(slug); err == nil && current.EncryptedPayload == subscription.EncryptedPayload {
+			if err := s.put(current, basicAuthValue, &payload{Token: p.Token, Params: p.Params}); err != nil {
+				s.logger.Warn("Failed to update ICal subscription", slog.String("slug", slug), slog.Any("err", err))
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	return &Subscription{
+		Slug:      subscription.Slug,
+		Params:    p.Params,
+		CreatedAt: subscription.CreatedAt,
+		UpdatedAt: subscription.UpdatedAt,
+		ExpiresAt: s.getTokenExpiresAt(p.Token),
+	}, basicAuthValue, nil
+}
+
+func (s *Service) get(slug string) (*storedSubscription, error) {
+	if slugBuff, err := base64.RawURLEncoding.DecodeString(slug); err != nil || len(slugBuff) != slugByteCount {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	subscription := &storedSubscription{}
+	ok, err := s.store.Get(storeKeyPrefix+slug, subscription)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	return subscription, nil
+}
+
+func (s *Service) getOwnerSubscription(basicAuthValue string, slug string) (*storedSubscription, error) {
+	subscription, err := s.get(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.encryption.IsOwner(subscription.OwnerHash, basicAuthValue) {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	return subscription, nil
+}
+
+func (s *Service) getOwnerSubscriptions(basicAuthValue string) ([]*storedSubscription, error) {
+	keys, err := s.store.Keys(storeKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := []*storedSubscription{}
+	for _, key := range keys {
+		subscription := &storedSubscription{}
+		if ok, err := s.store.Get(key, subscription); err != nil {
+			return nil, err
+		} else if ok && s.encryption.IsOwner(subscription.OwnerHash, basicAuthValue) {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+
+	return subscriptions, nil
+}
+
+// put stores p, basicAuthValue is only used to hash the owner again if needed
+func (s *Service) put(subscription *storedSubscription, basicAuthValue string, p *payload) error {
+	if !s.encryption.IsOwnerHashedWithActiveKey(subscription.OwnerHash) {
+		ownerHash, err := s.encryption.HashOwner(basicAuthValue)
+		if err != nil {
+			return errors.Join(ErrInvalidSubscription, err)
+		}
+		subscription.OwnerHash = ownerHash
+	}
+
+	payloadBuff, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf(errPrefix+"failed to encode payload: %w", err)
+	}
+
+	if subscription.EncryptedPayload, err = s.encryption.EncryptText(string(payloadBuff)); err != nil {
+		return fmt.Errorf(errPrefix+"failed to encrypt payload: %w", err)
+	}
+
+	return s.store.Put(storeKeyPrefix+subscription.Slug, subscription)
+}
+
+// revokeToken is best effort, tokens expire anyway
+func (s *Service) revokeToken(token string, now time.Time) {
+	if err := s.tokens.Revoke(token, now); err != nil && !errors.Is(err, authtoken.ErrTokenExpired) && !errors.Is(err, authtoken.ErrTokenRevoked) {
+		s.logger.Warn("Failed to revoke ICal subscription token", slog.Any("err", err))
+	}
+}
+
+// getTokenExpiresAt is zero if the token cannot be decrypted, verifying it would also fail
+func (s *Service) getTokenExpiresAt(token string) time.Time {
+	if _, claims, err := s.encryption.DecryptToken(token); err == nil && claims.ExpiresAt != 0 {
+		return time.Unix(claims.ExpiresAt, 0)
+	}
+
+	return time.Time{}
+}
+
+func (s *Service) decryptPayload(subscription *storedSubscription) (*payload, error) {
+	payloadText, err := s.encryption.DecryptText(subscription.EncryptedPayload)
+	if err != nil {
+		return nil, fmt.Errorf(errPrefix+"failed to decrypt payload: %w", err)
+	}
+
+	p := &payload{}
+	if err := json.Unmarshal([]byte(payloadText), p); err != nil {
+		return nil, fmt.Errorf(errPrefix+"failed to decode payload: %w", err)
+	}
+
+	return p, nil
+}
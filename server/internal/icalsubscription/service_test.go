@@ -0,0 +1,210 @@
+package icalsubscription_test
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/authtoken"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/bufferutil"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/icalsubscription"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const ownerBasicAuthValue = "b3duZXI6cGFzcw=="
+const otherBasicAuthValue = "b3RoZXI6cGFzcw=="
+
+// the owner after changing their password
+const ownerNewPasswordBasicAuthValue = "b3duZXI6bmV3cGFzcw=="
+
+var testParams = icalsubscription.Params{
+	ScheduleKeys: []uekschedule.ScheduleKey{
+		{Type: uekschedule.ScheduleTypeGroup, Id: 1},
+	},
+	HiddenSubjects: []string{"Wychowanie fizyczne"},
+}
+
+var testTokensConfig = config.Tokens{
+	APITTL:  time.Hour,
+	ICalTTL: 24 * time.Hour,
+}
+
+func createTestService(store *filestore.Store, tokensCfg config.Tokens, encryptionKey encryption.Key, decryptionKeys ...encryption.Key) (*icalsubscription.Service, error) {
+	encryptionService, err := encryption.NewService(encryptionKey, decryptionKeys, bufferutil.NewBufferPool(8*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	tokenService, err := authtoken.NewService(tokensCfg, encryptionService, store, slog.New(slog.DiscardHandler))
+	if err != nil {
+		return nil, err
+	}
+
+	return icalsubscription.NewService(config.ICalSubscriptions{
+		Enabled:                 true,
+		MaxSubscriptionsPerUser: 2,
+	}, encryptionService, tokenService, store, slog.New(slog.DiscardHandler))
+}
+
+var testKey1 = encryption.Key{Id: "1", Value: []byte("g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI="), OwnerHashValue: []byte("owner-g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI=")}
+var testKey2 = encryption.Key{Id: "2", Value: []byte("0N35xLl1ve1nWJHI/g0ZH6qmSSVPSik="), OwnerHashValue: []byte("owner-0N35xLl1ve1nWJHI/g0ZH6qmSSVPSik=")}
+
+func TestServiceSubscriptionLifecycle(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+	service, err := createTestService(store, testTokensConfig, testKey1)
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+
+	subscription, err := service.CreateSubscription(ownerBasicAuthValue, testParams)
+	if err != nil {
+		t.Errorf("Failed to create subscription: %s", err)
+		return
+	}
+
+	if len(subscription.Slug) != 16 {
+		t.Errorf("Expected a 16 character slug, got: %s", subscription.Slug)
+		return
+	}
+
+	gotSubscription, basicAuthValue, err := service.GetSubscription(subscription.Slug)
+	if err != nil {
+		t.Errorf("Failed to get subscription: %s", err)
+		return
+	}
+	if basicAuthValue != ownerBasicAuthValue || !slices.Equal(gotSubscription.Params.HiddenSubjects, testParams.HiddenSubjects) {
+		t.Errorf("Got subscription does not match created one, got: %s %+v", basicAuthValue, gotSubscription.Params)
+		return
+	}
+
+	if _, err := service.UpdateSubscription(otherBasicAuthValue, subscription.Slug, testParams); !errors.Is(err, icalsubscription.ErrSubscriptionNotFound) {
+		t.Errorf("Only the owner should be able to update a subscription, got: %v", err)
+		return
+	}
+
+	if err := service.DeleteSubscription(otherBasicAuthValue, subscription.Slug); !errors.Is(err, icalsubscription.ErrSubscriptionNotFound) {
+		t.Errorf("Only the owner should be able to delete a subscription, got: %v", err)
+		return
+	}
+
+	updatedParams := testParams
+	updatedParams.HiddenSubjects = nil
+	if _, err := service.UpdateSubscription(ownerNewPasswordBasicAuthValue, subscription.Slug, updatedParams); err != nil {
+		t.Errorf("Owner should be able to update the subscription after changing their password: %s", err)
+		return
+	}
+
+	if _, basicAuthValue, err := service.GetSubscription(subscription.Slug); err != nil || basicAuthValue != ownerNewPasswordBasicAuthValue {
+		t.Errorf("Update should have replaced stored credentials, got: %s %v", basicAuthValue, err)
+		return
+	}
+
+	if subscriptions, err := service.ListSubscriptions(ownerBasicAuthValue); err != nil || len(subscriptions) != 1 || len(subscriptions[0].Params.HiddenSubjects) != 0 {
+		t.Errorf("Expected the updated subscription to be listed, got: %v %v", subscriptions, err)
+		return
+	}
+
+	if subscriptions, err := service.ListSubscriptions(otherBasicAuthValue); err != nil || len(subscriptions) != 0 {
+		t.Errorf("Subscriptions of other users should not be listed, got: %v %v", subscriptions, err)
+		return
+	}
+
+	if _, err := service.CreateSubscription(ownerBasicAuthValue, testParams); err != nil {
+		t.Errorf("Failed to create second subscription: %s", err)
+		return
+	}
+	if _, err := service.CreateSubscription(ownerBasicAuthValue, testParams); !errors.Is(err, icalsubscription.ErrTooManySubscriptions) {
+		t.Errorf("Expected ErrTooManySubscriptions, got: %v", err)
+		return
+	}
+
+	if err := service.DeleteSubscription(ownerBasicAuthValue, subscription.Slug); err != nil {
+		t.Errorf("Failed to delete subscription: %s", err)
+		return
+	}
+
+	if _, _, err := service.GetSubscription(subscription.Slug); !errors.Is(err, icalsubscription.ErrSubscriptionNotFound) {
+		t.Errorf("Expected ErrSubscriptionNotFound after delete, got: %v", err)
+		return
+	}
+}
+
+func TestServiceReencryptsWithActiveKey(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+
+	oldService, err := createTestService(store, testTokensConfig, testKey1)
+	if err != nil {
+		t.Errorf("Failed to create old service: %s", err)
+		return
+	}
+
+	rotatedService, err := createTestService(store, testTokensConfig, testKey2, testKey1)
+	if err != nil {
+		t.Errorf("Failed to create service with rotated key: %s", err)
+		return
+	}
+
+	newService, err := createTestService(store, testTokensConfig, testKey2)
+	if err != nil {
+		t.Errorf("Failed to create new service: %s", err)
+		return
+	}
+
+	subscription, err := oldService.CreateSubscription(ownerBasicAuthValue, testParams)
+	if err != nil {
+		t.Errorf("Failed to create subscription: %s", err)
+		return
+	}
+
+	if _, _, err := rotatedService.GetSubscription(subscription.Slug); err != nil {
+		t.Errorf("Failed to get subscription after key rotation: %s", err)
+		return
+	}
+
+	// the previous key is no longer needed after the subscription was used once
+	if _, basicAuthValue, err := newService.GetSubscription(subscription.Slug); err != nil || basicAuthValue != ownerBasicAuthValue {
+		t.Errorf("Subscription should have been re-encrypted with the active key, got: %s %v", basicAuthValue, err)
+		return
+	}
+}
+
+func TestServiceSubscriptionExpires(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+
+	tokensCfg := testTokensConfig
+	tokensCfg.ICalTTL = time.Nanosecond
+	service, err := createTestService(store, tokensCfg, testKey1)
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+
+	subscription, err := service.CreateSubscription(ownerBasicAuthValue, testParams)
+	if err != nil {
+		t.Errorf("Failed to create subscription: %s", err)
+		return
+	}
+
+	if _, _, err := service.GetSubscription(subscription.Slug); !errors.Is(err, icalsubscription.ErrSubscriptionExpired) {
+		t.Errorf("Expected ErrSubscriptionExpired once the token expired, got: %v", err)
+		return
+	}
+}
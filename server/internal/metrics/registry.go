@@ -0,0 +1,294 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	metricTypeCounter   = "counter"
+	metricTypeGauge     = "gauge"
+	metricTypeHistogram = "histogram"
+)
+
+// DurationBuckets are histogram buckets in seconds, suitable for both local handlers and calls to UEK
+var DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Registry collects metrics and writes them in the Prometheus text exposition format. A nil registry creates nil metrics, which ignore all updates
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+type family struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]*series
+}
+
+type series struct {
+	labelValues  []string
+	value        float64
+	valueFunc    func() float64
+	bucketCounts []uint64
+	count        uint64
+}
+
+func (r *Registry) register(name string, help string, metricType string, buckets []float64, labelNames []string) *family {
+	f := &family{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     map[string]*series{},
+	}
+
+	r.mu.Lock()
+	r.families = append(r.families, f)
+	r.mu.Unlock()
+
+	return f
+}
+
+// getSeries has to be called with mu held
+func (f *family) getSeries(labelValues []string) *series {
+	// label values are not expected to contain \xff, it is not valid utf-8
+	key := strings.Join(labelValues, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{
+			labelValues: slices.Clone(labelValues),
+		}
+		if f.metricType == metricTypeHistogram {
+			s.bucketCounts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+
+	return s
+}
+
+type Counter struct {
+	family *family
+}
+
+func (r *Registry) NewCounter(name string, help string, labelNames ...string) *Counter {
+	if r == nil {
+		return nil
+	}
+
+	return &Counter{
+		family: r.register(name, help, metricTypeCounter, nil, labelNames),
+	}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+
+	c.family.mu.Lock()
+	c.family.getSeries(labelValues).value += delta
+	c.family.mu.Unlock()
+}
+
+// SetFunc makes the counter read its value from valueFunc on every scrape, for counters kept by code which does not know about metrics
+func (c *Counter) SetFunc(valueFunc func() float64, labelValues ...string) {
+	if c == nil {
+		return
+	}
+
+	c.family.mu.Lock()
+	c.family.getSeries(labelValues).valueFunc = valueFunc
+	c.family.mu.Unlock()
+}
+
+type Gauge struct {
+	family *family
+}
+
+func (r *Registry) NewGauge(name string, help string, labelNames ...string) *Gauge {
+	if r == nil {
+		return nil
+	}
+
+	return &Gauge{
+		family: r.register(name, help, metricTypeGauge, nil, labelNames),
+	}
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+
+	g.family.mu.Lock()
+	g.family.getSeries(labelValues).value = value
+	g.family.mu.Unlock()
+}
+
+// SetFunc makes the gauge read its value from valueFunc on every scrape
+func (g *Gauge) SetFunc(valueFunc func() float64, labelValues ...string) {
+	if g == nil {
+		return
+	}
+
+	g.family.mu.Lock()
+	g.family.getSeries(labelValues).valueFunc = valueFunc
+	g.family.mu.Unlock()
+}
+
+type Histogram struct {
+	family *family
+}
+
+// buckets are upper bounds in ascending order, the +Inf bucket is added automatically
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	if r == nil {
+		return nil
+	}
+
+	return &Histogram{
+		family: r.register(name, help, metricTypeHistogram, buckets, labelNames),
+	}
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	if h == nil {
+		return
+	}
+
+	h.family.mu.Lock()
+	defer h.family.mu.Unlock()
+
+	s := h.family.getSeries(labelValues)
+	if bucketIdx, _ := slices.BinarySearch(h.family.buckets, value); bucketIdx < len(s.bucketCounts) {
+		s.bucketCounts[bucketIdx]++
+	}
+	s.value += value
+	s.count++
+}
+
+// Write writes all metrics in the order they were created, with series sorted by label values
+func (r *Registry) Write(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	families := slices.Clone(r.families)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+func (f *family) write(bw *bufio.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bw.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+	bw.WriteString("# TYPE " + f.name + " " + f.metricType + "\n")
+
+	seriesList := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		seriesList = append(seriesList, s)
+	}
+	slices.SortFunc(seriesList, func(a *series, b *series) int {
+		return slices.Compare(a.labelValues, b.labelValues)
+	})
+
+	for _, s := range seriesList {
+		if f.metricType != metricTypeHistogram {
+			value := s.value
+			if s.valueFunc != nil {
+				value = s.valueFunc()
+			}
+			writeSample(bw, f.name, f.labelNames, s.labelValues, "", "", value)
+			continue
+		}
+
+		cumulativeCount := uint64(0)
+		for i, bucket := range f.buckets {
+			cumulativeCount += s.bucketCounts[i]
+			writeSample(bw, f.name+"_bucket", f.labelNames, s.labelValues, "le", formatFloat(bucket), float64(cumulativeCount))
+		}
+		writeSample(bw, f.name+"_bucket", f.labelNames, s.labelValues, "le", "+Inf", float64(s.count))
+		writeSample(bw, f.name+"_sum", f.labelNames, s.labelValues, "", "", s.value)
+		writeSample(bw, f.name+"_count", f.labelNames, s.labelValues, "", "", float64(s.count))
+	}
+}
+
+func writeSample(bw *bufio.Writer, name string, labelNames []string, labelValues []string, extraLabelName string, extraLabelValue string, value float64) {
+	bw.WriteString(name)
+
+	if len(labelNames) > 0 || extraLabelName != "" {
+		bw.WriteByte('{')
+		for i, labelName := range labelNames {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			labelValue := ""
+			if i < len(labelValues) {
+				labelValue = labelValues[i]
+			}
+			bw.WriteString(labelName + `="` + escapeLabelValue(labelValue) + `"`)
+		}
+		if extraLabelName != "" {
+			if len(labelNames) > 0 {
+				bw.WriteByte(',')
+			}
+			bw.WriteString(extraLabelName + `="` + extraLabelValue + `"`)
+		}
+		bw.WriteByte('}')
+	}
+
+	bw.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(labelValue string) string {
+	return labelValueEscaper.Replace(labelValue)
+}
@@ -0,0 +1,63 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/metrics"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	requests := registry.NewCounter("test_requests_total", "Requests.", "route", "code")
+	requests.Inc("GET /b", "200")
+	requests.Inc("GET /a", "200")
+	requests.Add(2, "GET /a", "200")
+
+	registry.NewGauge("test_queued", "Queued \"requests\".").SetFunc(func() float64 {
+		return 3
+	})
+
+	duration := registry.NewHistogram("test_duration_seconds", "Duration.", []float64{0.1, 1}, "route")
+	duration.Observe(0.05, `GET /"quoted"`)
+	duration.Observe(1, `GET /"quoted"`)
+	duration.Observe(5, `GET /"quoted"`)
+
+	sb := &strings.Builder{}
+	if err := registry.Write(sb); err != nil {
+		t.Errorf("Failed to write metrics: %s", err)
+		return
+	}
+
+	expected := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{route="GET /a",code="200"} 3
+test_requests_total{route="GET /b",code="200"} 1
+# HELP test_queued Queued "requests".
+# TYPE test_queued gauge
+test_queued 3
+# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="GET /\"quoted\"",le="0.1"} 1
+test_duration_seconds_bucket{route="GET /\"quoted\"",le="1"} 2
+test_duration_seconds_bucket{route="GET /\"quoted\"",le="+Inf"} 3
+test_duration_seconds_sum{route="GET /\"quoted\""} 6.05
+test_duration_seconds_count{route="GET /\"quoted\""} 3
+`
+	if sb.String() != expected {
+		t.Errorf("Unexpected output, got:\n%s\nwant:\n%s", sb.String(), expected)
+	}
+}
+
+func TestNilRegistryIgnoresUpdates(t *testing.T) {
+	var registry *metrics.Registry
+
+	registry.NewCounter("test_total", "Test.").Inc()
+	registry.NewGauge("test", "Test.").Set(1)
+	registry.NewHistogram("test_seconds", "Test.", metrics.DurationBuckets).Observe(1)
+
+	if err := registry.Write(&strings.Builder{}); err != nil {
+		t.Errorf("Failed to write metrics: %s", err)
+	}
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const errPrefix = "ratelimit: "
+
+// Limiter keeps a token bucket per key, each bucket holds up to burst tokens and refills at a constant rate
+type Limiter struct {
+	tokensPerSecond float64
+	burst           float64
+	maxKeys         int
+	mu              sync.Mutex
+	buckets         map[string]*bucket
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+func NewLimiter(requestsPerMinute int, burst int, maxKeys int) (*Limiter, error) {
+	if requestsPerMinute < 1 {
+		return nil, fmt.Errorf(errPrefix + "requests per minute should be greater than 0")
+	}
+
+	if burst < 1 {
+		return nil, fmt.Errorf(errPrefix + "burst should be greater than 0")
+	}
+
+	if maxKeys < 1 {
+		return nil, fmt.Errorf(errPrefix + "max keys should be greater than 0")
+	}
+
+	return &Limiter{
+		tokensPerSecond: float64(requestsPerMinute) / 60,
+		burst:           float64(burst),
+		maxKeys:         maxKeys,
+		buckets:         map[string]*bucket{},
+	}, nil
+}
+
+// Allow takes a token from the bucket of key, if it is empty, it returns how long until the next token
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.maxKeys {
+			l.evict(now)
+		}
+
+		b = &bucket{
+			tokens:    l.burst,
+			updatedAt: now,
+		}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.updatedAt); elapsed > 0 {
+		b.tokens = min(l.burst, b.tokens+elapsed.Seconds()*l.tokensPerSecond)
+		b.updatedAt = now
+	}
+
+	if b.tokens < 1 {
+		return false, time.Duration(math.Ceil((1 - b.tokens) / l.tokensPerSecond * float64(time.Second)))
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// evict removes buckets which have refilled, they are no different from new ones, and if that is not enough, the least recently used bucket
+func (l *Limiter) evict(now time.Time) {
+	var oldestKey string
+	var oldestBucket *bucket
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updatedAt).Seconds()*l.tokensPerSecond >= l.burst {
+			delete(l.buckets, key)
+			continue
+		}
+
+		if oldestBucket == nil || b.updatedAt.Before(oldestBucket.updatedAt) {
+			oldestKey = key
+			oldestBucket = b
+		}
+	}
+
+	if len(l.buckets) >= l.maxKeys && oldestBucket != nil {
+		delete(l.buckets, oldestKey)
+	}
+}
@@ -0,0 +1,63 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/ratelimit"
+)
+
+func TestLimiterAllowsBurstAndRefills(t *testing.T) {
+	limiter, err := ratelimit.NewLimiter(60, 3, 10)
+	if err != nil {
+		t.Errorf("Failed to create limiter: %s", err)
+		return
+	}
+
+	now := time.Date(2025, 10, 6, 8, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		if ok, _ := limiter.Allow("a", now); !ok {
+			t.Errorf("Request %d within burst was rejected", i)
+			return
+		}
+	}
+
+	ok, retryAfter := limiter.Allow("a", now)
+	if ok || retryAfter != time.Second {
+		t.Errorf("Unexpected result past burst, got: %t, %s", ok, retryAfter)
+	}
+
+	if ok, _ := limiter.Allow("b", now); !ok {
+		t.Errorf("Other key was rejected")
+	}
+
+	if ok, _ := limiter.Allow("a", now.Add(time.Second)); !ok {
+		t.Errorf("Refilled token was not available")
+	}
+	if ok, retryAfter := limiter.Allow("a", now.Add(1500*time.Millisecond)); ok || retryAfter != 500*time.Millisecond {
+		t.Errorf("Unexpected result before next refill, got: %t, %s", ok, retryAfter)
+	}
+}
+
+func TestLimiterEvictsKeys(t *testing.T) {
+	limiter, err := ratelimit.NewLimiter(60, 1, 2)
+	if err != nil {
+		t.Errorf("Failed to create limiter: %s", err)
+		return
+	}
+
+	now := time.Date(2025, 10, 6, 8, 0, 0, 0, time.UTC)
+	limiter.Allow("a", now)
+	limiter.Allow("b", now.Add(100*time.Millisecond))
+	limiter.Allow("c", now.Add(200*time.Millisecond))
+
+	// the least recently used key was evicted, so it starts with a full bucket again
+	if ok, _ := limiter.Allow("a", now.Add(300*time.Millisecond)); !ok {
+		t.Errorf("Evicted key was rejected")
+	}
+
+	// "b" was evicted to make room for "a", and "c" is still tracked
+	if ok, _ := limiter.Allow("c", now.Add(300*time.Millisecond)); ok {
+		t.Errorf("Tracked key was allowed past its burst")
+	}
+}
@@ -0,0 +1,72 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+var diacriticReplacer = strings.NewReplacer(
+	"ą", "a", "ć", "c", "ę", "e", "ł", "l", "ń", "n", "ó", "o", "ś", "s", "ź", "z", "ż", "z",
+	"á", "a", "ä", "a", "č", "c", "é", "e", "ě", "e", "í", "i", "ö", "o", "ř", "r", "š", "s", "ú", "u", "ü", "u", "ý", "y", "ž", "z",
+)
+
+// normalize lowercases text and strips diacritics, so that users do not have to type polish characters
+func normalize(text string) string {
+	return diacriticReplacer.Replace(strings.ToLower(text))
+}
+
+// tokenize splits normalized text into words, punctuation like "Paw." or "dr hab." is not significant
+func tokenize(text string) []string {
+	return strings.FieldsFunc(normalize(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// editDistance is the optimal string alignment distance, it gives up and returns maxDistance+1 once the distance is known to exceed maxDistance
+func editDistance(a []rune, b []rune, maxDistance int) int {
+	if abs(len(a)-len(b)) > maxDistance {
+		return maxDistance + 1
+	}
+
+	previousPreviousRow := make([]int, len(b)+1)
+	previousRow := make([]int, len(b)+1)
+	currentRow := make([]int, len(b)+1)
+	for j := range previousRow {
+		previousRow[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		currentRow[0] = i
+		rowMin := currentRow[0]
+
+		for j := 1; j <= len(b); j++ {
+			substitutionCost := 1
+			if a[i-1] == b[j-1] {
+				substitutionCost = 0
+			}
+
+			currentRow[j] = min(previousRow[j]+1, currentRow[j-1]+1, previousRow[j-1]+substitutionCost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				currentRow[j] = min(currentRow[j], previousPreviousRow[j-2]+1)
+			}
+
+			rowMin = min(rowMin, currentRow[j])
+		}
+
+		if rowMin > maxDistance {
+			return maxDistance + 1
+		}
+
+		previousPreviousRow, previousRow, currentRow = previousRow, currentRow, previousPreviousRow
+	}
+
+	return previousRow[len(b)]
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
@@ -0,0 +1,247 @@
+package search
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const errPrefix = "search: "
+
+var ErrIndexNotReady = errors.New(errPrefix + "index is not ready")
+
+type Result struct {
+	uekschedule.ScheduleHeader
+	Grouping string `json:"grouping"`
+}
+
+type indexEntry struct {
+	result         Result
+	nameTokens     [][]rune
+	groupingTokens [][]rune
+}
+
+type index struct {
+	builtAt time.Time
+	entries []*indexEntry
+}
+
+// Service keeps a search index of schedule headers of all types, refreshed in the background
+type Service struct {
+	cfg         config.Search
+	uekSchedule *uekschedule.Client
+	logger      *slog.Logger
+	callParams  uekschedule.UEKCallParams
+	index       *index
+	indexMu     sync.RWMutex
+}
+
+func NewService(cfg config.Search, uekScheduleClient *uekschedule.Client, logger *slog.Logger) (*Service, error) {
+	if cfg.RefreshInterval <= 0 {
+		return nil, fmt.Errorf(errPrefix + "refresh interval should be greater than 0")
+	}
+
+	if cfg.Credentials == "" {
+		return nil, fmt.Errorf(errPrefix + "credentials are required to refresh the index")
+	}
+
+	return &Service{
+		cfg:         cfg,
+		uekSchedule: uekScheduleClient,
+		logger:      logger,
+		callParams: uekschedule.UEKCallParams{
+			BasicAuthHeaderValue: base64.StdEncoding.EncodeToString([]byte(cfg.Credentials)),
+		},
+	}, nil
+}
+
+// Run refreshes the index until ctx is canceled
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			s.logger.Error("Failed to refresh search index", slog.Any("err", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh rebuilds the index, the previous one is kept if any grouping fails to load
+func (s *Service) Refresh(ctx context.Context) error {
+	startTime := time.Now()
+
+	groupings, err := s.uekSchedule.GetGroupings(ctx, s.callParams)
+	if err != nil {
+		return err
+	}
+
+	newIndex := &index{
+		builtAt: startTime,
+		entries: []*indexEntry{},
+	}
+	seenScheduleKeys := map[uekschedule.ScheduleKey]struct{}{}
+
+	// headers are fetched one at a time, so that the refresh does not take all UEK request slots from users
+	for _, grouping := range groupings {
+		headers, err := s.uekSchedule.GetHeaders(ctx, s.callParams, grouping.Type, grouping.Name)
+		if err != nil {
+			return err
+		}
+
+		groupingTokens := createRuneTokens(grouping.Name)
+		for _, header := range headers {
+			scheduleKey := uekschedule.ScheduleKey{Type: header.Type, Id: header.Id}
+			if _, ok := seenScheduleKeys[scheduleKey]; ok {
+				continue
+			}
+			seenScheduleKeys[scheduleKey] = struct{}{}
+
+			newIndex.entries = append(newIndex.entries, &indexEntry{
+				result: Result{
+					ScheduleHeader: header,
+					Grouping:       grouping.Name,
+				},
+				nameTokens:     createRuneTokens(header.Name),
+				groupingTokens: groupingTokens,
+			})
+		}
+	}
+
+	s.indexMu.Lock()
+	s.index = newIndex
+	s.indexMu.Unlock()
+
+	s.logger.Debug("Refreshed search index", slog.Int("entryCount", len(newIndex.entries)), slog.String("timeTaken", time.Since(startTime).String()))
+	return nil
+}
+
+func createRuneTokens(text string) [][]rune {
+	tokens := tokenize(text)
+	runeTokens := make([][]rune, 0, len(tokens))
+	for _, token := range tokens {
+		runeTokens = append(runeTokens, []rune(token))
+	}
+
+	return runeTokens
+}
+
+// Search returns up to limit headers matching every word of the query, optionally only of the given type, best matches first
+func (s *Service) Search(query string, scheduleType uekschedule.ScheduleType, limit int) ([]Result, error) {
+	s.indexMu.RLock()
+	currentIndex := s.index
+	s.indexMu.RUnlock()
+
+	if currentIndex == nil {
+		return nil, ErrIndexNotReady
+	}
+
+	queryTokens := createRuneTokens(query)
+	if len(queryTokens) == 0 {
+		return []Result{}, nil
+	}
+
+	type scoredResult struct {
+		result Result
+		score  int
+	}
+	scoredResults := []scoredResult{}
+
+	for _, entry := range currentIndex.entries {
+		if scheduleType != "" && entry.result.Type != scheduleType {
+			continue
+		}
+
+		if score := entry.score(queryTokens); score > 0 {
+			scoredResults = append(scoredResults, scoredResult{
+				result: entry.result,
+				score:  score,
+			})
+		}
+	}
+
+	slices.SortFunc(scoredResults, func(a scoredResult, b scoredResult) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), cmp.Compare(len(a.result.Name), len(b.result.Name)), strings.Compare(a.result.Name, b.result.Name))
+	})
+
+	results := make([]Result, 0, min(limit, len(scoredResults)))
+	for _, scoredResult := range scoredResults[:min(limit, len(scoredResults))] {
+		results = append(results, scoredResult.result)
+	}
+
+	return results, nil
+}
+
+// score is 0 if any of the query tokens does not match, matches on grouping names are worth less than on header names
+func (entry *indexEntry) score(queryTokens [][]rune) int {
+	totalScore := 0
+	for _, queryToken := range queryTokens {
+		tokenScore := 0
+		for _, nameToken := range entry.nameTokens {
+			tokenScore = max(tokenScore, scoreToken(queryToken, nameToken))
+		}
+		for _, groupingToken := range entry.groupingTokens {
+			tokenScore = max(tokenScore, scoreToken(queryToken, groupingToken)/2)
+		}
+
+		if tokenScore == 0 {
+			return 0
+		}
+		totalScore += tokenScore
+	}
+
+	return totalScore
+}
+
+func scoreToken(queryToken []rune, token []rune) int {
+	if slices.Equal(queryToken, token) {
+		return 100
+	}
+
+	if len(queryToken) <= len(token) && slices.Equal(queryToken, token[:len(queryToken)]) {
+		return 80
+	}
+
+	if len(queryToken) >= 3 && strings.Contains(string(token), string(queryToken)) {
+		return 50
+	}
+
+	// typos are only tolerated in longer words, short ones would match almost anything, and not in numbers, where a typo is a different group or room
+	maxDistance := 0
+	if len(queryToken) >= 8 {
+		maxDistance = 2
+	} else if len(queryToken) >= 4 {
+		maxDistance = 1
+	}
+	if maxDistance == 0 || slices.ContainsFunc(queryToken, unicode.IsDigit) {
+		return 0
+	}
+
+	distance := editDistance(queryToken, token, maxDistance)
+	// the query may be an unfinished word, so it is also compared with the beginning of the token
+	if len(token) > len(queryToken) {
+		distance = min(distance, editDistance(queryToken, token[:len(queryToken)], maxDistance))
+	}
+	if distance > maxDistance {
+		return 0
+	}
+
+	return 40 - 10*distance
+}
@@ -0,0 +1,107 @@
+package search_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/search"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+var testResponses = map[string]string{
+	"":                        `<plan-zajec><grupowanie typ="G" grupa="Informatyka Stosowana"/><grupowanie typ="N" grupa="Katedra Informatyki"/><grupowanie typ="S" grupa="Paw. A"/></plan-zajec>`,
+	"G:Informatyka Stosowana": `<plan-zajec><zasob typ="G" id="1" nazwa="ZIISS1-1111"/><zasob typ="G" id="2" nazwa="ZIISS1-1112"/></plan-zajec>`,
+	"N:Katedra Informatyki":   `<plan-zajec><zasob typ="N" id="11" nazwa="dr Paweł Łukasiewicz"/><zasob typ="N" id="12" nazwa="prof. dr hab. Żaneta Wiśniewska"/></plan-zajec>`,
+	"S:Paw. A":                `<plan-zajec><zasob typ="S" id="21" nazwa="Paw. A 101"/><zasob typ="S" id="22" nazwa="Paw. A 102"/></plan-zajec>`,
+}
+
+type headersRoundTripper struct{}
+
+func (rt headersRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	queryParams := req.URL.Query()
+	key := ""
+	if queryParams.Has("typ") {
+		key = queryParams.Get("typ") + ":" + queryParams.Get("grupa")
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(testResponses[key])),
+	}, nil
+}
+
+func TestSearch(t *testing.T) {
+	uekClient, err := uekschedule.NewClient(&http.Client{Transport: headersRoundTripper{}}, slog.New(slog.DiscardHandler), config.UEK{
+		MaxConcurrentRequests: 1,
+	}, nil, nil, nil)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	if _, err := search.NewService(config.Search{
+		RefreshInterval: time.Hour,
+	}, uekClient, slog.New(slog.DiscardHandler)); err == nil {
+		t.Errorf("Expected an error when credentials are missing")
+		return
+	}
+
+	service, err := search.NewService(config.Search{
+		Credentials:     "user:pass",
+		RefreshInterval: time.Hour,
+	}, uekClient, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+
+	if _, err := service.Search("test", "", 10); err != search.ErrIndexNotReady {
+		t.Errorf("Unexpected error before refresh: %v", err)
+	}
+
+	if err := service.Refresh(context.Background()); err != nil {
+		t.Errorf("Failed to refresh index: %s", err)
+		return
+	}
+
+	for _, testCase := range []struct {
+		query        string
+		scheduleType uekschedule.ScheduleType
+		wantIds      []int
+	}{
+		// diacritics
+		{"lukasiewicz", "", []int{11}},
+		{"ŻANETA", "", []int{12}},
+		// typos and unfinished words
+		{"lukasiewich", "", []int{11}},
+		{"wisnieska zan", "", []int{12}},
+		// grouping names are searchable too
+		{"informatyka", uekschedule.ScheduleTypeLecturer, []int{11, 12}},
+		{"ziiss1-1112", "", []int{2}},
+		{"paw a", uekschedule.ScheduleTypeRoom, []int{21, 22}},
+		{"a 102", "", []int{22}},
+		{"xyz", "", []int{}},
+	} {
+		results, err := service.Search(testCase.query, testCase.scheduleType, 10)
+		if err != nil {
+			t.Errorf("Failed to search for %q: %s", testCase.query, err)
+			continue
+		}
+
+		gotIds := []int{}
+		for _, result := range results {
+			gotIds = append(gotIds, result.Id)
+		}
+
+		if len(gotIds) != len(testCase.wantIds) || (len(gotIds) > 0 && gotIds[0] != testCase.wantIds[0]) {
+			t.Errorf("Unexpected results for %q, got: %v, want: %v", testCase.query, gotIds, testCase.wantIds)
+		}
+	}
+}
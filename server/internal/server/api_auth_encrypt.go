@@ -1,20 +1,97 @@
 package server
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/authtoken"
 )
 
+// handleRequestAuthEncryptBasicAuth issues a token for the API and one for iCal subscription URLs, tokens cannot be used to get new tokens, so that a leaked one stops working when it expires
 func (srv *Server) handleRequestAuthEncryptBasicAuth(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
-	encryptedBasicAuthValue, err := srv.encryption.EncryptText(basicAuthValue)
+	if authScheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " "); authScheme != "Basic" {
+		respondUnauthorized(w)
+		return
+	}
+
+	now := time.Now()
+	token, claims, err := srv.tokens.Issue(basicAuthValue, authtoken.AudienceAPI, now)
+	if err != nil {
+		srv.logger.ErrorContext(r.Context(), "Failed to issue token", slog.Any("err", err))
+		respondInternalServerError(w)
+		return
+	}
+
+	icalToken, icalClaims, err := srv.tokens.Issue(basicAuthValue, authtoken.AudienceICal, now)
 	if err != nil {
-		respondBadRequest(w)
+		srv.logger.ErrorContext(r.Context(), "Failed to issue token", slog.Any("err", err))
+		respondInternalServerError(w)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
+	respondJSON(w, struct {
+		Token         string    `json:"token"`
+		ExpiresAt     time.Time `json:"expiresAt"`
+		ICalToken     string    `json:"icalToken"`
+		ICalExpiresAt time.Time `json:"icalExpiresAt"`
+	}{
+		Token:         token,
+		ExpiresAt:     time.Unix(claims.ExpiresAt, 0).UTC(),
+		ICalToken:     icalToken,
+		ICalExpiresAt: time.Unix(icalClaims.ExpiresAt, 0).UTC(),
+	})
+}
+
+// handleRequestAuthReencryptToken re-encrypts a Bearer token with the active key, so that clients can replace tokens before the key they were encrypted with is dropped
+func (srv *Server) handleRequestAuthReencryptToken(w http.ResponseWriter, r *http.Request) {
+	authScheme, authValue, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if authScheme != "Bearer" {
+		respondUnauthorized(w)
+		return
+	}
+
+	reencryptedToken, err := srv.tokens.Reencrypt(authValue, time.Now())
+	if err != nil {
+		respondUnauthorized(w)
+		return
+	}
+
 	respondJSON(w, struct {
 		Token string `json:"token"`
 	}{
-		Token: encryptedBasicAuthValue,
+		Token: reencryptedToken,
 	})
 }
+
+// handleRequestAuthRevokeToken revokes the Bearer token of any audience, so that users can invalidate leaked iCal subscription URLs
+func (srv *Server) handleRequestAuthRevokeToken(w http.ResponseWriter, r *http.Request) {
+	authScheme, authValue, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if authScheme != "Bearer" {
+		respondUnauthorized(w)
+		return
+	}
+
+	if err := srv.tokens.Revoke(authValue, time.Now()); err != nil {
+		switch {
+		case errors.Is(err, authtoken.ErrLegacyToken):
+			respondProblem(w, problemDetails{
+				Type:   problemTypePrefix + "legacy-token",
+				Title:  "Legacy token",
+				Status: http.StatusBadRequest,
+				Detail: "Tokens issued before tokens could be revoked cannot be revoked, log in again to get a new token",
+			})
+		case errors.Is(err, authtoken.ErrInvalidToken), errors.Is(err, authtoken.ErrTokenExpired), errors.Is(err, authtoken.ErrTokenRevoked):
+			respondUnauthorized(w)
+		default:
+			srv.logger.ErrorContext(r.Context(), "Failed to revoke token", slog.Any("err", err))
+			respondInternalServerError(w)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
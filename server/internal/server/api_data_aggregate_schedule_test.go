@@ -0,0 +1,51 @@
+package server_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+func TestAggregateScheduleFilter(t *testing.T) {
+	srv, err := createTestICalSubscriptionServer(t.TempDir(), fakeUEKRoundTripper{})
+	if err != nil {
+		t.Errorf("Failed to create server: %s", err)
+		return
+	}
+
+	requestAggregateSchedule := func(filter string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/data/aggregate-schedule?schedule=G:1&periodIdx=0&filter="+url.QueryEscape(filter), nil)
+		req.SetBasicAuth("user", "pass")
+		res := httptest.NewRecorder()
+		srv.ServeHTTP(res, req)
+		return res
+	}
+
+	res := requestAggregateSchedule(`{"exclude":[{"subject":"algebra","type":"wykład"}]}`)
+	if res.Code != http.StatusOK {
+		t.Errorf("Unexpected status code, got: %d, want: %d, body: %s", res.Code, http.StatusOK, res.Body.String())
+		return
+	}
+
+	body := struct {
+		AggregateSchedule uekschedule.AggregateSchedule `json:"aggregateSchedule"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Errorf("Failed to decode aggregate schedule: %s", err)
+		return
+	}
+
+	if items := body.AggregateSchedule.Items; len(items) != 1 || items[0].Subject != "Statystyka" {
+		t.Errorf("Only the lecture of Algebra should have been filtered out, got: %+v", items)
+		return
+	}
+
+	if res := requestAggregateSchedule(`{"exclude":[{}]}`); res.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status code for invalid filter, got: %d, want: %d", res.Code, http.StatusBadRequest)
+		return
+	}
+}
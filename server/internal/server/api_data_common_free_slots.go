@@ -0,0 +1,107 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const timeOfDayParamFormat = "15:04"
+
+const defaultFreeSlotDayStart = 8 * time.Hour
+const defaultFreeSlotDayEnd = 20 * time.Hour
+const defaultFreeSlotMinDuration = time.Hour
+
+func (srv *Server) handleRequestDataCommonFreeSlots(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
+	queryParams := r.URL.Query()
+	scheduleKeys, err := parseScheduleKeysFromQuery(queryParams)
+	if err != nil {
+		respondBadRequest(w)
+		return
+	}
+
+	periodSelection, err := srv.parsePeriodSelectionFromDates(strings.TrimSpace(queryParams.Get("from")), strings.TrimSpace(queryParams.Get("to")))
+	if err != nil {
+		respondBadRequest(w)
+		return
+	}
+
+	freeSlotParams := uekschedule.FreeSlotParams{
+		From:        periodSelection.From,
+		To:          periodSelection.To,
+		DayStart:    defaultFreeSlotDayStart,
+		DayEnd:      defaultFreeSlotDayEnd,
+		MinDuration: defaultFreeSlotMinDuration,
+		Location:    srv.uekSchedule.Location(),
+	}
+
+	if rawDayStart := strings.TrimSpace(queryParams.Get("dayStart")); rawDayStart != "" {
+		if freeSlotParams.DayStart, err = parseTimeOfDayParam(rawDayStart); err != nil {
+			respondBadRequest(w)
+			return
+		}
+	}
+
+	if rawDayEnd := strings.TrimSpace(queryParams.Get("dayEnd")); rawDayEnd != "" {
+		if freeSlotParams.DayEnd, err = parseTimeOfDayParam(rawDayEnd); err != nil {
+			respondBadRequest(w)
+			return
+		}
+	}
+
+	if rawMinMinutes := strings.TrimSpace(queryParams.Get("minMinutes")); rawMinMinutes != "" {
+		minMinutes, err := strconv.Atoi(rawMinMinutes)
+		if err != nil {
+			respondBadRequest(w)
+			return
+		}
+		freeSlotParams.MinDuration = time.Duration(minMinutes) * time.Minute
+	}
+
+	if err := freeSlotParams.Validate(); err != nil {
+		respondBadRequest(w)
+		return
+	}
+
+	// hidden classes do not take up time
+	itemFilter, err := parseItemFilterFromQuery(queryParams)
+	if err != nil {
+		respondBadRequest(w)
+		return
+	}
+
+	callParams := srv.createUEKCallParams(r, basicAuthValue)
+	aggregateSchedule, _, err := srv.uekSchedule.GetAggregateSchedule(r.Context(), callParams, scheduleKeys, periodSelection)
+	if err != nil {
+		srv.respondUEKError(w, r, err, "Failed to get aggregate schedule for common free slots", slog.Group("params", slog.Any("scheduleKeys", scheduleKeys), slog.Any("periodSelection", periodSelection)))
+		return
+	}
+	aggregateSchedule = aggregateSchedule.Filter(itemFilter)
+
+	setStalenessHeader(w, callParams.Staleness)
+	respondJSON(w, struct {
+		Headers []uekschedule.ScheduleHeader `json:"headers"`
+		Slots   []uekschedule.FreeSlot       `json:"slots"`
+	}{
+		Headers: aggregateSchedule.Headers,
+		Slots:   uekschedule.FindFreeSlots(aggregateSchedule.Items, freeSlotParams),
+	})
+}
+
+// parseTimeOfDayParam parses HH:MM as an offset from midnight, 24:00 is allowed as the end of day
+func parseTimeOfDayParam(rawValue string) (time.Duration, error) {
+	if rawValue == "24:00" {
+		return 24 * time.Hour, nil
+	}
+
+	timeOfDay, err := time.Parse(timeOfDayParamFormat, rawValue)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(timeOfDay.Hour())*time.Hour + time.Duration(timeOfDay.Minute())*time.Minute, nil
+}
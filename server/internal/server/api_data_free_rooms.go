@@ -0,0 +1,92 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/freerooms"
+)
+
+// localDateTimeParamFormat is interpreted in UEK time zone, so that clients do not have to know the offset
+const localDateTimeParamFormat = "2006-01-02T15:04"
+
+const defaultFreeRoomsDuration = 90 * time.Minute
+const maxFreeRoomsDuration = 24 * time.Hour
+
+func (srv *Server) handleRequestDataFreeRooms(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
+	if srv.freeRooms == nil {
+		respondNotFound(w)
+		return
+	}
+
+	queryParams := r.URL.Query()
+
+	from := time.Now()
+	if rawFrom := strings.TrimSpace(queryParams.Get("from")); rawFrom != "" {
+		var ok bool
+		if from, ok = srv.parseDateTimeParam(rawFrom); !ok {
+			respondBadRequest(w)
+			return
+		}
+	}
+
+	to := from.Add(defaultFreeRoomsDuration)
+	if rawTo := strings.TrimSpace(queryParams.Get("to")); rawTo != "" {
+		var ok bool
+		if to, ok = srv.parseDateTimeParam(rawTo); !ok {
+			respondBadRequest(w)
+			return
+		}
+	}
+
+	if !from.Before(to) || to.Sub(from) > maxFreeRoomsDuration {
+		respondBadRequest(w)
+		return
+	}
+
+	// the index is built with server credentials, so the caller has to prove they could access room schedules themselves
+	if !srv.verifyBasicAuth(w, r, basicAuthValue) {
+		return
+	}
+
+	building := strings.TrimSpace(queryParams.Get("building"))
+	rooms, indexedAt, err := srv.freeRooms.FindFreeRooms(from, to, building)
+	if err != nil {
+		if errors.Is(err, freerooms.ErrOutOfIndexRange) {
+			respondBadRequest(w)
+		} else if errors.Is(err, freerooms.ErrIndexNotReady) {
+			respondServiceUnavailable(w)
+		} else {
+			srv.logger.Error("Failed to find free rooms", slog.Group("params", slog.Time("from", from), slog.Time("to", to), slog.String("building", building)), slog.Any("err", err))
+			respondInternalServerError(w)
+		}
+		return
+	}
+
+	respondJSON(w, struct {
+		From      time.Time        `json:"from"`
+		To        time.Time        `json:"to"`
+		IndexedAt time.Time        `json:"indexedAt"`
+		Rooms     []freerooms.Room `json:"rooms"`
+	}{
+		From:      from.In(srv.uekSchedule.Location()),
+		To:        to.In(srv.uekSchedule.Location()),
+		IndexedAt: indexedAt,
+		Rooms:     rooms,
+	})
+}
+
+func (srv *Server) parseDateTimeParam(rawValue string) (time.Time, bool) {
+	if value, err := time.Parse(time.RFC3339, rawValue); err == nil {
+		return value, true
+	}
+
+	if value, err := time.ParseInLocation(localDateTimeParamFormat, rawValue, srv.uekSchedule.Location()); err == nil {
+		return value, true
+	}
+
+	return time.Time{}, false
+}
@@ -1,28 +1,17 @@
 package server
 
 import (
-	"context"
-	"errors"
-	"log/slog"
 	"net/http"
-
-	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
 )
 
 func (srv *Server) handleRequestDataGroupings(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
-	groupings, err := srv.uekSchedule.GetGroupings(r.Context(), uekschedule.UEKCallParams{
-		BasicAuthHeaderValue: basicAuthValue,
-		ForwaredForHeader:    getForwaredForWithLastHop(r),
-	})
+	callParams := srv.createUEKCallParams(r, basicAuthValue)
+	groupings, err := srv.uekSchedule.GetGroupings(r.Context(), callParams)
 	if err != nil {
-		if errors.Is(err, uekschedule.ErrUnauthorized) {
-			respondUnauthorized(w)
-		} else if !errors.Is(err, context.Canceled) {
-			srv.logger.Error("Failed to get groupings", slog.Any("err", err))
-			respondServiceUnavailable(w)
-		}
+		srv.respondUEKError(w, r, err, "Failed to get groupings")
 		return
 	}
 
+	setStalenessHeader(w, callParams.Staleness)
 	respondJSON(w, groupings)
 }
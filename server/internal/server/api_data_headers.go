@@ -1,8 +1,6 @@
 package server
 
 import (
-	"context"
-	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -19,19 +17,13 @@ func (srv *Server) handleRequestDataHeaders(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	headers, err := srv.uekSchedule.GetHeaders(r.Context(), uekschedule.UEKCallParams{
-		BasicAuthHeaderValue: basicAuthValue,
-		ForwaredForHeader:    getForwaredForWithLastHop(r),
-	}, scheduleType, groupingName)
+	callParams := srv.createUEKCallParams(r, basicAuthValue)
+	headers, err := srv.uekSchedule.GetHeaders(r.Context(), callParams, scheduleType, groupingName)
 	if err != nil {
-		if errors.Is(err, uekschedule.ErrUnauthorized) {
-			respondUnauthorized(w)
-		} else if !errors.Is(err, context.Canceled) {
-			srv.logger.Error("Failed to get headers", slog.Group("params", slog.String("scheduleType", string(scheduleType)), slog.String("groupingName", groupingName)), slog.Any("err", err))
-			respondServiceUnavailable(w)
-		}
+		srv.respondUEKError(w, r, err, "Failed to get headers", slog.Group("params", slog.String("scheduleType", string(scheduleType)), slog.String("groupingName", groupingName)))
 		return
 	}
 
+	setStalenessHeader(w, callParams.Staleness)
 	respondJSON(w, headers)
 }
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+func (srv *Server) handleRequestDataSchedule(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
+	queryParams := r.URL.Query()
+	scheduleType := uekschedule.ScheduleType(strings.TrimSpace(queryParams.Get("type")))
+	if !scheduleType.IsValid() {
+		respondBadRequest(w)
+		return
+	}
+
+	scheduleId, err := strconv.Atoi(strings.TrimSpace(queryParams.Get("id")))
+	if err != nil {
+		respondBadRequest(w)
+		return
+	}
+
+	periodIdx, err := strconv.Atoi(strings.TrimSpace(queryParams.Get("periodIdx")))
+	if err != nil || periodIdx < 0 {
+		respondBadRequest(w)
+		return
+	}
+
+	callParams := srv.createUEKCallParams(r, basicAuthValue)
+	schedule, periods, err := srv.uekSchedule.GetSchedule(r.Context(), callParams, scheduleType, scheduleId, periodIdx)
+	if err != nil {
+		srv.respondUEKError(w, r, err, "Failed to get schedule", slog.Group("params", slog.String("scheduleType", string(scheduleType)), slog.Int("scheduleId", scheduleId), slog.Int("periodIdx", periodIdx)))
+		return
+	}
+
+	setStalenessHeader(w, callParams.Staleness)
+	respondJSON(w, struct {
+		Schedule *uekschedule.Schedule        `json:"schedule"`
+		Periods  []uekschedule.SchedulePeriod `json:"periods"`
+	}{
+		Schedule: schedule,
+		Periods:  periods,
+	})
+}
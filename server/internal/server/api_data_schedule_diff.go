@@ -0,0 +1,51 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/snapshot"
+)
+
+func (srv *Server) handleRequestDataScheduleDiff(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
+	if srv.snapshots == nil {
+		respondNotFound(w)
+		return
+	}
+
+	queryParams := r.URL.Query()
+	scheduleKeys, err := parseScheduleKeysFromQuery(queryParams)
+	if err != nil || len(scheduleKeys) != 1 {
+		respondBadRequest(w)
+		return
+	}
+
+	var since time.Time
+	if rawSince := strings.TrimSpace(queryParams.Get("since")); rawSince != "" {
+		if since, err = time.Parse(time.RFC3339, rawSince); err != nil {
+			respondBadRequest(w)
+			return
+		}
+	}
+
+	// snapshots are taken with server credentials, so the caller has to prove they could access the schedule themselves
+	if !srv.verifyBasicAuth(w, r, basicAuthValue) {
+		return
+	}
+
+	diff, err := srv.snapshots.GetDiff(scheduleKeys[0], since)
+	if err != nil {
+		if errors.Is(err, snapshot.ErrNotTracked) {
+			respondNotFound(w)
+		} else {
+			srv.logger.Error("Failed to get schedule diff", slog.Group("params", slog.String("scheduleKey", scheduleKeys[0].String()), slog.Time("since", since)), slog.Any("err", err))
+			respondInternalServerError(w)
+		}
+		return
+	}
+
+	respondJSON(w, diff)
+}
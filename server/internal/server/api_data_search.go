@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/search"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const defaultSearchLimit = 20
+const maxSearchLimit = 100
+const maxSearchQueryLength = 100
+
+func (srv *Server) handleRequestDataSearch(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
+	if srv.search == nil {
+		respondNotFound(w)
+		return
+	}
+
+	queryParams := r.URL.Query()
+	query := strings.TrimSpace(queryParams.Get("q"))
+	if query == "" || len(query) > maxSearchQueryLength {
+		respondBadRequest(w)
+		return
+	}
+
+	scheduleType := uekschedule.ScheduleType(strings.TrimSpace(queryParams.Get("type")))
+	if scheduleType != "" && !scheduleType.IsValid() {
+		respondBadRequest(w)
+		return
+	}
+
+	limit := defaultSearchLimit
+	if rawLimit := strings.TrimSpace(queryParams.Get("limit")); rawLimit != "" {
+		var err error
+		if limit, err = strconv.Atoi(rawLimit); err != nil || limit < 1 || limit > maxSearchLimit {
+			respondBadRequest(w)
+			return
+		}
+	}
+
+	// the index is built with server credentials, so the caller has to prove they could list headers themselves
+	if !srv.verifyBasicAuth(w, r, basicAuthValue) {
+		return
+	}
+
+	results, err := srv.search.Search(query, scheduleType, limit)
+	if err != nil {
+		if errors.Is(err, search.ErrIndexNotReady) {
+			respondServiceUnavailable(w)
+		} else {
+			srv.logger.Error("Failed to search", slog.Group("params", slog.String("query", query), slog.String("scheduleType", string(scheduleType))), slog.Any("err", err))
+			respondInternalServerError(w)
+		}
+		return
+	}
+
+	respondJSON(w, results)
+}
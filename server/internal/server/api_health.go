@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+// readiness probes are answered from the last UEK probe for a while, so that frequent checks do not add load on UEK
+const readinessProbeTTL = 15 * time.Second
+const readinessProbeTimeout = 5 * time.Second
+
+type readinessProbe struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+type uekHealth struct {
+	Breaker uekschedule.BreakerStatus `json:"breaker"`
+	// Reachable is only set by the readiness check, which probes UEK
+	Reachable *bool `json:"reachable,omitempty"`
+}
+
+// handleRequestHealth always responds with 200, UEK being down does not make this server unhealthy
+func (srv *Server) handleRequestHealth(w http.ResponseWriter, r *http.Request) {
+	breakerStatus := srv.uekSchedule.BreakerStatus()
+
+	status := "ok"
+	if breakerStatus.State != uekschedule.BreakerStateClosed {
+		status = "degraded"
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, struct {
+		Status string    `json:"status"`
+		UEK    uekHealth `json:"uek"`
+	}{
+		Status: status,
+		UEK: uekHealth{
+			Breaker: breakerStatus,
+		},
+	})
+}
+
+// handleRequestHealthz is a liveness check, it only tells that the server is able to handle requests
+func (srv *Server) handleRequestHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte("ok\n"))
+}
+
+// handleRequestReadyz responds with 503 if UEK cannot be reached
+func (srv *Server) handleRequestReadyz(w http.ResponseWriter, r *http.Request) {
+	reachable := srv.probeUEK(r.Context()) == nil
+
+	status := "ready"
+	statusCode := http.StatusOK
+	if !reachable {
+		status = "not-ready"
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(struct {
+		Status string    `json:"status"`
+		UEK    uekHealth `json:"uek"`
+	}{
+		Status: status,
+		UEK: uekHealth{
+			Breaker:   srv.uekSchedule.BreakerStatus(),
+			Reachable: &reachable,
+		},
+	})
+}
+
+func (srv *Server) probeUEK(ctx context.Context) error {
+	srv.readinessProbe.mu.Lock()
+	defer srv.readinessProbe.mu.Unlock()
+
+	if time.Since(srv.readinessProbe.checkedAt) < readinessProbeTTL {
+		return srv.readinessProbe.err
+	}
+
+	probeCtx, cancelProbeCtx := context.WithTimeout(ctx, readinessProbeTimeout)
+	defer cancelProbeCtx()
+
+	err := srv.uekSchedule.Probe(probeCtx)
+	// a probe abandoned by the caller says nothing about UEK
+	if ctx.Err() != nil {
+		return err
+	}
+
+	if err != nil {
+		srv.logger.Warn("UEK readiness probe failed", slog.Any("err", err))
+	}
+
+	srv.readinessProbe.checkedAt = time.Now()
+	srv.readinessProbe.err = err
+	return err
+}
@@ -1,57 +1,136 @@
 package server
 
 import (
-	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"slices"
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/authtoken"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/ical"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/icalsubscription"
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
 )
 
-func (srv *Server) handleRequestICal(w http.ResponseWriter, r *http.Request) {
-	const icalTimestampFormat = "20060102T150405Z"
+const icalProductId = "-//UEK-PLANZAJEC-V4//PL"
 
+func (srv *Server) handleRequestICal(w http.ResponseWriter, r *http.Request) {
 	payload := struct {
-		AuthScheme     string                   `json:"authScheme"`
-		AuthValue      string                   `json:"authValue"`
-		ScheduleType   uekschedule.ScheduleType `json:"scheduleType"`
-		ScheduleIds    []int                    `json:"scheduleIds"`
-		PeriodIdx      int                      `json:"periodIdx"`
-		HiddenSubjects []string                 `json:"hiddenSubjects"`
+		AuthScheme     string                      `json:"authScheme"`
+		AuthValue      string                      `json:"authValue"`
+		ScheduleType   uekschedule.ScheduleType    `json:"scheduleType"`
+		ScheduleIds    []int                       `json:"scheduleIds"`
+		Schedules      []uekschedule.ScheduleKey   `json:"schedules"`
+		PeriodIdx      int                         `json:"periodIdx"`
+		From           string                      `json:"from"`
+		To             string                      `json:"to"`
+		DaysBack       *int                        `json:"daysBack"`
+		DaysAhead      *int                        `json:"daysAhead"`
+		HiddenSubjects []string                    `json:"hiddenSubjects"`
+		Filter         uekschedule.ItemFilterRules `json:"filter"`
 	}{}
-	if err := json.NewDecoder(base64.NewDecoder(base64.StdEncoding, strings.NewReader(r.PathValue("payload")))).Decode(&payload); err != nil || len(payload.ScheduleIds) == 0 || len(payload.ScheduleIds) > maxSchedulesPerRequest || !payload.ScheduleType.IsValid() {
+	if err := json.NewDecoder(base64.NewDecoder(base64.StdEncoding, strings.NewReader(r.PathValue("payload")))).Decode(&payload); err != nil {
 		respondBadRequest(w)
 		return
 	}
 
-	basicAuthValue := srv.extractBasicAuthValue(payload.AuthScheme, payload.AuthValue)
+	scheduleKeys := payload.Schedules
+	if len(payload.ScheduleIds) > 0 {
+		scheduleKeys = append(createScheduleKeys(payload.ScheduleType, payload.ScheduleIds), scheduleKeys...)
+	}
+
+	basicAuthValue := srv.extractBasicAuthValue(payload.AuthScheme, payload.AuthValue, authtoken.AudienceICal)
 	if basicAuthValue == "" {
 		respondUnauthorized(w)
 		return
 	}
 
-	aggregateSchedule, _, err := srv.uekSchedule.GetAggregateSchedule(r.Context(), uekschedule.UEKCallParams{
-		BasicAuthHeaderValue: basicAuthValue,
-		ForwaredForHeader:    getForwaredForWithLastHop(r),
-	}, payload.ScheduleType, payload.ScheduleIds, payload.PeriodIdx)
+	srv.respondICal(w, r, basicAuthValue, icalsubscription.Params{
+		ScheduleKeys:   scheduleKeys,
+		PeriodIdx:      payload.PeriodIdx,
+		From:           payload.From,
+		To:             payload.To,
+		DaysBack:       payload.DaysBack,
+		DaysAhead:      payload.DaysAhead,
+		HiddenSubjects: payload.HiddenSubjects,
+		Filter:         payload.Filter,
+	})
+}
+
+// handleRequestICalSubscription serves calendars of stored subscriptions, whose urls have nothing but a slug
+func (srv *Server) handleRequestICalSubscription(w http.ResponseWriter, r *http.Request) {
+	slug, ok := strings.CutSuffix(r.PathValue("file"), ".ics")
+	if !ok || srv.icalSubscriptions == nil {
+		respondNotFound(w)
+		return
+	}
+
+	subscription, basicAuthValue, err := srv.icalSubscriptions.GetSubscription(slug)
 	if err != nil {
-		if errors.Is(err, uekschedule.ErrUnauthorized) {
-			respondUnauthorized(w)
-		} else if !errors.Is(err, context.Canceled) {
-			srv.logger.Error("Failed to get aggregate schedule for ICal", slog.Group("params", slog.String("scheduleType", string(payload.ScheduleType)), slog.Any("scheduleIds", payload.ScheduleIds), slog.Int("periodIdx", payload.PeriodIdx)), slog.Any("err", err))
-			respondServiceUnavailable(w)
+		switch {
+		case errors.Is(err, icalsubscription.ErrSubscriptionNotFound):
+			respondNotFound(w)
+		case errors.Is(err, icalsubscription.ErrSubscriptionExpired):
+			respondStatusProblem(w, http.StatusGone)
+		default:
+			srv.logger.ErrorContext(r.Context(), "Failed to get ICal subscription", slog.Any("err", err))
+			respondInternalServerError(w)
 		}
 		return
 	}
 
+	srv.respondICal(w, r, basicAuthValue, subscription.Params)
+}
+
+func (srv *Server) createICalPeriodSelection(params icalsubscription.Params) (uekschedule.PeriodSelection, error) {
+	if params.DaysBack != nil || params.DaysAhead != nil {
+		return srv.createPeriodSelectionFromRollingWindow(ptrValueOrZero(params.DaysBack), ptrValueOrZero(params.DaysAhead))
+	}
+
+	if params.From != "" || params.To != "" {
+		return srv.parsePeriodSelectionFromDates(params.From, params.To)
+	}
+
+	return uekschedule.PeriodSelection{
+		PeriodIdx: params.PeriodIdx,
+	}, nil
+}
+
+func (srv *Server) respondICal(w http.ResponseWriter, r *http.Request, basicAuthValue string, params icalsubscription.Params) {
+	scheduleKeys := params.ScheduleKeys
+	if err := validateScheduleKeys(scheduleKeys); err != nil {
+		respondBadRequest(w)
+		return
+	}
+
+	periodSelection, err := srv.createICalPeriodSelection(params)
+	if err != nil {
+		respondBadRequest(w)
+		return
+	}
+
+	itemFilter, err := compileItemFilter(params.Filter, params.HiddenSubjects)
+	if err != nil {
+		respondBadRequest(w)
+		return
+	}
+
+	if !srv.allowCredentialRequest(w, r, basicAuthValue) {
+		return
+	}
+
+	callParams := srv.createUEKCallParams(r, basicAuthValue)
+	aggregateSchedule, _, err := srv.uekSchedule.GetAggregateSchedule(r.Context(), callParams, scheduleKeys, periodSelection)
+	if err != nil {
+		srv.respondUEKError(w, r, err, "Failed to get aggregate schedule for ICal", slog.Group("params", slog.Any("scheduleKeys", scheduleKeys), slog.Any("periodSelection", periodSelection)))
+		return
+	}
+	aggregateSchedule = aggregateSchedule.Filter(itemFilter)
+
 	calendarNameBuilder := strings.Builder{}
 	calendarNameBuilder.WriteString("(UEK) ")
 	for i, header := range aggregateSchedule.Headers {
@@ -60,76 +139,91 @@ func (srv *Server) handleRequestICal(w http.ResponseWriter, r *http.Request) {
 		}
 		calendarNameBuilder.WriteString(header.Name)
 	}
-	if len(payload.HiddenSubjects) > 0 {
-		calendarNameBuilder.WriteString(fmt.Sprintf(" (-%d)", len(payload.HiddenSubjects)))
+	if hiddenRuleCount := len(params.HiddenSubjects) + len(params.Filter.Include) + len(params.Filter.Exclude); hiddenRuleCount > 0 {
+		calendarNameBuilder.WriteString(fmt.Sprintf(" (-%d)", hiddenRuleCount))
 	}
 	calendarName := calendarNameBuilder.String()
 
-	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.ics\"", calendarName))
+	now := time.Now()
+	calendar := &ical.Calendar{
+		ProductId: icalProductId,
+		Name:      calendarName,
+		TimeZone:  srv.icalTimeZone,
+		Events:    make([]*ical.Event, 0, len(aggregateSchedule.Items)),
+	}
 
-	fmt.Fprintf(w, "BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:-//UEK-PLANZAJEC-V4\nNAME: %s\nX-WR-CALNAME: %s\n", calendarName, calendarName)
-	dtStamp := time.Now().UTC().Format(icalTimestampFormat)
+	uids := createICalEventUIDs(scheduleKeys, aggregateSchedule.Items)
+	for i, item := range aggregateSchedule.Items {
+		sequence, lastModified := srv.icalEventVersions.resolve(uids[i], hashICalEventContent(item), now)
+		calendar.Events = append(calendar.Events, createICalEvent(item, uids[i], sequence, now, lastModified))
+	}
+	srv.icalEventVersions.persistIfDue(now)
 
-	for _, item := range aggregateSchedule.Items {
-		if slices.Contains(payload.HiddenSubjects, item.Subject) {
-			continue
-		}
+	setStalenessHeader(w, callParams.Staleness)
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.ics\"", calendarName))
+	calendar.WriteTo(w)
+}
 
-		fmt.Fprintf(w, "BEGIN:VEVENT\nUID:%s\nSEQUENCE:0\nDTSTAMP:%s\nDTSTART:%s\nDTEND:%s\nSUMMARY:", uuid.NewString(), dtStamp, item.Start.UTC().Format(icalTimestampFormat), item.End.UTC().Format(icalTimestampFormat))
-		if item.Extra != "" {
-			fmt.Fprint(w, "[!] ")
-		}
-		fmt.Fprintf(w, "[%s] %s\n", item.Type, item.Subject)
+func createICalEvent(item *uekschedule.ScheduleItem, uid string, sequence int, stamp time.Time, lastModified time.Time) *ical.Event {
+	event := &ical.Event{
+		UID:          uid,
+		Sequence:     sequence,
+		Stamp:        stamp,
+		LastModified: lastModified,
+		Start:        item.Start,
+		End:          item.End,
+		Categories:   []string{item.Type},
+	}
 
-		fmt.Fprint(w, "DESCRIPTION:")
-		if item.Extra != "" {
-			fmt.Fprint(w, item.Extra, "\\n\\n")
-		}
-		if item.RoomUrl != "" {
-			fmt.Fprint(w, item.RoomUrl, "\\n\\n")
-		}
+	summaryBuilder := strings.Builder{}
+	if item.Extra != "" {
+		summaryBuilder.WriteString("[!] ")
+	}
+	summaryBuilder.WriteString(fmt.Sprintf("[%s] %s", item.Type, item.Subject))
+	event.Summary = summaryBuilder.String()
 
-		if len(item.Lecturers) > 0 {
-			for i, lecturer := range item.Lecturers {
-				if i != 0 {
-					fmt.Fprint(w, ", ")
-				}
-				fmt.Fprint(w, lecturer.Name)
-				if lecturer.MoodleCourseId != 0 {
-					fmt.Fprintf(w, " (https://e-uczelnia.uek.krakow.pl/course/view.php?id=%d)", lecturer.MoodleCourseId)
-				}
-				fmt.Fprint(w, "\\n\\n")
-			}
+	descriptionBuilder := strings.Builder{}
+	if item.Extra != "" {
+		descriptionBuilder.WriteString(item.Extra)
+		descriptionBuilder.WriteString("\n\n")
+	}
+	if item.RoomUrl != "" {
+		descriptionBuilder.WriteString(item.RoomUrl)
+		descriptionBuilder.WriteString("\n\n")
+	}
+	for _, lecturer := range item.Lecturers {
+		descriptionBuilder.WriteString(lecturer.Name)
+		if lecturer.MoodleCourseId != 0 {
+			descriptionBuilder.WriteString(fmt.Sprintf(" (https://e-uczelnia.uek.krakow.pl/course/view.php?id=%d)", lecturer.MoodleCourseId))
 		}
+		descriptionBuilder.WriteString("\n\n")
+	}
+	descriptionBuilder.WriteString(strings.Join(item.Groups, ", "))
+	event.Description = strings.TrimSpace(descriptionBuilder.String())
 
-		if len(item.Groups) > 0 {
-			fmt.Fprint(w, "\\n")
-			for i, group := range item.Groups {
-				if i != 0 {
-					fmt.Fprint(w, ", ")
-				}
-				fmt.Fprint(w, group)
-			}
+	if len(item.Lecturers) > 0 {
+		event.Organizer = &ical.Organizer{
+			CommonName: item.Lecturers[0].Name,
+			Address:    "mailto:unknown@invalid.invalid",
 		}
+	}
 
-		fmt.Fprint(w, "\n")
-
-		if len(item.Lecturers) > 0 {
-			fmt.Fprintf(w, "ORGANIZER;CN=\"%s\":mailto:unknown@invalid.invalid\n", item.Lecturers[0].Name)
+	if item.RoomName != "" {
+		event.Location = item.RoomName
+		if item.RoomUrl != "" {
+			event.Location = "Online"
 		}
+	}
 
-		if item.RoomName != "" {
-			locationName := item.RoomName
-			if item.RoomUrl != "" {
-				locationName = "Online"
-			}
-
-			fmt.Fprintf(w, "LOCATION:%s\n", locationName)
-		}
+	return event
+}
 
-		fmt.Fprintf(w, "CATEGORIES:%s\nEND:VEVENT\n", item.Type)
+func ptrValueOrZero[T any](ptr *T) T {
+	if ptr == nil {
+		var zero T
+		return zero
 	}
 
-	fmt.Fprintln(w, "END:VCALENDAR")
+	return *ptr
 }
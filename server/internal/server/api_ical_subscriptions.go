@@ -0,0 +1,202 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/icalsubscription"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const maxICalSubscriptionRequestBodySize = 16 * 1024
+
+type icalSubscriptionResponse struct {
+	Slug string `json:"slug"`
+	// Path is relative to the origin of the server, clients know it better behind proxies
+	Path           string                      `json:"path"`
+	Schedules      []uekschedule.ScheduleKey   `json:"schedules"`
+	PeriodIdx      int                         `json:"periodIdx"`
+	From           string                      `json:"from,omitempty"`
+	To             string                      `json:"to,omitempty"`
+	DaysBack       *int                        `json:"daysBack,omitempty"`
+	DaysAhead      *int                        `json:"daysAhead,omitempty"`
+	HiddenSubjects []string                    `json:"hiddenSubjects"`
+	Filter         uekschedule.ItemFilterRules `json:"filter"`
+	CreatedAt      time.Time                   `json:"createdAt"`
+	UpdatedAt      time.Time                   `json:"updatedAt"`
+	// ExpiresAt is when the calendar stops working, unless the subscription is updated before
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func createICalSubscriptionResponse(subscription *icalsubscription.Subscription) icalSubscriptionResponse {
+	return icalSubscriptionResponse{
+		Slug:           subscription.Slug,
+		Path:           "/api/ical/s/" + subscription.Slug + ".ics",
+		Schedules:      subscription.Params.ScheduleKeys,
+		PeriodIdx:      subscription.Params.PeriodIdx,
+		From:           subscription.Params.From,
+		To:             subscription.Params.To,
+		DaysBack:       subscription.Params.DaysBack,
+		DaysAhead:      subscription.Params.DaysAhead,
+		HiddenSubjects: subscription.Params.HiddenSubjects,
+		Filter:         subscription.Params.Filter,
+		CreatedAt:      subscription.CreatedAt,
+		UpdatedAt:      subscription.UpdatedAt,
+		ExpiresAt:      subscription.ExpiresAt,
+	}
+}
+
+// decodeICalSubscriptionParams responds with 400 if the body is not a valid subscription
+func (srv *Server) decodeICalSubscriptionParams(w http.ResponseWriter, r *http.Request) (icalsubscription.Params, bool) {
+	body := struct {
+		Schedules      []uekschedule.ScheduleKey   `json:"schedules"`
+		PeriodIdx      int                         `json:"periodIdx"`
+		From           string                      `json:"from"`
+		To             string                      `json:"to"`
+		DaysBack       *int                        `json:"daysBack"`
+		DaysAhead      *int                        `json:"daysAhead"`
+		HiddenSubjects []string                    `json:"hiddenSubjects"`
+		Filter         uekschedule.ItemFilterRules `json:"filter"`
+	}{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxICalSubscriptionRequestBodySize)).Decode(&body); err != nil || validateScheduleKeys(body.Schedules) != nil {
+		respondBadRequest(w)
+		return icalsubscription.Params{}, false
+	}
+
+	params := icalsubscription.Params{
+		ScheduleKeys:   body.Schedules,
+		PeriodIdx:      body.PeriodIdx,
+		From:           body.From,
+		To:             body.To,
+		DaysBack:       body.DaysBack,
+		DaysAhead:      body.DaysAhead,
+		HiddenSubjects: body.HiddenSubjects,
+		Filter:         body.Filter,
+	}
+	if _, err := srv.createICalPeriodSelection(params); err != nil {
+		respondBadRequest(w)
+		return icalsubscription.Params{}, false
+	}
+
+	if _, err := compileItemFilter(params.Filter, params.HiddenSubjects); err != nil {
+		respondBadRequest(w)
+		return icalsubscription.Params{}, false
+	}
+
+	return params, true
+}
+
+func (srv *Server) handleRequestICalSubscriptionsList(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
+	if srv.icalSubscriptions == nil {
+		respondNotFound(w)
+		return
+	}
+
+	// owners are identified by their login only, so the password has to be checked
+	if !srv.verifyBasicAuth(w, r, basicAuthValue) {
+		return
+	}
+
+	subscriptions, err := srv.icalSubscriptions.ListSubscriptions(basicAuthValue)
+	if err != nil {
+		srv.logger.ErrorContext(r.Context(), "Failed to list ICal subscriptions", slog.Any("err", err))
+		respondInternalServerError(w)
+		return
+	}
+
+	res := make([]icalSubscriptionResponse, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		res = append(res, createICalSubscriptionResponse(subscription))
+	}
+
+	respondJSON(w, res)
+}
+
+func (srv *Server) handleRequestICalSubscriptionsCreate(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
+	if srv.icalSubscriptions == nil {
+		respondNotFound(w)
+		return
+	}
+
+	params, ok := srv.decodeICalSubscriptionParams(w, r)
+	if !ok {
+		return
+	}
+
+	if !srv.verifyBasicAuth(w, r, basicAuthValue) {
+		return
+	}
+
+	subscription, err := srv.icalSubscriptions.CreateSubscription(basicAuthValue, params)
+	if err != nil {
+		if errors.Is(err, icalsubscription.ErrInvalidSubscription) || errors.Is(err, icalsubscription.ErrTooManySubscriptions) {
+			respondBadRequest(w)
+		} else {
+			srv.logger.ErrorContext(r.Context(), "Failed to create ICal subscription", slog.Any("err", err))
+			respondInternalServerError(w)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	respondJSON(w, createICalSubscriptionResponse(subscription))
+}
+
+func (srv *Server) handleRequestICalSubscriptionsUpdate(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
+	if srv.icalSubscriptions == nil {
+		respondNotFound(w)
+		return
+	}
+
+	params, ok := srv.decodeICalSubscriptionParams(w, r)
+	if !ok {
+		return
+	}
+
+	if !srv.verifyBasicAuth(w, r, basicAuthValue) {
+		return
+	}
+
+	subscription, err := srv.icalSubscriptions.UpdateSubscription(basicAuthValue, r.PathValue("slug"), params)
+	if err != nil {
+		switch {
+		case errors.Is(err, icalsubscription.ErrSubscriptionNotFound):
+			respondNotFound(w)
+		case errors.Is(err, icalsubscription.ErrInvalidSubscription):
+			respondBadRequest(w)
+		default:
+			srv.logger.ErrorContext(r.Context(), "Failed to update ICal subscription", slog.Any("err", err))
+			respondInternalServerError(w)
+		}
+		return
+	}
+
+	respondJSON(w, createICalSubscriptionResponse(subscription))
+}
+
+func (srv *Server) handleRequestICalSubscriptionsDelete(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
+	if srv.icalSubscriptions == nil {
+		respondNotFound(w)
+		return
+	}
+
+	if !srv.verifyBasicAuth(w, r, basicAuthValue) {
+		return
+	}
+
+	if err := srv.icalSubscriptions.DeleteSubscription(basicAuthValue, r.PathValue("slug")); err != nil {
+		if errors.Is(err, icalsubscription.ErrSubscriptionNotFound) {
+			respondNotFound(w)
+		} else {
+			srv.logger.ErrorContext(r.Context(), "Failed to delete ICal subscription", slog.Any("err", err))
+			respondInternalServerError(w)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,120 @@
+package server_test
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/authtoken"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/bufferutil"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/icalsubscription"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/server"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+func createTestICalSubscriptionServer(storeDir string, uekTransport http.RoundTripper) (*server.Server, error) {
+	uekClient, err := uekschedule.NewClient(&http.Client{Transport: uekTransport}, slog.New(slog.DiscardHandler), config.UEK{
+		MaxConcurrentRequests: 1,
+	}, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptionService, err := encryption.NewService(encryption.Key{Id: "1", Value: []byte("g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI="), OwnerHashValue: []byte("owner-g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI=")}, nil, bufferutil.NewBufferPool(8*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := filestore.New(storeDir)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenService, err := authtoken.NewService(config.Tokens{
+		APITTL:  time.Hour,
+		ICalTTL: 24 * time.Hour,
+	}, encryptionService, store, slog.New(slog.DiscardHandler))
+	if err != nil {
+		return nil, err
+	}
+
+	icalSubscriptionService, err := icalsubscription.NewService(config.ICalSubscriptions{
+		Enabled:                 true,
+		MaxSubscriptionsPerUser: 5,
+	}, encryptionService, tokenService, store, slog.New(slog.DiscardHandler))
+	if err != nil {
+		return nil, err
+	}
+
+	return server.New(config.Server{}, server.Dependencies{
+		UEKSchedule:       uekClient,
+		ICalSubscriptions: icalSubscriptionService,
+		Store:             store,
+	}, slog.New(slog.DiscardHandler))
+}
+
+func TestICalSubscriptions(t *testing.T) {
+	srv, err := createTestICalSubscriptionServer(t.TempDir(), fakeUEKRoundTripper{})
+	if err != nil {
+		t.Errorf("Failed to create server: %s", err)
+		return
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/ical/subscriptions", strings.NewReader(`{"schedules":[{"type":"G","id":1}],"hiddenSubjects":["Statystyka"]}`))
+	req.SetBasicAuth("user", "pass")
+	res := httptest.NewRecorder()
+	srv.ServeHTTP(res, req)
+	if res.Code != http.StatusCreated {
+		t.Errorf("Unexpected status code when creating subscription, got: %d, want: %d, body: %s", res.Code, http.StatusCreated, res.Body.String())
+		return
+	}
+
+	subscription := struct {
+		Slug string `json:"slug"`
+		Path string `json:"path"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&subscription); err != nil {
+		t.Errorf("Failed to decode subscription: %s", err)
+		return
+	}
+
+	if len(subscription.Path) > 64 || strings.Contains(subscription.Path, "Statystyka") {
+		t.Errorf("Subscription path should be short and opaque, got: %s", subscription.Path)
+		return
+	}
+
+	res = httptest.NewRecorder()
+	srv.ServeHTTP(res, httptest.NewRequest(http.MethodGet, subscription.Path, nil))
+	if res.Code != http.StatusOK {
+		t.Errorf("Unexpected status code when getting calendar, got: %d, want: %d, body: %s", res.Code, http.StatusOK, res.Body.String())
+		return
+	}
+
+	if calendar := res.Body.String(); !strings.Contains(calendar, "Algebra") || strings.Contains(calendar, "Statystyka") {
+		t.Errorf("Calendar should contain only subjects which are not hidden, got: %s", calendar)
+		return
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/ical/subscriptions/"+subscription.Slug, nil)
+	req.SetBasicAuth("user", "pass")
+	res = httptest.NewRecorder()
+	srv.ServeHTTP(res, req)
+	if res.Code != http.StatusNoContent {
+		t.Errorf("Unexpected status code when deleting subscription, got: %d, want: %d", res.Code, http.StatusNoContent)
+		return
+	}
+
+	res = httptest.NewRecorder()
+	srv.ServeHTTP(res, httptest.NewRequest(http.MethodGet, subscription.Path, nil))
+	if res.Code != http.StatusNotFound {
+		t.Errorf("Unexpected status code when getting calendar of deleted subscription, got: %d, want: %d", res.Code, http.StatusNotFound)
+		return
+	}
+}
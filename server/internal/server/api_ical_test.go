@@ -0,0 +1,168 @@
+package server_test
+
+import (
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/server"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const testGroupingsResponse = `<plan-zajec><grupowanie typ="G" grupa="Grouping 1"/></plan-zajec>`
+
+const testScheduleResponse = `<plan-zajec typ="G" id="1" nazwa="Group A">
+	<zajecia><termin>2025-10-06</termin><od-godz>08:00</od-godz><do-godz>09:30</do-godz><przedmiot>Algebra</przedmiot><typ>wykład</typ><sala>Paw. A 101</sala></zajecia>
+	<zajecia><termin>2025-10-06</termin><od-godz>10:00</od-godz><do-godz>11:30</do-godz><przedmiot>Statystyka</przedmiot><typ>ćwiczenia</typ><sala>Paw. A 102</sala></zajecia>
+</plan-zajec>`
+
+// testICalPath points to the calendar of group 1, with credentials of "user:pass" in the url
+var testICalPath = "/api/ical/" + base64.StdEncoding.EncodeToString([]byte(`{"authScheme":"Basic","authValue":"dXNlcjpwYXNz","scheduleType":"G","scheduleIds":[1]}`))
+
+// fakeUEKRoundTripper responds with scheduleResponse, or testScheduleResponse if it is empty
+type fakeUEKRoundTripper struct {
+	scheduleResponse string
+}
+
+func (rt fakeUEKRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := rt.scheduleResponse
+	if body == "" {
+		body = testScheduleResponse
+	}
+	if req.URL.Query().Get("typ") == "" {
+		body = testGroupingsResponse
+	}
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func createTestICalServer(storeDir string, uekTransport http.RoundTripper) (*server.Server, error) {
+	uekClient, err := uekschedule.NewClient(&http.Client{Transport: uekTransport}, slog.New(slog.DiscardHandler), config.UEK{
+		MaxConcurrentRequests: 1,
+	}, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := filestore.New(storeDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return server.New(config.Server{}, server.Dependencies{
+		UEKSchedule: uekClient,
+		Store:       store,
+	}, slog.New(slog.DiscardHandler))
+}
+
+func TestICalEventVersionsSurviveRestart(t *testing.T) {
+	storeDir := t.TempDir()
+	srv, err := createTestICalServer(storeDir, fakeUEKRoundTripper{})
+	if err != nil {
+		t.Errorf("Failed to create server: %s", err)
+		return
+	}
+
+	res := httptest.NewRecorder()
+	srv.ServeHTTP(res, httptest.NewRequest(http.MethodGet, testICalPath, nil))
+	if calendar := res.Body.String(); !strings.Contains(calendar, "SEQUENCE:0") || strings.Contains(calendar, "SEQUENCE:1") {
+		t.Errorf("Calendar should contain the first versions of events, got: %s", calendar)
+		return
+	}
+
+	if err := srv.Shutdown(t.Context()); err != nil {
+		t.Errorf("Failed to shut down server: %s", err)
+		return
+	}
+
+	// the class moved to another room while the server was restarting
+	restartedSrv, err := createTestICalServer(storeDir, fakeUEKRoundTripper{
+		scheduleResponse: strings.Replace(testScheduleResponse, "Paw. A 101", "Paw. B 201", 1),
+	})
+	if err != nil {
+		t.Errorf("Failed to create restarted server: %s", err)
+		return
+	}
+
+	res = httptest.NewRecorder()
+	restartedSrv.ServeHTTP(res, httptest.NewRequest(http.MethodGet, testICalPath, nil))
+	if calendar := res.Body.String(); !strings.Contains(calendar, "SEQUENCE:1") {
+		t.Errorf("Calendar should contain the next version of the event after a restart, got: %s", calendar)
+		return
+	}
+}
+
+func TestICalEventUIDsIgnoreUEKOrder(t *testing.T) {
+	const firstItem = `<zajecia><termin>2025-10-06</termin><od-godz>08:00</od-godz><do-godz>09:30</do-godz><przedmiot>Algebra</przedmiot><typ>wykład</typ><sala>Paw. A 101</sala></zajecia>`
+	const secondItem = `<zajecia><termin>2025-10-06</termin><od-godz>08:00</od-godz><do-godz>09:30</do-godz><przedmiot>Algebra</przedmiot><typ>wykład</typ><sala>Paw. B 201</sala></zajecia>`
+
+	getRoomUIDs := func(scheduleResponse string) (map[string]string, error) {
+		srv, err := createTestICalServer(t.TempDir(), fakeUEKRoundTripper{scheduleResponse: scheduleResponse})
+		if err != nil {
+			return nil, err
+		}
+
+		res := httptest.NewRecorder()
+		srv.ServeHTTP(res, httptest.NewRequest(http.MethodGet, testICalPath, nil))
+
+		roomUIDs := map[string]string{}
+		uid := ""
+		for line := range strings.Lines(res.Body.String()) {
+			line = strings.TrimRight(line, "\r\n")
+			if value, ok := strings.CutPrefix(line, "UID:"); ok {
+				uid = value
+			} else if value, ok := strings.CutPrefix(line, "LOCATION:"); ok {
+				roomUIDs[value] = uid
+			}
+		}
+
+		return roomUIDs, nil
+	}
+
+	roomUIDs, err := getRoomUIDs(`<plan-zajec typ="G" id="1" nazwa="Group A">` + firstItem + secondItem + `</plan-zajec>`)
+	if err != nil {
+		t.Errorf("Failed to get calendar: %s", err)
+		return
+	}
+
+	reorderedRoomUIDs, err := getRoomUIDs(`<plan-zajec typ="G" id="1" nazwa="Group A">` + secondItem + firstItem + `</plan-zajec>`)
+	if err != nil {
+		t.Errorf("Failed to get calendar of reordered schedule: %s", err)
+		return
+	}
+
+	if len(roomUIDs) != 2 || !maps.Equal(roomUIDs, reorderedRoomUIDs) {
+		t.Errorf("Events should keep their UIDs when UEK reorders them, got: %v, want: %v", reorderedRoomUIDs, roomUIDs)
+		return
+	}
+
+	for _, changedItem := range []string{
+		strings.Replace(firstItem, "</sala>", "</sala><nauczyciel>dr Jan Kowalski</nauczyciel>", 1),
+		strings.Replace(firstItem, "</sala>", "</sala><nauczyciel>mgr Anna Nowak</nauczyciel>", 1),
+		strings.Replace(firstItem, "</sala>", "</sala><uwagi>Odwołane</uwagi>", 1),
+		strings.Replace(firstItem, "</sala>", "</sala><uwagi>Zajęcia zdalne</uwagi>", 1),
+		strings.Replace(firstItem, "09:30", "10:15", 1),
+	} {
+		changedRoomUIDs, err := getRoomUIDs(`<plan-zajec typ="G" id="1" nazwa="Group A">` + changedItem + secondItem + `</plan-zajec>`)
+		if err != nil {
+			t.Errorf("Failed to get calendar of changed schedule: %s", err)
+			return
+		}
+
+		if !maps.Equal(roomUIDs, changedRoomUIDs) {
+			t.Errorf("Events should keep their UIDs when another event changes, got: %v, want: %v", changedRoomUIDs, roomUIDs)
+			return
+		}
+	}
+}
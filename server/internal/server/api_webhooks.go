@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/webhook"
+)
+
+const maxWebhookRequestBodySize = 16 * 1024
+
+type webhookSubscriptionResponse struct {
+	Id             string                      `json:"id"`
+	Secret         string                      `json:"secret,omitempty"`
+	TargetUrl      string                      `json:"targetUrl"`
+	Format         webhook.Format              `json:"format"`
+	Schedules      []uekschedule.ScheduleKey   `json:"schedules"`
+	HiddenSubjects []string                    `json:"hiddenSubjects"`
+	Filter         uekschedule.ItemFilterRules `json:"filter"`
+	CreatedAt      time.Time                   `json:"createdAt"`
+	DisabledAt     *time.Time                  `json:"disabledAt,omitempty"`
+	DisabledReason string                      `json:"disabledReason,omitempty"`
+}
+
+func createWebhookSubscriptionResponse(subscription *webhook.Subscription, includeSecret bool) webhookSubscriptionResponse {
+	res := webhookSubscriptionResponse{
+		Id:             subscription.Id,
+		TargetUrl:      subscription.TargetUrl,
+		Format:         subscription.Format,
+		Schedules:      subscription.ScheduleKeys,
+		HiddenSubjects: subscription.HiddenSubjects,
+		Filter:         subscription.Filter,
+		CreatedAt:      subscription.CreatedAt,
+		DisabledAt:     subscription.DisabledAt,
+		DisabledReason: subscription.DisabledReason,
+	}
+	if includeSecret {
+		res.Secret = subscription.Secret
+	}
+
+	return res
+}
+
+func (srv *Server) handleRequestWebhooksList(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
+	if srv.webhooks == nil {
+		respondNotFound(w)
+		return
+	}
+
+	// owners are identified by their login only, so the password has to be checked
+	if !srv.verifyBasicAuth(w, r, basicAuthValue) {
+		return
+	}
+
+	subscriptions, err := srv.webhooks.ListSubscriptions(basicAuthValue)
+	if err != nil {
+		srv.logger.Error("Failed to list webhook subscriptions", slog.Any("err", err))
+		respondInternalServerError(w)
+		return
+	}
+
+	res := make([]webhookSubscriptionResponse, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		res = append(res, createWebhookSubscriptionResponse(subscription, false))
+	}
+
+	respondJSON(w, res)
+}
+
+func (srv *Server) handleRequestWebhooksCreate(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
+	if srv.webhooks == nil {
+		respondNotFound(w)
+		return
+	}
+
+	body := struct {
+		TargetUrl      string                      `json:"targetUrl"`
+		Format         webhook.Format              `json:"format"`
+		Schedules      []uekschedule.ScheduleKey   `json:"schedules"`
+		HiddenSubjects []string                    `json:"hiddenSubjects"`
+		Filter         uekschedule.ItemFilterRules `json:"filter"`
+	}{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookRequestBodySize)).Decode(&body); err != nil || validateScheduleKeys(body.Schedules) != nil {
+		respondBadRequest(w)
+		return
+	}
+
+	if !srv.verifyBasicAuth(w, r, basicAuthValue) {
+		return
+	}
+
+	subscription, err := srv.webhooks.CreateSubscription(basicAuthValue, webhook.CreateSubscriptionParams{
+		TargetUrl:      body.TargetUrl,
+		Format:         body.Format,
+		ScheduleKeys:   body.Schedules,
+		HiddenSubjects: body.HiddenSubjects,
+		Filter:         body.Filter,
+	})
+	if err != nil {
+		if errors.Is(err, webhook.ErrInvalidSubscription) || errors.Is(err, webhook.ErrTooManySubscriptions) {
+			respondBadRequest(w)
+		} else {
+			srv.logger.Error("Failed to create webhook subscription", slog.Any("err", err))
+			respondInternalServerError(w)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	respondJSON(w, createWebhookSubscriptionResponse(subscription, true))
+}
+
+func (srv *Server) handleRequestWebhooksDelete(w http.ResponseWriter, r *http.Request, basicAuthValue string) {
+	if srv.webhooks == nil {
+		respondNotFound(w)
+		return
+	}
+
+	if !srv.verifyBasicAuth(w, r, basicAuthValue) {
+		return
+	}
+
+	if err := srv.webhooks.DeleteSubscription(basicAuthValue, r.PathValue("id")); err != nil {
+		if errors.Is(err, webhook.ErrSubscriptionNotFound) {
+			respondNotFound(w)
+		} else {
+			srv.logger.Error("Failed to delete webhook subscription", slog.Any("err", err))
+			respondInternalServerError(w)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+const proxyPresetFly = "fly"
+
+func parseTrustedProxies(rawTrustedProxies []string) ([]netip.Prefix, error) {
+	trustedProxies := make([]netip.Prefix, 0, len(rawTrustedProxies))
+	for _, rawTrustedProxy := range rawTrustedProxies {
+		if !strings.Contains(rawTrustedProxy, "/") {
+			addr, err := netip.ParseAddr(rawTrustedProxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", rawTrustedProxy, err)
+			}
+			trustedProxies = append(trustedProxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(rawTrustedProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", rawTrustedProxy, err)
+		}
+		trustedProxies = append(trustedProxies, prefix.Masked())
+	}
+
+	return trustedProxies, nil
+}
+
+func (srv *Server) isTrustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, trustedProxy := range srv.trustedProxies {
+		if trustedProxy.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getClientIP is the only source of the client IP, for rate limiting, logging and forwarding to UEK.
+// It walks the forwarding chain back from the direct peer, X-Forwarded-For entries are only believed as long as every hop after them is a trusted proxy
+func (srv *Server) getClientIP(r *http.Request) string {
+	// the Fly.io proxy overwrites Fly-Client-IP sent by clients, and every public request goes through it
+	if srv.proxyPreset == proxyPresetFly {
+		if flyClientAddr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("Fly-Client-IP"))); err == nil {
+			return flyClientAddr.Unmap().String()
+		}
+	}
+
+	remoteAddrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	clientAddr := remoteAddrPort.Addr().Unmap()
+	forwardedFor := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0 && srv.isTrustedProxy(clientAddr); i-- {
+		forwardedAddr, err := netip.ParseAddr(strings.TrimSpace(forwardedFor[i]))
+		if err != nil {
+			// a trusted proxy would not add garbage, so the client did, and the last good hop is as close to the client as it gets
+			break
+		}
+		clientAddr = forwardedAddr.Unmap()
+	}
+
+	return clientAddr.String()
+}
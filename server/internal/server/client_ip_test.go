@@ -0,0 +1,97 @@
+package server_test
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/ratelimit"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/server"
+)
+
+// the IP rate limiter with a burst of 1 tells whether two requests were attributed to the same client
+func TestClientIPResolution(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		cfg        config.Server
+		first      func(r *http.Request)
+		second     func(r *http.Request)
+		sameClient bool
+	}{
+		{
+			name: "untrusted peer cannot spoof X-Forwarded-For",
+			cfg:  config.Server{},
+			first: func(r *http.Request) {
+				r.Header.Set("X-Forwarded-For", "198.51.100.1")
+			},
+			second: func(r *http.Request) {
+				r.Header.Set("X-Forwarded-For", "198.51.100.2")
+			},
+			sameClient: true,
+		},
+		{
+			name: "trusted proxy entries are believed",
+			cfg:  config.Server{TrustedProxies: []string{"192.0.2.0/24"}},
+			first: func(r *http.Request) {
+				r.Header.Set("X-Forwarded-For", "198.51.100.1")
+			},
+			second: func(r *http.Request) {
+				r.Header.Set("X-Forwarded-For", "198.51.100.2")
+			},
+			sameClient: false,
+		},
+		{
+			name: "entries before the first untrusted hop are ignored",
+			cfg:  config.Server{TrustedProxies: []string{"192.0.2.0/24"}},
+			first: func(r *http.Request) {
+				r.Header.Set("X-Forwarded-For", "203.0.113.1, 198.51.100.1")
+			},
+			second: func(r *http.Request) {
+				r.Header.Set("X-Forwarded-For", "203.0.113.2, 198.51.100.1")
+			},
+			sameClient: true,
+		},
+		{
+			name: "fly preset uses Fly-Client-IP",
+			cfg:  config.Server{ProxyPreset: "fly"},
+			first: func(r *http.Request) {
+				r.Header.Set("Fly-Client-IP", "198.51.100.1")
+				r.Header.Set("X-Forwarded-For", "203.0.113.1")
+			},
+			second: func(r *http.Request) {
+				r.Header.Set("Fly-Client-IP", "198.51.100.2")
+				r.Header.Set("X-Forwarded-For", "203.0.113.1")
+			},
+			sameClient: false,
+		},
+	} {
+		ipRateLimiter, err := ratelimit.NewLimiter(1, 1, 10)
+		if err != nil {
+			t.Errorf("Failed to create limiter: %s", err)
+			return
+		}
+
+		srv, err := server.New(tc.cfg, server.Dependencies{IPRateLimiter: ipRateLimiter}, slog.New(slog.DiscardHandler))
+		if err != nil {
+			t.Errorf("%s: failed to create server: %s", tc.name, err)
+			continue
+		}
+
+		statusCodes := []int{}
+		for _, modifyRequest := range []func(r *http.Request){tc.first, tc.second} {
+			req := httptest.NewRequest(http.MethodGet, "/api/data/groupings", nil)
+			req.RemoteAddr = "192.0.2.10:54321"
+			modifyRequest(req)
+
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			statusCodes = append(statusCodes, rec.Code)
+		}
+
+		if sameClient := statusCodes[1] == http.StatusTooManyRequests; sameClient != tc.sameClient {
+			t.Errorf("%s: unexpected status codes: %v", tc.name, statusCodes)
+		}
+	}
+}
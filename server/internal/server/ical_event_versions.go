@@ -0,0 +1,226 @@
+package server
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const icalEventUIDDomain = "uek-planzajec-v4"
+
+const icalEventVersionsStoreKey = "ical-event-versions"
+
+const icalEventVersionRetention = 60 * 24 * time.Hour
+const icalEventVersionPersistInterval = 5 * time.Minute
+
+// maxICalEventVersions bounds the tracker, since anyone can request calendars of any combination of schedules
+const maxICalEventVersions = 100_000
+
+// icalEventVersionTracker remembers what each event looked like the last time it was served, so that SEQUENCE and LAST-MODIFIED only change when the class itself changes.
+// Versions are persisted if there is a store, otherwise calendar apps would see every event as modified after a restart
+type icalEventVersionTracker struct {
+	store       *filestore.Store
+	logger      *slog.Logger
+	mu          sync.Mutex
+	versions    map[string]*icalEventVersion
+	dirty       bool
+	lastPersist time.Time
+	// persistMu keeps an older copy of versions from replacing a newer one in the store
+	persistMu sync.Mutex
+}
+
+type icalEventVersion struct {
+	ContentHash  uint64    `json:"contentHash"`
+	Sequence     int       `json:"sequence"`
+	LastModified time.Time `json:"lastModified"`
+	LastSeen     time.Time `json:"lastSeen"`
+}
+
+func newICalEventVersionTracker(store *filestore.Store, logger *slog.Logger) *icalEventVersionTracker {
+	t := &icalEventVersionTracker{
+		store:       store,
+		logger:      logger,
+		versions:    map[string]*icalEventVersion{},
+		lastPersist: time.Now(),
+	}
+
+	if store != nil {
+		if _, err := store.Get(icalEventVersionsStoreKey, &t.versions); err != nil {
+			logger.Warn("Failed to load ICal event versions", slog.Any("err", err))
+			t.versions = map[string]*icalEventVersion{}
+		}
+	}
+
+	return t
+}
+
+func (t *icalEventVersionTracker) resolve(uid string, contentHash uint64, now time.Time) (int, time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	version, ok := t.versions[uid]
+	if !ok {
+		version = &icalEventVersion{
+			ContentHash:  contentHash,
+			LastModified: now,
+		}
+		t.versions[uid] = version
+		if len(t.versions) > maxICalEventVersions {
+			t.evictLeastRecentlySeen()
+		}
+	} else if version.ContentHash != contentHash {
+		version.ContentHash = contentHash
+		version.Sequence++
+		version.LastModified = now
+	}
+	version.LastSeen = now
+	t.dirty = true
+
+	return version.Sequence, version.LastModified
+}
+
+// evictLeastRecentlySeen makes room for a tenth of the limit at once, so that versions are not sorted on every new event
+func (t *icalEventVersionTracker) evictLeastRecentlySeen() {
+	uids := slices.Collect(maps.Keys(t.versions))
+	slices.SortFunc(uids, func(a string, b string) int {
+		return t.versions[a].LastSeen.Compare(t.versions[b].LastSeen)
+	})
+
+	for _, uid := range uids[:len(uids)-maxICalEventVersions*9/10] {
+		delete(t.versions, uid)
+	}
+	t.dirty = true
+}
+
+// persistIfDue prunes versions not seen for a while and stores the rest, at most once per interval so that serving calendars does not mean writing files
+func (t *icalEventVersionTracker) persistIfDue(now time.Time) {
+	t.mu.Lock()
+	isDue := now.Sub(t.lastPersist) >= icalEventVersionPersistInterval
+	t.mu.Unlock()
+
+	if isDue {
+		t.persist(now)
+	}
+}
+
+func (t *icalEventVersionTracker) persist(now time.Time) {
+	t.persistMu.Lock()
+	defer t.persistMu.Unlock()
+
+	t.mu.Lock()
+	for uid, version := range t.versions {
+		if now.Sub(version.LastSeen) > icalEventVersionRetention {
+			delete(t.versions, uid)
+			t.dirty = true
+		}
+	}
+	t.lastPersist = now
+	if !t.dirty || t.store == nil {
+		t.mu.Unlock()
+		return
+	}
+	versions := make(map[string]icalEventVersion, len(t.versions))
+	for uid, version := range t.versions {
+		versions[uid] = *version
+	}
+	t.dirty = false
+	t.mu.Unlock()
+
+	if err := t.store.Put(icalEventVersionsStoreKey, versions); err != nil {
+		t.logger.Warn("Failed to persist ICal event versions", slog.Any("err", err))
+		t.mu.Lock()
+		t.dirty = true
+		t.mu.Unlock()
+	}
+}
+
+// createICalEventUIDs numbers classes sharing a UID base, e.g. the same class of two groups, in the order of their groups, rooms and end times rather than the order UEK returned them in.
+// These rarely change, unlike e.g. lecturers, so that a change of one class does not renumber the others
+func createICalEventUIDs(scheduleKeys []uekschedule.ScheduleKey, items []*uekschedule.ScheduleItem) []string {
+	uidBases := make([]string, len(items))
+	itemIdxs := make([]int, len(items))
+	for i, item := range items {
+		uidBases[i] = createICalEventUIDBase(scheduleKeys, item)
+		itemIdxs[i] = i
+	}
+	slices.SortStableFunc(itemIdxs, func(a int, b int) int {
+		return cmp.Or(
+			strings.Compare(uidBases[a], uidBases[b]),
+			slices.Compare(items[a].Groups, items[b].Groups),
+			strings.Compare(items[a].RoomName, items[b].RoomName),
+			items[a].End.Compare(items[b].End),
+		)
+	})
+
+	uids := make([]string, len(items))
+	uidBaseOccurrences := map[string]int{}
+	for _, i := range itemIdxs {
+		uids[i] = createICalEventUID(uidBases[i], uidBaseOccurrences[uidBases[i]])
+		uidBaseOccurrences[uidBases[i]]++
+	}
+
+	return uids
+}
+
+// createICalEventUIDBase derives the part of event UID that identifies a class within a calendar, it must not depend on anything that can change without the class becoming a different one
+func createICalEventUIDBase(scheduleKeys []uekschedule.ScheduleKey, item *uekschedule.ScheduleItem) string {
+	sortedScheduleKeys := slices.Clone(scheduleKeys)
+	slices.SortFunc(sortedScheduleKeys, uekschedule.ScheduleKey.Compare)
+
+	h := sha256.New()
+	for _, scheduleKey := range sortedScheduleKeys {
+		io.WriteString(h, scheduleKey.String())
+		io.WriteString(h, "\x00")
+	}
+	io.WriteString(h, item.Subject)
+	io.WriteString(h, "\x00")
+	io.WriteString(h, item.Type)
+	io.WriteString(h, "\x00")
+	binary.Write(h, binary.BigEndian, item.Start.Unix())
+
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func createICalEventUID(uidBase string, occurrence int) string {
+	if occurrence == 0 {
+		return uidBase + "@" + icalEventUIDDomain
+	}
+
+	return uidBase + "-" + strconv.Itoa(occurrence) + "@" + icalEventUIDDomain
+}
+
+// hashICalEventContent covers everything that ends up in the event besides its identity
+func hashICalEventContent(item *uekschedule.ScheduleItem) uint64 {
+	h := fnv.New64a()
+	binary.Write(h, binary.BigEndian, item.End.Unix())
+	io.WriteString(h, item.RoomName)
+	io.WriteString(h, "\x00")
+	io.WriteString(h, item.RoomUrl)
+	io.WriteString(h, "\x00")
+	io.WriteString(h, item.Extra)
+	for _, lecturer := range item.Lecturers {
+		io.WriteString(h, "\x00")
+		io.WriteString(h, lecturer.Name)
+		binary.Write(h, binary.BigEndian, int64(lecturer.MoodleCourseId))
+	}
+	io.WriteString(h, "\x01")
+	for _, group := range item.Groups {
+		io.WriteString(h, "\x00")
+		io.WriteString(h, group)
+	}
+
+	return h.Sum64()
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const maxItemFilterLength = 8 * 1024
+
+var errInvalidItemFilter = errors.New("invalid item filter")
+
+// parseItemFilterFromQuery accepts rules as json in the filter param, e.g. filter={"exclude":[{"subject":"Algebra","type":"wykład"}]}
+func parseItemFilterFromQuery(queryParams url.Values) (*uekschedule.ItemFilter, error) {
+	rawFilter := queryParams.Get("filter")
+	if rawFilter == "" {
+		return nil, nil
+	}
+
+	if len(rawFilter) > maxItemFilterLength {
+		return nil, errInvalidItemFilter
+	}
+
+	rules := uekschedule.ItemFilterRules{}
+	if err := json.Unmarshal([]byte(rawFilter), &rules); err != nil {
+		return nil, errInvalidItemFilter
+	}
+
+	return compileItemFilter(rules, nil)
+}
+
+// compileItemFilter returns nil if there is nothing to filter out
+func compileItemFilter(rules uekschedule.ItemFilterRules, hiddenSubjects []string) (*uekschedule.ItemFilter, error) {
+	if rules.IsEmpty() && len(hiddenSubjects) == 0 {
+		return nil, nil
+	}
+
+	filter, err := rules.CompileHidingSubjects(hiddenSubjects)
+	if err != nil {
+		return nil, errors.Join(errInvalidItemFilter, err)
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/bufferutil"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/metrics"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/tracing"
+)
+
+type serverMetrics struct {
+	requests            *metrics.Counter
+	requestDuration     *metrics.Histogram
+	rateLimitedRequests *metrics.Counter
+}
+
+func newServerMetrics(registry *metrics.Registry, bufferPools map[string]*bufferutil.BufferPool) *serverMetrics {
+	bufferPoolGets := registry.NewCounter("uekpz4_buffer_pool_gets_total", "Buffers taken from the pool.", "pool")
+	bufferPoolAllocations := registry.NewCounter("uekpz4_buffer_pool_allocations_total", "Buffers allocated because the pool had none to reuse.", "pool")
+	bufferPoolInUse := registry.NewGauge("uekpz4_buffer_pool_in_use", "Buffers taken from the pool and not yet returned.", "pool")
+	for poolName, pool := range bufferPools {
+		bufferPoolGets.SetFunc(func() float64 {
+			return float64(pool.Stats().Gets)
+		}, poolName)
+		bufferPoolAllocations.SetFunc(func() float64 {
+			return float64(pool.Stats().Allocations)
+		}, poolName)
+		bufferPoolInUse.SetFunc(func() float64 {
+			return float64(pool.Stats().InUse)
+		}, poolName)
+	}
+
+	return &serverMetrics{
+		requests:            registry.NewCounter("uekpz4_http_requests_total", "Handled requests by route and status code.", "route", "code"),
+		requestDuration:     registry.NewHistogram("uekpz4_http_request_duration_seconds", "Time taken to handle requests by route.", metrics.DurationBuckets, "route"),
+		rateLimitedRequests: registry.NewCounter("uekpz4_http_rate_limited_requests_total", "Requests rejected by rate limiting, by the limit which was exceeded.", "kind"),
+	}
+}
+
+// statusRecordingResponseWriter remembers the status code for metrics
+type statusRecordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (w *statusRecordingResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusRecordingResponseWriter) Write(p []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusRecordingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// applyInstrumentationMiddleware wraps the whole mux, requests are measured and traced by the matched pattern, which is set on the request by the mux.
+// The path itself is not recorded, ical links carry encrypted credentials in it
+func (srv *Server) applyInstrumentationMiddleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		recordingWriter := &statusRecordingResponseWriter{
+			ResponseWriter: w,
+		}
+
+		remoteParent, _ := tracing.ParseTraceparent(r.Header.Get("traceparent"))
+		ctx, span := srv.tracer.StartRootSpan(r.Context(), r.Method, tracing.SpanKindServer, remoteParent, slog.String("http.request.method", r.Method), slog.String("client.address", srv.getClientIP(r)))
+		defer span.End()
+		r = r.WithContext(ctx)
+
+		handler.ServeHTTP(recordingWriter, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		statusCode := recordingWriter.statusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+
+		span.SetName(route)
+		span.SetAttrs(slog.String("http.route", route), slog.Int("http.response.status_code", statusCode))
+
+		srv.metrics.requests.Inc(route, strconv.Itoa(statusCode))
+		srv.metrics.requestDuration.Observe(time.Since(startTime).Seconds(), route)
+	})
+}
+
+func (srv *Server) handleRequestMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := srv.metricsRegistry.Write(w); err != nil {
+		srv.logger.Debug("Failed to write metrics", slog.Any("err", err))
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const dateParamFormat = "2006-01-02"
+
+const maxPeriodSelectionRangeDays = 400
+
+var errInvalidPeriodSelection = errors.New("invalid period selection")
+
+// parsePeriodSelectionFromQuery accepts either periodIdx, or from and to dates, both inclusive
+func (srv *Server) parsePeriodSelectionFromQuery(queryParams url.Values) (uekschedule.PeriodSelection, error) {
+	rawFrom, rawTo := strings.TrimSpace(queryParams.Get("from")), strings.TrimSpace(queryParams.Get("to"))
+	if rawFrom != "" || rawTo != "" {
+		return srv.parsePeriodSelectionFromDates(rawFrom, rawTo)
+	}
+
+	periodIdx, err := strconv.Atoi(strings.TrimSpace(queryParams.Get("periodIdx")))
+	if err != nil || periodIdx < 0 {
+		return uekschedule.PeriodSelection{}, errInvalidPeriodSelection
+	}
+
+	return uekschedule.PeriodSelection{
+		PeriodIdx: periodIdx,
+	}, nil
+}
+
+func (srv *Server) parsePeriodSelectionFromDates(rawFrom string, rawTo string) (uekschedule.PeriodSelection, error) {
+	loc := srv.uekSchedule.Location()
+
+	from, err := time.ParseInLocation(dateParamFormat, rawFrom, loc)
+	if err != nil {
+		return uekschedule.PeriodSelection{}, errInvalidPeriodSelection
+	}
+
+	lastDay, err := time.ParseInLocation(dateParamFormat, rawTo, loc)
+	if err != nil {
+		return uekschedule.PeriodSelection{}, errInvalidPeriodSelection
+	}
+
+	return createPeriodSelectionFromDays(from, lastDay)
+}
+
+// createPeriodSelectionFromRollingWindow creates a range relative to today, so that it never goes out of date
+func (srv *Server) createPeriodSelectionFromRollingWindow(daysBack int, daysAhead int) (uekschedule.PeriodSelection, error) {
+	if daysBack < 0 || daysAhead < 0 {
+		return uekschedule.PeriodSelection{}, errInvalidPeriodSelection
+	}
+
+	now := time.Now().In(srv.uekSchedule.Location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	return createPeriodSelectionFromDays(today.AddDate(0, 0, -daysBack), today.AddDate(0, 0, daysAhead))
+}
+
+func createPeriodSelectionFromDays(firstDay time.Time, lastDay time.Time) (uekschedule.PeriodSelection, error) {
+	to := lastDay.AddDate(0, 0, 1)
+	if !firstDay.Before(to) || to.After(firstDay.AddDate(0, 0, maxPeriodSelectionRangeDays)) {
+		return uekschedule.PeriodSelection{}, errInvalidPeriodSelection
+	}
+
+	return uekschedule.PeriodSelection{
+		From: firstDay,
+		To:   to,
+	}, nil
+}
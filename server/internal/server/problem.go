@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const problemTypePrefix = "urn:uekpz4:problem:"
+
+// problemDetails is an RFC 9457 response body, Type is about:blank for problems fully described by the status code
+type problemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// ItemIdx is set for responses from UEK which failed to parse because of a single schedule item
+	ItemIdx *int `json:"itemIdx,omitempty"`
+}
+
+func respondProblem(w http.ResponseWriter, problem problemDetails) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+func respondStatusProblem(w http.ResponseWriter, status int) {
+	respondProblem(w, problemDetails{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+	})
+}
+
+// respondUEKError maps errors from uekschedule to problems, unexpected ones are logged with logMessage and logAttrs
+func (srv *Server) respondUEKError(w http.ResponseWriter, r *http.Request, err error, logMessage string, logAttrs ...any) {
+	var parseErr *uekschedule.ParseError
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return
+	case errors.Is(err, uekschedule.ErrUnauthorized):
+		respondUnauthorized(w)
+	case errors.Is(err, uekschedule.ErrNotFound):
+		respondProblem(w, problemDetails{
+			Type:   problemTypePrefix + "schedule-not-found",
+			Title:  "Schedule not found",
+			Status: http.StatusNotFound,
+			Detail: "UEK does not have a schedule with this type and id",
+		})
+	case errors.Is(err, uekschedule.ErrInvalidPeriod):
+		respondProblem(w, problemDetails{
+			Type:   problemTypePrefix + "invalid-period",
+			Title:  "Invalid period",
+			Status: http.StatusBadRequest,
+			Detail: "The requested period does not exist in this schedule",
+		})
+	case errors.Is(err, uekschedule.ErrUpstreamRateLimited):
+		srv.logger.WarnContext(r.Context(), logMessage, append(logAttrs, slog.Any("err", err))...)
+		w.Header().Set("Retry-After", strconv.Itoa(60))
+		respondProblem(w, problemDetails{
+			Type:   problemTypePrefix + "upstream-rate-limited",
+			Title:  "UEK rate limit exceeded",
+			Status: http.StatusTooManyRequests,
+			Detail: "UEK is rejecting requests because too many were made, try again later",
+		})
+	case errors.Is(err, uekschedule.ErrUpstreamUnavailable):
+		srv.logger.WarnContext(r.Context(), logMessage, append(logAttrs, slog.Any("err", err))...)
+		respondProblem(w, problemDetails{
+			Type:   problemTypePrefix + "upstream-unavailable",
+			Title:  "UEK is unavailable",
+			Status: http.StatusServiceUnavailable,
+			Detail: "planzajec.uek.krakow.pl is not responding, try again later",
+		})
+	case errors.As(err, &parseErr):
+		srv.logger.ErrorContext(r.Context(), logMessage, append(logAttrs, slog.Any("err", err))...)
+		problem := problemDetails{
+			Type:   problemTypePrefix + "upstream-malformed-response",
+			Title:  "Malformed response from UEK",
+			Status: http.StatusBadGateway,
+			Detail: "UEK responded with data that could not be understood",
+		}
+		if parseErr.ItemIdx >= 0 {
+			problem.ItemIdx = &parseErr.ItemIdx
+		}
+		respondProblem(w, problem)
+	default:
+		srv.logger.ErrorContext(r.Context(), logMessage, append(logAttrs, slog.Any("err", err))...)
+		respondInternalServerError(w)
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/ratelimit"
+)
+
+const (
+	rateLimitKindIP         = "ip"
+	rateLimitKindCredential = "credential"
+)
+
+// applyRateLimitMiddleware limits requests per client IP, for endpoints which can end up calling UEK
+func (srv *Server) applyRateLimitMiddleware(handler http.HandlerFunc) http.HandlerFunc {
+	if srv.ipRateLimiter == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !srv.allowRequest(w, r, srv.ipRateLimiter, rateLimitKindIP, srv.getClientIP(r)) {
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// allowCredentialRequest limits requests per UEK credentials, which stops a client from getting around the IP limit by coming from many addresses
+func (srv *Server) allowCredentialRequest(w http.ResponseWriter, r *http.Request, basicAuthValue string) bool {
+	if srv.credentialRateLimiter == nil {
+		return true
+	}
+
+	// logins are hashed with a key, so that they are not kept in memory for longer than the request, and changing the password does not reset the limit
+	ownerHash, err := srv.encryption.HashOwner(basicAuthValue)
+	if err != nil {
+		respondUnauthorized(w)
+		return false
+	}
+
+	return srv.allowRequest(w, r, srv.credentialRateLimiter, rateLimitKindCredential, ownerHash)
+}
+
+func (srv *Server) allowRequest(w http.ResponseWriter, r *http.Request, limiter *ratelimit.Limiter, kind string, key string) bool {
+	ok, retryAfter := limiter.Allow(key, time.Now())
+	if ok {
+		return true
+	}
+
+	srv.metrics.rateLimitedRequests.Inc(kind)
+	srv.logger.DebugContext(r.Context(), "Request rate limited", slog.String("kind", kind), slog.String("clientIp", srv.getClientIP(r)), slog.String("retryAfter", retryAfter.String()))
+
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retryAfter.Seconds())))))
+	respondProblem(w, problemDetails{
+		Type:   problemTypePrefix + "rate-limited",
+		Title:  "Too many requests",
+		Status: http.StatusTooManyRequests,
+		Detail: "Too many requests were made in a short time, try again later",
+	})
+	return false
+}
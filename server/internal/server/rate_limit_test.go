@@ -0,0 +1,68 @@
+package server_test
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/bufferutil"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/ratelimit"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/server"
+)
+
+// the credential rate limiter with a burst of 1 tells whether two requests were attributed to the same login
+func TestCredentialRateLimitByLogin(t *testing.T) {
+	encryptionService, err := encryption.NewService(encryption.Key{Id: "1", Value: []byte("g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI="), OwnerHashValue: []byte("owner-g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI=")}, nil, bufferutil.NewBufferPool(8*1024))
+	if err != nil {
+		t.Errorf("Failed to create encryption service: %s", err)
+		return
+	}
+
+	if _, err := server.New(config.Server{}, server.Dependencies{CredentialRateLimiter: &ratelimit.Limiter{}}, slog.New(slog.DiscardHandler)); err == nil {
+		t.Errorf("Expected an error when encryption is missing")
+		return
+	}
+
+	for _, tc := range []struct {
+		name       string
+		second     [2]string
+		sameClient bool
+	}{
+		{name: "same credentials", second: [2]string{"user", "pass"}, sameClient: true},
+		{name: "changed password", second: [2]string{"user", "other-pass"}, sameClient: true},
+		{name: "other login", second: [2]string{"other-user", "pass"}, sameClient: false},
+	} {
+		credentialRateLimiter, err := ratelimit.NewLimiter(1, 1, 10)
+		if err != nil {
+			t.Errorf("Failed to create limiter: %s", err)
+			return
+		}
+
+		srv, err := server.New(config.Server{}, server.Dependencies{
+			CredentialRateLimiter: credentialRateLimiter,
+			Encryption:            encryptionService,
+		}, slog.New(slog.DiscardHandler))
+		if err != nil {
+			t.Errorf("%s: failed to create server: %s", tc.name, err)
+			return
+		}
+
+		// the diff endpoint responds with 404 without calling UEK, since snapshots are disabled
+		statusCodes := []int{}
+		for _, credentials := range [][2]string{{"user", "pass"}, tc.second} {
+			req := httptest.NewRequest(http.MethodGet, "/api/data/schedule-diff", nil)
+			req.SetBasicAuth(credentials[0], credentials[1])
+
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+			statusCodes = append(statusCodes, rec.Code)
+		}
+
+		if sameClient := statusCodes[1] == http.StatusTooManyRequests; sameClient != tc.sameClient {
+			t.Errorf("%s: unexpected status codes: %v", tc.name, statusCodes)
+		}
+	}
+}
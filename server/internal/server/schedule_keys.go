@@ -0,0 +1,79 @@
+package server
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+var errInvalidScheduleKeys = errors.New("invalid schedule keys")
+
+// parseScheduleKeysFromQuery accepts schedules of a single type as type and id params, and schedules of any type as schedule params, e.g. schedule=G:123
+func parseScheduleKeysFromQuery(queryParams url.Values) ([]uekschedule.ScheduleKey, error) {
+	rawScheduleIds, rawScheduleKeys := queryParams["id"], queryParams["schedule"]
+	scheduleKeys := make([]uekschedule.ScheduleKey, 0, len(rawScheduleIds)+len(rawScheduleKeys))
+
+	if len(rawScheduleIds) > 0 {
+		scheduleType := uekschedule.ScheduleType(strings.TrimSpace(queryParams.Get("type")))
+		if !scheduleType.IsValid() {
+			return nil, errInvalidScheduleKeys
+		}
+
+		for _, rawScheduleId := range rawScheduleIds {
+			scheduleId, err := strconv.Atoi(strings.TrimSpace(rawScheduleId))
+			if err != nil {
+				return nil, errInvalidScheduleKeys
+			}
+
+			scheduleKeys = append(scheduleKeys, uekschedule.ScheduleKey{
+				Type: scheduleType,
+				Id:   scheduleId,
+			})
+		}
+	}
+
+	for _, rawScheduleKey := range rawScheduleKeys {
+		scheduleKey, err := uekschedule.ParseScheduleKey(rawScheduleKey)
+		if err != nil {
+			return nil, errInvalidScheduleKeys
+		}
+
+		scheduleKeys = append(scheduleKeys, scheduleKey)
+	}
+
+	if err := validateScheduleKeys(scheduleKeys); err != nil {
+		return nil, err
+	}
+
+	return scheduleKeys, nil
+}
+
+func createScheduleKeys(scheduleType uekschedule.ScheduleType, scheduleIds []int) []uekschedule.ScheduleKey {
+	scheduleKeys := make([]uekschedule.ScheduleKey, 0, len(scheduleIds))
+	for _, scheduleId := range scheduleIds {
+		scheduleKeys = append(scheduleKeys, uekschedule.ScheduleKey{
+			Type: scheduleType,
+			Id:   scheduleId,
+		})
+	}
+
+	return scheduleKeys
+}
+
+func validateScheduleKeys(scheduleKeys []uekschedule.ScheduleKey) error {
+	if len(scheduleKeys) == 0 || len(scheduleKeys) > maxSchedulesPerRequest {
+		return errInvalidScheduleKeys
+	}
+
+	for i, scheduleKey := range scheduleKeys {
+		if scheduleKey.Validate() != nil || slices.Contains(scheduleKeys[:i], scheduleKey) {
+			return errInvalidScheduleKeys
+		}
+	}
+
+	return nil
+}
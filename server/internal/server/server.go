@@ -7,69 +7,209 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/authtoken"
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/bufferutil"
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/freerooms"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/ical"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/icalsubscription"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/metrics"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/ratelimit"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/search"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/snapshot"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/tracing"
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/webhook"
 )
 
 const bufferPoolBaseBuffSize = 32 * 1024
 
 const maxSchedulesPerRequest = 4
 
+const staleSinceHeader = "X-UEKPZ4-Stale-Since"
+
 type Server struct {
 	httpServer                  http.Server
+	metricsHTTPServer           *http.Server
 	uekSchedule                 *uekschedule.Client
+	snapshots                   *snapshot.Service
+	webhooks                    *webhook.Service
+	freeRooms                   *freerooms.Service
+	search                      *search.Service
+	icalSubscriptions           *icalsubscription.Service
 	logger                      *slog.Logger
+	metrics                     *serverMetrics
+	metricsRegistry             *metrics.Registry
+	tracer                      *tracing.Tracer
+	proxyPreset                 string
+	trustedProxies              []netip.Prefix
+	ipRateLimiter               *ratelimit.Limiter
+	credentialRateLimiter       *ratelimit.Limiter
+	readinessProbe              *readinessProbe
 	bufferPool                  *bufferutil.BufferPool
+	tokens                      *authtoken.Service
 	encryption                  *encryption.Service
+	icalEventVersions           *icalEventVersionTracker
+	icalTimeZone                *ical.TimeZone
 	staticAssetPathToMetadata   map[string]staticAssetMetadata
 	staticAssetPathToMetadataMu sync.RWMutex
 }
 
-func New(cfg config.Server, uekScheduleClient *uekschedule.Client, logger *slog.Logger) (*Server, error) {
-	bufferPool := bufferutil.NewBufferPool(bufferPoolBaseBuffSize)
-	encryptionService, err := encryption.NewService([]byte(cfg.EncryptionKey), bufferPool)
+type Dependencies struct {
+	UEKSchedule *uekschedule.Client
+	Tokens      *authtoken.Service
+	// Snapshots is optional, schedule diff endpoint responds with 404 without it
+	Snapshots *snapshot.Service
+	// Webhooks is optional, webhook endpoints respond with 404 without it
+	Webhooks *webhook.Service
+	// FreeRooms is optional, free rooms endpoint responds with 404 without it
+	FreeRooms *freerooms.Service
+	// Search is optional, search endpoint responds with 404 without it
+	Search *search.Service
+	// ICalSubscriptions is optional, iCal subscription endpoints respond with 404 without it
+	ICalSubscriptions *icalsubscription.Service
+	// Store is optional, iCal event versions are forgotten on restart without it
+	Store *filestore.Store
+	// Metrics is optional, nothing is measured without it
+	Metrics *metrics.Registry
+	// Tracer is optional, requests are not traced without it
+	Tracer *tracing.Tracer
+	// IPRateLimiter and CredentialRateLimiter are optional, requests are not limited without them
+	IPRateLimiter         *ratelimit.Limiter
+	CredentialRateLimiter *ratelimit.Limiter
+	// Encryption is only required with CredentialRateLimiter, it hashes logins into rate limit keys
+	Encryption *encryption.Service
+	// BufferPools are reported in metrics by name, next to the pool of the server itself
+	BufferPools map[string]*bufferutil.BufferPool
+}
+
+func New(cfg config.Server, deps Dependencies, logger *slog.Logger) (*Server, error) {
+	icalTimeZone, err := ical.NewEuropeWarsawTimeZone()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create encryption service: %w", err)
+		return nil, fmt.Errorf("failed to create ical time zone: %w", err)
+	}
+
+	trustedProxies, err := parseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trusted proxies: %w", err)
+	}
+
+	if cfg.ProxyPreset != "" && cfg.ProxyPreset != proxyPresetFly {
+		return nil, fmt.Errorf("unknown proxy preset: %s", cfg.ProxyPreset)
+	}
+
+	if deps.CredentialRateLimiter != nil && deps.Encryption == nil {
+		return nil, fmt.Errorf("encryption is required to limit requests per credential")
 	}
 
 	mux := http.NewServeMux()
+	bufferPool := bufferutil.NewBufferPool(bufferPoolBaseBuffSize)
 	srv := &Server{
 		httpServer: http.Server{
 			Addr:              cfg.Addr,
 			ReadHeaderTimeout: 10 * time.Second,
 			WriteTimeout:      30 * time.Second,
 			IdleTimeout:       30 * time.Second,
-			Handler:           mux,
 			ErrorLog:          slog.NewLogLogger(logger.With(slog.String("source", "http.Server")).Handler(), slog.LevelError),
 		},
-		uekSchedule:               uekScheduleClient,
+		uekSchedule:               deps.UEKSchedule,
+		snapshots:                 deps.Snapshots,
+		webhooks:                  deps.Webhooks,
+		freeRooms:                 deps.FreeRooms,
+		search:                    deps.Search,
+		icalSubscriptions:         deps.ICalSubscriptions,
 		logger:                    logger,
+		metricsRegistry:           deps.Metrics,
+		tracer:                    deps.Tracer,
+		proxyPreset:               cfg.ProxyPreset,
+		trustedProxies:            trustedProxies,
+		ipRateLimiter:             deps.IPRateLimiter,
+		credentialRateLimiter:     deps.CredentialRateLimiter,
+		readinessProbe:            &readinessProbe{},
 		bufferPool:                bufferPool,
-		encryption:                encryptionService,
+		tokens:                    deps.Tokens,
+		encryption:                deps.Encryption,
+		icalEventVersions:         newICalEventVersionTracker(deps.Store, logger),
+		icalTimeZone:              icalTimeZone,
 		staticAssetPathToMetadata: map[string]staticAssetMetadata{},
 	}
+	srv.httpServer.Handler = srv.applyInstrumentationMiddleware(mux)
+
+	bufferPools := map[string]*bufferutil.BufferPool{
+		"server": bufferPool,
+	}
+	for poolName, pool := range deps.BufferPools {
+		bufferPools[poolName] = pool
+	}
+	srv.metrics = newServerMetrics(deps.Metrics, bufferPools)
+
+	if cfg.MetricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.HandleFunc("GET /metrics", srv.handleRequestMetrics)
+		srv.metricsHTTPServer = &http.Server{
+			Addr:              cfg.MetricsAddr,
+			ReadHeaderTimeout: 10 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			Handler:           metricsMux,
+			ErrorLog:          srv.httpServer.ErrorLog,
+		}
+	}
 
 	mux.HandleFunc("GET /", srv.applyDebugLoggingMiddleware(srv.handleRequestStaticAsset))
 	mux.HandleFunc("GET /api/", srv.applyDebugLoggingMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		respondNotFound(w)
 	}))
-	mux.HandleFunc("POST /api/auth/encrypt-basic-auth", srv.applyDebugLoggingMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestAuthEncryptBasicAuth)))
-	mux.HandleFunc("GET /api/data/groupings", srv.applyDebugLoggingMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestDataGroupings)))
-	mux.HandleFunc("GET /api/data/headers", srv.applyDebugLoggingMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestDataHeaders)))
-	mux.HandleFunc("GET /api/data/aggregate-schedule", srv.applyDebugLoggingMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestDataAggregateSchedule)))
-	mux.HandleFunc("GET /api/ical/{payload}", srv.applyDebugLoggingMiddleware(srv.handleRequestICal))
+	mux.HandleFunc("GET /healthz", srv.handleRequestHealthz)
+	mux.HandleFunc("GET /readyz", srv.handleRequestReadyz)
+	mux.HandleFunc("GET /api/health", srv.applyDebugLoggingMiddleware(srv.handleRequestHealth))
+	mux.HandleFunc("POST /api/auth/encrypt-basic-auth", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestAuthEncryptBasicAuth))))
+	mux.HandleFunc("POST /api/auth/reencrypt-token", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.handleRequestAuthReencryptToken)))
+	mux.HandleFunc("POST /api/auth/revoke-token", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.handleRequestAuthRevokeToken)))
+	mux.HandleFunc("GET /api/data/groupings", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestDataGroupings))))
+	mux.HandleFunc("GET /api/data/headers", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestDataHeaders))))
+	mux.HandleFunc("GET /api/data/search", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestDataSearch))))
+	mux.HandleFunc("GET /api/data/schedule", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestDataSchedule))))
+	mux.HandleFunc("GET /api/data/schedule-diff", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestDataScheduleDiff))))
+	mux.HandleFunc("GET /api/data/common-free-slots", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestDataCommonFreeSlots))))
+	mux.HandleFunc("GET /api/data/free-rooms", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestDataFreeRooms))))
+	mux.HandleFunc("GET /api/data/aggregate-schedule", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestDataAggregateSchedule))))
+	mux.HandleFunc("GET /api/webhooks", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestWebhooksList))))
+	mux.HandleFunc("POST /api/webhooks", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestWebhooksCreate))))
+	mux.HandleFunc("DELETE /api/webhooks/{id}", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestWebhooksDelete))))
+	mux.HandleFunc("GET /api/ical/{payload}", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.handleRequestICal)))
+	mux.HandleFunc("GET /api/ical/s/{file}", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.handleRequestICalSubscription)))
+	mux.HandleFunc("GET /api/ical/subscriptions", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestICalSubscriptionsList))))
+	mux.HandleFunc("POST /api/ical/subscriptions", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestICalSubscriptionsCreate))))
+	mux.HandleFunc("PUT /api/ical/subscriptions/{slug}", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestICalSubscriptionsUpdate))))
+	mux.HandleFunc("DELETE /api/ical/subscriptions/{slug}", srv.applyDebugLoggingMiddleware(srv.applyRateLimitMiddleware(srv.applyRequireAuthMiddleware(srv.handleRequestICalSubscriptionsDelete))))
 
 	return srv, nil
 }
 
+// Run returns when either the server or the metrics server stops
 func (srv *Server) Run() error {
-	if err := srv.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- listenAndServe(&srv.httpServer)
+	}()
+	if srv.metricsHTTPServer != nil {
+		go func() {
+			errCh <- listenAndServe(srv.metricsHTTPServer)
+		}()
+	}
+
+	return <-errCh
+}
+
+func listenAndServe(httpServer *http.Server) error {
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
 
@@ -77,20 +217,37 @@ func (srv *Server) Run() error {
 }
 
 func (srv *Server) Shutdown(ctx context.Context) error {
-	return srv.httpServer.Shutdown(ctx)
+	if srv.metricsHTTPServer != nil {
+		if err := srv.metricsHTTPServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := srv.httpServer.Shutdown(ctx); err != nil {
+		return err
+	}
+	srv.icalEventVersions.persist(time.Now())
+
+	return nil
+}
+
+// ServeHTTP handles a request like the running server would, without listening
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.httpServer.Handler.ServeHTTP(w, r)
 }
 
 func (srv *Server) extractBasicAuthValueFromRequest(r *http.Request) string {
 	authScheme, authValue, _ := strings.Cut(r.Header.Get("Authorization"), " ")
-	return srv.extractBasicAuthValue(authScheme, authValue)
+	return srv.extractBasicAuthValue(authScheme, authValue, authtoken.AudienceAPI)
 }
 
-func (srv *Server) extractBasicAuthValue(authScheme string, authValue string) string {
+// extractBasicAuthValue only accepts Bearer tokens issued for audience
+func (srv *Server) extractBasicAuthValue(authScheme string, authValue string, audience string) string {
 	switch authScheme {
 	case "Basic":
 		return authValue
 	case "Bearer":
-		if decryptedBasicAuthValue, err := srv.encryption.DecryptText(authValue); err == nil {
+		if decryptedBasicAuthValue, _, err := srv.tokens.Verify(authValue, audience, time.Now()); err == nil {
 			return decryptedBasicAuthValue
 		}
 	}
@@ -98,14 +255,31 @@ func (srv *Server) extractBasicAuthValue(authScheme string, authValue string) st
 	return ""
 }
 
-func getForwaredForWithLastHop(r *http.Request) string {
-	forwardedFor := r.Header.Get("X-Forwarded-For")
-	if forwardedFor == "" {
-		forwardedFor = r.RemoteAddr
-	} else {
-		forwardedFor += ", " + r.RemoteAddr
+// verifyBasicAuth checks credentials with a cheap UEK call, for endpoints that do not call UEK with them on their own
+func (srv *Server) verifyBasicAuth(w http.ResponseWriter, r *http.Request, basicAuthValue string) bool {
+	callParams := srv.createUEKCallParams(r, basicAuthValue)
+	if _, err := srv.uekSchedule.GetGroupings(r.Context(), callParams); err != nil {
+		srv.respondUEKError(w, r, err, "Failed to verify credentials")
+		return false
+	}
+
+	return true
+}
+
+// the client IP is forwarded to UEK, so that UEK can tell users apart
+func (srv *Server) createUEKCallParams(r *http.Request, basicAuthValue string) uekschedule.UEKCallParams {
+	return uekschedule.UEKCallParams{
+		BasicAuthHeaderValue: basicAuthValue,
+		ForwaredForHeader:    srv.getClientIP(r),
+		Staleness:            &uekschedule.Staleness{},
+	}
+}
+
+// setStalenessHeader tells clients that UEK was unavailable and the response was built from data fetched at the given time
+func setStalenessHeader(w http.ResponseWriter, staleness *uekschedule.Staleness) {
+	if fetchedAt := staleness.FetchedAt(); !fetchedAt.IsZero() {
+		w.Header().Set(staleSinceHeader, fetchedAt.UTC().Format(time.RFC3339))
 	}
-	return forwardedFor
 }
 
 func (srv *Server) applyDebugLoggingMiddleware(handler http.HandlerFunc) http.HandlerFunc {
@@ -116,7 +290,7 @@ func (srv *Server) applyDebugLoggingMiddleware(handler http.HandlerFunc) http.Ha
 	return func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
 		handler(w, r)
-		srv.logger.DebugContext(r.Context(), "Request handled", slog.String("url", r.URL.String()), slog.String("proto", r.Proto), slog.String("sourceAddrs", getForwaredForWithLastHop(r)), slog.String("timeTaken", time.Since(startTime).String()))
+		srv.logger.DebugContext(r.Context(), "Request handled", slog.String("url", r.URL.String()), slog.String("proto", r.Proto), slog.String("clientIp", srv.getClientIP(r)), slog.String("timeTaken", time.Since(startTime).String()))
 	}
 }
 
@@ -129,6 +303,10 @@ func (srv *Server) applyRequireAuthMiddleware(handler func(w http.ResponseWriter
 			return
 		}
 
+		if !srv.allowCredentialRequest(w, r, basicAuthValue) {
+			return
+		}
+
 		handler(w, r, basicAuthValue)
 	}
 }
@@ -139,21 +317,21 @@ func respondJSON(w http.ResponseWriter, val any) {
 }
 
 func respondNotFound(w http.ResponseWriter) {
-	http.Error(w, "Not Found", http.StatusNotFound)
+	respondStatusProblem(w, http.StatusNotFound)
 }
 
 func respondBadRequest(w http.ResponseWriter) {
-	http.Error(w, "Bad Request", http.StatusBadRequest)
+	respondStatusProblem(w, http.StatusBadRequest)
 }
 
 func respondUnauthorized(w http.ResponseWriter) {
-	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	respondStatusProblem(w, http.StatusUnauthorized)
 }
 
 func respondInternalServerError(w http.ResponseWriter) {
-	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	respondStatusProblem(w, http.StatusInternalServerError)
 }
 
 func respondServiceUnavailable(w http.ResponseWriter) {
-	http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+	respondStatusProblem(w, http.StatusServiceUnavailable)
 }
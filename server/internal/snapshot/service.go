@@ -0,0 +1,211 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const errPrefix = "snapshot: "
+
+const storeKeyPrefix = "snapshots/"
+
+var ErrNotTracked = errors.New(errPrefix + "schedule is not tracked")
+
+// Service periodically stores snapshots of configured schedules, so that changes between them can be reported
+type Service struct {
+	cfg          config.Snapshot
+	uekSchedule  *uekschedule.Client
+	store        *filestore.Store
+	logger       *slog.Logger
+	scheduleKeys []uekschedule.ScheduleKey
+	callParams   uekschedule.UEKCallParams
+}
+
+type Snapshot struct {
+	TakenAt time.Time `json:"takenAt"`
+	// CheckedAt is the last time the schedule was fetched and found to be identical to this snapshot
+	CheckedAt time.Time                   `json:"checkedAt"`
+	From      time.Time                   `json:"from"`
+	To        time.Time                   `json:"to"`
+	Items     []*uekschedule.ScheduleItem `json:"items"`
+}
+
+type Diff struct {
+	Schedule uekschedule.ScheduleKey `json:"schedule"`
+	From     time.Time               `json:"from"`
+	To       time.Time               `json:"to"`
+	*uekschedule.ScheduleDiff
+}
+
+func NewService(cfg config.Snapshot, uekScheduleClient *uekschedule.Client, store *filestore.Store, logger *slog.Logger) (*Service, error) {
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf(errPrefix + "interval should be greater than 0")
+	}
+
+	if cfg.MaxSnapshots < 2 {
+		return nil, fmt.Errorf(errPrefix + "max snapshots should be at least 2")
+	}
+
+	scheduleKeys := make([]uekschedule.ScheduleKey, 0, len(cfg.Schedules))
+	for _, rawScheduleKey := range cfg.Schedules {
+		scheduleKey, err := uekschedule.ParseScheduleKey(rawScheduleKey)
+		if err != nil {
+			return nil, fmt.Errorf(errPrefix+"%w", err)
+		}
+		scheduleKeys = append(scheduleKeys, scheduleKey)
+	}
+
+	return &Service{
+		cfg:          cfg,
+		uekSchedule:  uekScheduleClient,
+		store:        store,
+		logger:       logger,
+		scheduleKeys: scheduleKeys,
+		callParams: uekschedule.UEKCallParams{
+			BasicAuthHeaderValue: base64.StdEncoding.EncodeToString([]byte(cfg.Credentials)),
+		},
+	}, nil
+}
+
+// Run takes snapshots until ctx is canceled
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.takeSnapshots(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) takeSnapshots(ctx context.Context) {
+	for _, scheduleKey := range s.scheduleKeys {
+		if err := s.takeSnapshot(ctx, scheduleKey); err != nil {
+			if !errors.Is(err, context.Canceled) {
+				s.logger.Error("Failed to take schedule snapshot", slog.String("scheduleKey", scheduleKey.String()), slog.Any("err", err))
+			}
+			continue
+		}
+	}
+}
+
+func (s *Service) takeSnapshot(ctx context.Context, scheduleKey uekschedule.ScheduleKey) error {
+	now := time.Now().In(s.uekSchedule.Location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from, to := today.AddDate(0, 0, -s.cfg.DaysBack), today.AddDate(0, 0, s.cfg.DaysAhead+1)
+
+	schedule, _, err := s.uekSchedule.GetScheduleInRange(ctx, s.callParams, scheduleKey.Type, scheduleKey.Id, from, to)
+	if err != nil {
+		return err
+	}
+
+	snapshots, err := s.getSnapshots(scheduleKey)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshots) > 0 {
+		latestSnapshot := snapshots[len(snapshots)-1]
+		if DiffSnapshots(latestSnapshot, &Snapshot{From: from, To: to, Items: schedule.Items}).IsEmpty() {
+			latestSnapshot.CheckedAt = now
+			return s.store.Put(storeKeyPrefix+scheduleKey.String(), snapshots)
+		}
+	}
+
+	snapshots = append(snapshots, &Snapshot{
+		TakenAt:   now,
+		CheckedAt: now,
+		From:      from,
+		To:        to,
+		Items:     schedule.Items,
+	})
+	if len(snapshots) > s.cfg.MaxSnapshots {
+		snapshots = snapshots[len(snapshots)-s.cfg.MaxSnapshots:]
+	}
+
+	s.logger.Debug("Took schedule snapshot", slog.String("scheduleKey", scheduleKey.String()), slog.Int("itemCount", len(schedule.Items)))
+	return s.store.Put(storeKeyPrefix+scheduleKey.String(), snapshots)
+}
+
+func (s *Service) getSnapshots(scheduleKey uekschedule.ScheduleKey) ([]*Snapshot, error) {
+	snapshots := []*Snapshot{}
+	if _, err := s.store.Get(storeKeyPrefix+scheduleKey.String(), &snapshots); err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+// GetDiff compares the latest snapshot with the newest one taken at or before since, or with the one before it if since is zero
+func (s *Service) GetDiff(scheduleKey uekschedule.ScheduleKey, since time.Time) (*Diff, error) {
+	if !slices.Contains(s.scheduleKeys, scheduleKey) {
+		return nil, ErrNotTracked
+	}
+
+	snapshots, err := s.getSnapshots(scheduleKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(snapshots) == 0 {
+		return nil, ErrNotTracked
+	}
+
+	latestSnapshot := snapshots[len(snapshots)-1]
+	baseSnapshot := snapshots[0]
+	if since.IsZero() {
+		baseSnapshot = snapshots[max(len(snapshots)-2, 0)]
+	} else {
+		for _, snapshot := range snapshots[1:] {
+			if snapshot.TakenAt.After(since) {
+				break
+			}
+			baseSnapshot = snapshot
+		}
+	}
+
+	return &Diff{
+		Schedule:     scheduleKey,
+		From:         baseSnapshot.TakenAt,
+		To:           latestSnapshot.TakenAt,
+		ScheduleDiff: DiffSnapshots(baseSnapshot, latestSnapshot),
+	}, nil
+}
+
+// DiffSnapshots only compares the part of schedule covered by both snapshots, so that classes going out of range are not reported as removed
+func DiffSnapshots(before *Snapshot, after *Snapshot) *uekschedule.ScheduleDiff {
+	from, to := before.From, before.To
+	if after.From.After(from) {
+		from = after.From
+	}
+	if after.To.Before(to) {
+		to = after.To
+	}
+
+	return uekschedule.DiffScheduleItems(filterItemsInRange(before.Items, from, to), filterItemsInRange(after.Items, from, to))
+}
+
+func filterItemsInRange(items []*uekschedule.ScheduleItem, from time.Time, to time.Time) []*uekschedule.ScheduleItem {
+	filteredItems := make([]*uekschedule.ScheduleItem, 0, len(items))
+	for _, item := range items {
+		if item.End.After(from) && item.Start.Before(to) {
+			filteredItems = append(filteredItems, item)
+		}
+	}
+
+	return filteredItems
+}
@@ -0,0 +1,182 @@
+package snapshot_test
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/snapshot"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+var testScheduleKey = uekschedule.ScheduleKey{Type: uekschedule.ScheduleTypeGroup, Id: 1}
+
+var testDay = time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+
+func createTestItem(day int, subject string) *uekschedule.ScheduleItem {
+	start := testDay.AddDate(0, 0, day).Add(8 * time.Hour)
+	return &uekschedule.ScheduleItem{
+		Start:   start,
+		End:     start.Add(90 * time.Minute),
+		Subject: subject,
+		Type:    "wykład",
+	}
+}
+
+func createTestService(store *filestore.Store) (*snapshot.Service, error) {
+	uekClient, err := uekschedule.NewClient(&http.Client{}, slog.New(slog.DiscardHandler), config.UEK{
+		MaxConcurrentRequests: 1,
+	}, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshot.NewService(config.Snapshot{
+		Schedules:    []string{testScheduleKey.String()},
+		Interval:     time.Hour,
+		MaxSnapshots: 10,
+	}, uekClient, store, slog.New(slog.DiscardHandler))
+}
+
+func getSubjects(items []*uekschedule.ScheduleItem) []string {
+	subjects := make([]string, 0, len(items))
+	for _, item := range items {
+		subjects = append(subjects, item.Subject)
+	}
+
+	return subjects
+}
+
+func TestDiffSnapshotsOnlyComparesOverlappingRange(t *testing.T) {
+	before := &snapshot.Snapshot{
+		From:  testDay,
+		To:    testDay.AddDate(0, 0, 14),
+		Items: []*uekschedule.ScheduleItem{createTestItem(1, "Algebra"), createTestItem(9, "Analiza")},
+	}
+	after := &snapshot.Snapshot{
+		From:  testDay.AddDate(0, 0, 4),
+		To:    testDay.AddDate(0, 0, 19),
+		Items: []*uekschedule.ScheduleItem{createTestItem(9, "Analiza"), createTestItem(17, "Statystyka")},
+	}
+
+	if diff := snapshot.DiffSnapshots(before, after); !diff.IsEmpty() {
+		t.Errorf("Classes outside of the range of either snapshot should not be reported, got: %+v", diff)
+		return
+	}
+
+	after.Items = append(after.Items, createTestItem(11, "Ekonomia"))
+	diff := snapshot.DiffSnapshots(before, after)
+	if len(diff.Added) != 1 || diff.Added[0].Subject != "Ekonomia" || len(diff.Removed) != 0 || len(diff.Modified) != 0 {
+		t.Errorf("Class added in the overlapping range should be reported, got: %+v", diff)
+		return
+	}
+}
+
+func TestGetDiffChoosesSnapshotAtOrBeforeSince(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+
+	service, err := createTestService(store)
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+
+	snapshots := []*snapshot.Snapshot{}
+	subjects := []string{"Algebra", "Analiza", "Ekonomia"}
+	for i := range subjects {
+		items := []*uekschedule.ScheduleItem{}
+		for _, subject := range subjects[:i+1] {
+			items = append(items, createTestItem(1, subject))
+		}
+		snapshots = append(snapshots, &snapshot.Snapshot{
+			TakenAt:   testDay.AddDate(0, 0, i),
+			CheckedAt: testDay.AddDate(0, 0, i),
+			From:      testDay,
+			To:        testDay.AddDate(0, 0, 14),
+			Items:     items,
+		})
+	}
+	if err := store.Put("snapshots/"+testScheduleKey.String(), snapshots); err != nil {
+		t.Errorf("Failed to store snapshots: %s", err)
+		return
+	}
+
+	for _, tc := range []struct {
+		name         string
+		since        time.Time
+		wantFrom     time.Time
+		wantSubjects []string
+	}{
+		{name: "zero", since: time.Time{}, wantFrom: snapshots[1].TakenAt, wantSubjects: []string{"Ekonomia"}},
+		{name: "before first", since: testDay.Add(-time.Hour), wantFrom: snapshots[0].TakenAt, wantSubjects: []string{"Analiza", "Ekonomia"}},
+		{name: "at first", since: snapshots[0].TakenAt, wantFrom: snapshots[0].TakenAt, wantSubjects: []string{"Analiza", "Ekonomia"}},
+		{name: "between", since: snapshots[0].TakenAt.Add(12 * time.Hour), wantFrom: snapshots[0].TakenAt, wantSubjects: []string{"Analiza", "Ekonomia"}},
+		{name: "at second", since: snapshots[1].TakenAt, wantFrom: snapshots[1].TakenAt, wantSubjects: []string{"Ekonomia"}},
+		{name: "after latest", since: snapshots[2].TakenAt.Add(time.Hour), wantFrom: snapshots[2].TakenAt, wantSubjects: []string{}},
+	} {
+		diff, err := service.GetDiff(testScheduleKey, tc.since)
+		if err != nil {
+			t.Errorf("%s: failed to get diff: %s", tc.name, err)
+			return
+		}
+
+		if !diff.From.Equal(tc.wantFrom) || !diff.To.Equal(snapshots[2].TakenAt) {
+			t.Errorf("%s: unexpected compared snapshots, got: %s - %s, want: %s - %s", tc.name, diff.From, diff.To, tc.wantFrom, snapshots[2].TakenAt)
+			return
+		}
+
+		if gotSubjects := getSubjects(diff.Added); !slices.Equal(gotSubjects, tc.wantSubjects) || len(diff.Removed) != 0 || len(diff.Modified) != 0 {
+			t.Errorf("%s: unexpected diff, got added: %v, want: %v", tc.name, gotSubjects, tc.wantSubjects)
+			return
+		}
+	}
+}
+
+func TestGetDiffWithoutSnapshots(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+
+	service, err := createTestService(store)
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+
+	if _, err := service.GetDiff(testScheduleKey, time.Time{}); !errors.Is(err, snapshot.ErrNotTracked) {
+		t.Errorf("Schedule without snapshots should be reported as not tracked, got err: %v", err)
+		return
+	}
+
+	if _, err := service.GetDiff(uekschedule.ScheduleKey{Type: uekschedule.ScheduleTypeGroup, Id: 2}, time.Time{}); !errors.Is(err, snapshot.ErrNotTracked) {
+		t.Errorf("Schedule that is not configured should be reported as not tracked, got err: %v", err)
+		return
+	}
+
+	if err := store.Put("snapshots/"+testScheduleKey.String(), []*snapshot.Snapshot{{
+		TakenAt: testDay,
+		From:    testDay,
+		To:      testDay.AddDate(0, 0, 14),
+		Items:   []*uekschedule.ScheduleItem{createTestItem(1, "Algebra")},
+	}}); err != nil {
+		t.Errorf("Failed to store snapshot: %s", err)
+		return
+	}
+
+	diff, err := service.GetDiff(testScheduleKey, time.Time{})
+	if err != nil || !diff.IsEmpty() || !diff.From.Equal(testDay) || !diff.To.Equal(testDay) {
+		t.Errorf("Only snapshot should be compared with itself, got: %+v, err: %v", diff, err)
+		return
+	}
+}
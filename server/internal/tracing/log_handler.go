@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogHandler adds ids of the current span to records logged with a context, so that logs can be matched with traces
+type LogHandler struct {
+	slog.Handler
+}
+
+func NewLogHandler(handler slog.Handler) *LogHandler {
+	return &LogHandler{
+		Handler: handler,
+	}
+}
+
+func (h *LogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if spanContext := SpanFromContext(ctx).SpanContext(); spanContext.IsValid() {
+		record = record.Clone()
+		record.AddAttrs(slog.String("traceId", spanContext.TraceID.String()), slog.String("spanId", spanContext.SpanID.String()))
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return NewLogHandler(h.Handler.WithAttrs(attrs))
+}
+
+func (h *LogHandler) WithGroup(name string) slog.Handler {
+	return NewLogHandler(h.Handler.WithGroup(name))
+}
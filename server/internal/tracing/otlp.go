@@ -0,0 +1,280 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const errPrefix = "tracing: "
+
+const otlpMaxBatchSize = 512
+
+// otlpMaxQueueSize bounds memory use while the collector is unreachable, spans past it are dropped
+const otlpMaxQueueSize = 4 * otlpMaxBatchSize
+
+// OTLPExporter sends spans in batches to an OpenTelemetry collector, using the OTLP/HTTP protocol with JSON encoding
+type OTLPExporter struct {
+	httpClient    *http.Client
+	tracesUrl     string
+	serviceName   string
+	flushInterval time.Duration
+	logger        *slog.Logger
+	mu            sync.Mutex
+	queue         []SpanData
+	droppedCount  int
+	flushCh       chan struct{}
+}
+
+// endpoint is the base url of the collector, like http://localhost:4318
+func NewOTLPExporter(httpClient *http.Client, endpoint string, serviceName string, flushInterval time.Duration, logger *slog.Logger) (*OTLPExporter, error) {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		return nil, fmt.Errorf(errPrefix+"otlp endpoint should be an http or https url: %s", endpoint)
+	}
+
+	if flushInterval <= 0 {
+		return nil, fmt.Errorf(errPrefix + "flush interval should be greater than 0")
+	}
+
+	return &OTLPExporter{
+		httpClient:    httpClient,
+		tracesUrl:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		serviceName:   serviceName,
+		flushInterval: flushInterval,
+		logger:        logger,
+		flushCh:       make(chan struct{}, 1),
+	}, nil
+}
+
+func (e *OTLPExporter) Export(spanData SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.queue) >= otlpMaxQueueSize {
+		e.droppedCount++
+		return
+	}
+
+	e.queue = append(e.queue, spanData)
+	if len(e.queue) >= otlpMaxBatchSize {
+		select {
+		case e.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run sends queued spans every flush interval until ctx is canceled, and then once more
+func (e *OTLPExporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancelFlushCtx := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancelFlushCtx()
+			if err := e.Flush(flushCtx); err != nil {
+				e.logger.Warn("Failed to export spans on shutdown", slog.Any("err", err))
+			}
+			return
+		case <-ticker.C:
+		case <-e.flushCh:
+		}
+
+		if err := e.Flush(ctx); err != nil && ctx.Err() == nil {
+			e.logger.Warn("Failed to export spans", slog.Any("err", err))
+		}
+	}
+}
+
+// Flush sends all queued spans, spans of a failed batch are not retried
+func (e *OTLPExporter) Flush(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		batch := e.queue[:min(len(e.queue), otlpMaxBatchSize)]
+		e.queue = e.queue[len(batch):]
+		droppedCount := e.droppedCount
+		e.droppedCount = 0
+		e.mu.Unlock()
+
+		if droppedCount > 0 {
+			e.logger.Warn("Dropped spans because the export queue was full", slog.Int("droppedCount", droppedCount))
+		}
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := e.send(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *OTLPExporter) send(ctx context.Context, batch []SpanData) error {
+	reqBody, err := json.Marshal(e.createRequestBody(batch))
+	if err != nil {
+		return fmt.Errorf(errPrefix+"failed to encode spans: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.tracesUrl, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf(errPrefix+"failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf(errPrefix+"failed to do request: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf(errPrefix+"unexpected status code: %d", res.StatusCode)
+	}
+
+	return nil
+}
+
+// the types below mirror the JSON mapping of ExportTraceServiceRequest, in which ids are hex strings and 64 bit integers are decimal strings
+
+type otlpRequestBody struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindServer   = 2
+	otlpSpanKindClient   = 3
+	otlpStatusCodeError  = 2
+)
+
+func (e *OTLPExporter) createRequestBody(batch []SpanData) *otlpRequestBody {
+	resourceSpans := otlpResourceSpans{}
+	resourceSpans.Resource.Attributes = []otlpAttribute{createOTLPAttribute(slog.String("service.name", e.serviceName))}
+
+	scopeSpans := otlpScopeSpans{
+		Spans: make([]otlpSpan, 0, len(batch)),
+	}
+	scopeSpans.Scope.Name = e.serviceName
+
+	for _, spanData := range batch {
+		span := otlpSpan{
+			TraceId:           spanData.SpanContext.TraceID.String(),
+			SpanId:            spanData.SpanContext.SpanID.String(),
+			Name:              spanData.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(spanData.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(spanData.EndTime.UnixNano(), 10),
+		}
+
+		switch spanData.Kind {
+		case SpanKindServer:
+			span.Kind = otlpSpanKindServer
+		case SpanKindClient:
+			span.Kind = otlpSpanKindClient
+		}
+
+		if spanData.ParentSpanID.IsValid() {
+			span.ParentSpanId = spanData.ParentSpanID.String()
+		}
+
+		for _, attr := range spanData.Attrs {
+			span.Attributes = append(span.Attributes, createOTLPAttribute(attr))
+		}
+
+		if spanData.Err != nil {
+			span.Status = &otlpStatus{
+				Code:    otlpStatusCodeError,
+				Message: spanData.Err.Error(),
+			}
+		}
+
+		scopeSpans.Spans = append(scopeSpans.Spans, span)
+	}
+	resourceSpans.ScopeSpans = []otlpScopeSpans{scopeSpans}
+
+	return &otlpRequestBody{
+		ResourceSpans: []otlpResourceSpans{resourceSpans},
+	}
+}
+
+func createOTLPAttribute(attr slog.Attr) otlpAttribute {
+	value := attr.Value.Resolve()
+	otlpAttr := otlpAttribute{
+		Key: attr.Key,
+	}
+
+	switch value.Kind() {
+	case slog.KindBool:
+		boolValue := value.Bool()
+		otlpAttr.Value.BoolValue = &boolValue
+	case slog.KindInt64:
+		intValue := strconv.FormatInt(value.Int64(), 10)
+		otlpAttr.Value.IntValue = &intValue
+	case slog.KindUint64:
+		intValue := strconv.FormatUint(value.Uint64(), 10)
+		otlpAttr.Value.IntValue = &intValue
+	case slog.KindFloat64:
+		doubleValue := value.Float64()
+		otlpAttr.Value.DoubleValue = &doubleValue
+	default:
+		stringValue := value.String()
+		otlpAttr.Value.StringValue = &stringValue
+	}
+
+	return otlpAttr
+}
@@ -0,0 +1,74 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/tracing"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	var received struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceId      string `json:"traceId"`
+					SpanId       string `json:"spanId"`
+					ParentSpanId string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Kind         int    `json:"kind"`
+					Attributes   []struct {
+						Key   string `json:"key"`
+						Value struct {
+							IntValue string `json:"intValue"`
+						} `json:"value"`
+					} `json:"attributes"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer collector.Close()
+
+	exporter, err := tracing.NewOTLPExporter(collector.Client(), collector.URL+"/", "test", time.Minute, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Errorf("Failed to create exporter: %s", err)
+		return
+	}
+
+	tracer := tracing.NewTracer(slog.New(slog.DiscardHandler), false, exporter)
+	ctx, rootSpan := tracer.StartRootSpan(context.Background(), "root", tracing.SpanKindServer, tracing.SpanContext{})
+	_, childSpan := tracing.StartSpan(ctx, "child", tracing.SpanKindClient, slog.Int("http.response.status_code", 200))
+	childSpan.End()
+	rootSpan.End()
+
+	if err := exporter.Flush(context.Background()); err != nil {
+		t.Errorf("Failed to flush spans: %s", err)
+		return
+	}
+
+	if len(received.ResourceSpans) != 1 || len(received.ResourceSpans[0].ScopeSpans) != 1 || len(received.ResourceSpans[0].ScopeSpans[0].Spans) != 2 {
+		t.Errorf("Unexpected request body: %+v", received)
+		return
+	}
+
+	child := received.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if child.Name != "child" || child.Kind != 3 || child.TraceId != rootSpan.SpanContext().TraceID.String() || child.ParentSpanId != rootSpan.SpanContext().SpanID.String() {
+		t.Errorf("Unexpected child span: %+v", child)
+	}
+	if len(child.Attributes) != 1 || child.Attributes[0].Value.IntValue != "200" {
+		t.Errorf("Unexpected child span attributes: %+v", child.Attributes)
+	}
+}
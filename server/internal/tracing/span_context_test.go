@@ -0,0 +1,36 @@
+package tracing_test
+
+import (
+	"testing"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/tracing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	for _, tc := range []struct {
+		traceparent string
+		ok          bool
+		sampled     bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true, true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", false, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false, false},
+		{"", false, false},
+	} {
+		spanContext, ok := tracing.ParseTraceparent(tc.traceparent)
+		if ok != tc.ok || spanContext.Sampled != tc.sampled {
+			t.Errorf("Unexpected result for %q, got: %+v, %t", tc.traceparent, spanContext, ok)
+			continue
+		}
+
+		if ok && tc.traceparent[:2] == "00" && spanContext.Traceparent() != tc.traceparent {
+			t.Errorf("Traceparent did not round trip, got: %s, want: %s", spanContext.Traceparent(), tc.traceparent)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = iota
+	SpanKindServer
+	SpanKindClient
+)
+
+// SpanData is a finished span, as handed to exporters
+type SpanData struct {
+	Name         string
+	Kind         SpanKind
+	SpanContext  SpanContext
+	ParentSpanID SpanID
+	StartTime    time.Time
+	EndTime      time.Time
+	Attrs        []slog.Attr
+	Err          error
+}
+
+type Exporter interface {
+	// Export must not block, it is called when a span ends
+	Export(spanData SpanData)
+}
+
+// Tracer starts root spans, child spans are started with StartSpan from the context of their parent. A nil tracer starts no spans
+type Tracer struct {
+	logger   *slog.Logger
+	logSpans bool
+	exporter Exporter
+}
+
+// exporter is optional, spans are only logged without it
+func NewTracer(logger *slog.Logger, logSpans bool, exporter Exporter) *Tracer {
+	return &Tracer{
+		logger:   logger,
+		logSpans: logSpans,
+		exporter: exporter,
+	}
+}
+
+// Span is safe for concurrent use, all methods do nothing on a nil span
+type Span struct {
+	tracer *Tracer
+	data   SpanData
+	mu     sync.Mutex
+	ended  bool
+}
+
+type spanContextKey struct{}
+
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// StartRootSpan continues the trace of remoteParent if it is valid, or starts a new one
+func (t *Tracer) StartRootSpan(ctx context.Context, name string, kind SpanKind, remoteParent SpanContext, attrs ...slog.Attr) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	spanContext := SpanContext{
+		TraceID: newTraceID(),
+		SpanID:  newSpanID(),
+		Sampled: true,
+	}
+	var parentSpanID SpanID
+	if remoteParent.IsValid() {
+		spanContext.TraceID = remoteParent.TraceID
+		spanContext.Sampled = remoteParent.Sampled
+		parentSpanID = remoteParent.SpanID
+	}
+
+	return t.startSpan(ctx, name, kind, spanContext, parentSpanID, attrs)
+}
+
+// StartSpan starts a child of the span in ctx, there is nothing to trace if there is none
+func StartSpan(ctx context.Context, name string, kind SpanKind, attrs ...slog.Attr) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	return parent.tracer.startSpan(ctx, name, kind, SpanContext{
+		TraceID: parent.data.SpanContext.TraceID,
+		SpanID:  newSpanID(),
+		Sampled: parent.data.SpanContext.Sampled,
+	}, parent.data.SpanContext.SpanID, attrs)
+}
+
+func (t *Tracer) startSpan(ctx context.Context, name string, kind SpanKind, spanContext SpanContext, parentSpanID SpanID, attrs []slog.Attr) (context.Context, *Span) {
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:         name,
+			Kind:         kind,
+			SpanContext:  spanContext,
+			ParentSpanID: parentSpanID,
+			StartTime:    time.Now(),
+			Attrs:        attrs,
+		},
+	}
+
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.data.SpanContext
+}
+
+// SetName is for spans which are named after something known only once the work started, like the route of a request
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.data.Name = name
+	s.mu.Unlock()
+}
+
+func (s *Span) SetAttrs(attrs ...slog.Attr) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.data.Attrs = append(s.data.Attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed, nil errors are ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.data.Err = err
+	s.mu.Unlock()
+}
+
+// End logs and exports the span if it is sampled, only the first call does anything
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	spanData := s.data
+	spanData.Attrs = slices.Clone(spanData.Attrs)
+	s.mu.Unlock()
+
+	if !spanData.SpanContext.Sampled {
+		return
+	}
+
+	if s.tracer.logSpans {
+		logAttrs := []slog.Attr{
+			slog.String("name", spanData.Name),
+			slog.String("traceId", spanData.SpanContext.TraceID.String()),
+			slog.String("spanId", spanData.SpanContext.SpanID.String()),
+			slog.String("timeTaken", spanData.EndTime.Sub(spanData.StartTime).String()),
+		}
+		if spanData.ParentSpanID.IsValid() {
+			logAttrs = append(logAttrs, slog.String("parentSpanId", spanData.ParentSpanID.String()))
+		}
+		if len(spanData.Attrs) > 0 {
+			logAttrs = append(logAttrs, slog.Any("attrs", slog.GroupValue(spanData.Attrs...)))
+		}
+		if spanData.Err != nil {
+			logAttrs = append(logAttrs, slog.Any("err", spanData.Err))
+		}
+		s.tracer.logger.LogAttrs(context.Background(), slog.LevelInfo, "Span ended", logAttrs...)
+	}
+
+	if s.tracer.exporter != nil {
+		s.tracer.exporter.Export(spanData)
+	}
+}
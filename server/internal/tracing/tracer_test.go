@@ -0,0 +1,75 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/tracing"
+)
+
+type collectingExporter struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (e *collectingExporter) Export(spanData tracing.SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.spans = append(e.spans, spanData)
+}
+
+func TestSpansFormTrace(t *testing.T) {
+	exporter := &collectingExporter{}
+	tracer := tracing.NewTracer(slog.New(slog.DiscardHandler), false, exporter)
+
+	remoteParent, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, rootSpan := tracer.StartRootSpan(context.Background(), "root", tracing.SpanKindServer, remoteParent)
+	_, childSpan := tracing.StartSpan(ctx, "child", tracing.SpanKindClient, slog.Int("attempt", 1))
+	childSpan.RecordError(errors.New("failed"))
+	childSpan.End()
+	childSpan.End()
+	rootSpan.End()
+
+	if len(exporter.spans) != 2 {
+		t.Errorf("Unexpected exported span count, got: %d, want: %d", len(exporter.spans), 2)
+		return
+	}
+
+	child, root := exporter.spans[0], exporter.spans[1]
+	if root.SpanContext.TraceID != remoteParent.TraceID || root.ParentSpanID != remoteParent.SpanID {
+		t.Errorf("Root span does not continue the remote trace: %+v", root)
+	}
+	if child.SpanContext.TraceID != remoteParent.TraceID || child.ParentSpanID != root.SpanContext.SpanID || child.SpanContext.SpanID == root.SpanContext.SpanID {
+		t.Errorf("Child span is not a child of the root span: %+v", child)
+	}
+	if child.Err == nil || len(child.Attrs) != 1 || child.EndTime.Before(child.StartTime) {
+		t.Errorf("Unexpected child span data: %+v", child)
+	}
+}
+
+func TestUnsampledAndMissingTracesAreNotExported(t *testing.T) {
+	exporter := &collectingExporter{}
+	tracer := tracing.NewTracer(slog.New(slog.DiscardHandler), false, exporter)
+
+	remoteParent, _ := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	ctx, rootSpan := tracer.StartRootSpan(context.Background(), "root", tracing.SpanKindServer, remoteParent)
+	_, childSpan := tracing.StartSpan(ctx, "child", tracing.SpanKindInternal)
+	childSpan.End()
+	rootSpan.End()
+
+	// without a span in the context, there is nothing to attach to
+	_, orphanSpan := tracing.StartSpan(context.Background(), "orphan", tracing.SpanKindInternal)
+	orphanSpan.End()
+
+	var nilTracer *tracing.Tracer
+	_, nilTracerSpan := nilTracer.StartRootSpan(context.Background(), "root", tracing.SpanKindServer, tracing.SpanContext{})
+	nilTracerSpan.End()
+
+	if len(exporter.spans) != 0 || orphanSpan != nil || nilTracerSpan != nil {
+		t.Errorf("Unexpected spans: %+v", exporter.spans)
+	}
+}
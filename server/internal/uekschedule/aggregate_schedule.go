@@ -2,24 +2,30 @@ package uekschedule
 
 import (
 	"context"
+	"log/slog"
 	"slices"
 
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/tracing"
 	"golang.org/x/sync/errgroup"
 )
 
 type AggregateSchedule struct {
-	Headers []ScheduleHeader `json:"headers"`
-	Items   []*ScheduleItem  `json:"items"`
+	Headers   []ScheduleHeader   `json:"headers"`
+	Items     []*ScheduleItem    `json:"items"`
+	Conflicts []ScheduleConflict `json:"conflicts"`
 }
 
-func (c *Client) GetAggregateSchedule(ctx context.Context, callParams UEKCallParams, scheduleType ScheduleType, scheduleIds []int, periodIdx int) (*AggregateSchedule, []SchedulePeriod, error) {
-	singleSchedules := make([]*Schedule, len(scheduleIds))
+func (c *Client) GetAggregateSchedule(ctx context.Context, callParams UEKCallParams, scheduleKeys []ScheduleKey, periodSelection PeriodSelection) (*AggregateSchedule, []SchedulePeriod, error) {
+	ctx, span := tracing.StartSpan(ctx, "uekschedule.GetAggregateSchedule", tracing.SpanKindInternal, slog.Int("scheduleCount", len(scheduleKeys)))
+	defer span.End()
+
+	singleSchedules := make([]*Schedule, len(scheduleKeys))
 	var periods []SchedulePeriod
 
 	eg, egCtx := errgroup.WithContext(ctx)
-	for i, scheduleId := range scheduleIds {
+	for i, scheduleKey := range scheduleKeys {
 		eg.Go(func() error {
-			schedule, p, err := c.GetSchedule(egCtx, callParams, scheduleType, scheduleId, periodIdx)
+			schedule, p, err := c.getScheduleForPeriodSelection(egCtx, callParams, scheduleKey.Type, scheduleKey.Id, periodSelection)
 			if err != nil {
 				return err
 			}
@@ -34,14 +40,18 @@ func (c *Client) GetAggregateSchedule(ctx context.Context, callParams UEKCallPar
 	}
 
 	if err := eg.Wait(); err != nil {
+		span.RecordError(err)
 		return nil, nil, err
 	}
 
-	return mergeSchedules(singleSchedules), periods, nil
+	aggregateSchedule, itemSources := mergeSchedules(singleSchedules)
+	aggregateSchedule.Conflicts = detectConflicts(aggregateSchedule.Items, itemSources)
+
+	return aggregateSchedule, periods, nil
 }
 
-// sorted lists merge + deduping without additional sorting
-func mergeSchedules(singleSchedules []*Schedule) *AggregateSchedule {
+// sorted lists merge + deduping without additional sorting, conflicts are left for the caller to detect using the returned item sources
+func mergeSchedules(singleSchedules []*Schedule) (*AggregateSchedule, []uint64) {
 	headers := make([]ScheduleHeader, 0, len(singleSchedules))
 	totalItemCount := 0
 	for _, schedule := range singleSchedules {
@@ -50,6 +60,8 @@ func mergeSchedules(singleSchedules []*Schedule) *AggregateSchedule {
 	}
 
 	items := make([]*ScheduleItem, 0, totalItemCount)
+	// itemSources are bitmasks of schedules each item came from, for conflict detection. Schedules past the 64th share bits, which can only hide conflicts
+	itemSources := make([]uint64, 0, totalItemCount)
 	currentItemIndexesBySchedule := make([]int, len(singleSchedules))
 	for {
 		var nextItem *ScheduleItem
@@ -73,25 +85,29 @@ func mergeSchedules(singleSchedules []*Schedule) *AggregateSchedule {
 		}
 		currentItemIndexesBySchedule[nextItemScheduleIndex]++
 
-		previousItemIndex := len(items) - 1
-		if previousItemIndex > -1 && nextItem.EqualIgnoringGroups(items[previousItemIndex]) {
-			mergedItem := items[previousItemIndex].ShallowCopy()
-			mergedItem.Groups = append(make([]string, 0, len(mergedItem.Groups)+len(nextItem.Groups)), mergedItem.Groups...)
-			for _, nextItemGroup := range nextItem.Groups {
-				if !slices.Contains(mergedItem.Groups, nextItemGroup) {
-					mergedItem.Groups = append(mergedItem.Groups, nextItemGroup)
-				}
+		// items describing the same class from different schedules are not necessarily next to each other, but they always compare as equal
+		mergeableItemIndex := -1
+		for i := len(items) - 1; i > -1 && items[i].Compare(nextItem) == 0; i-- {
+			if items[i].IsSameClass(nextItem) {
+				mergeableItemIndex = i
+				break
 			}
-			items[previousItemIndex] = mergedItem
+		}
+
+		nextItemSource := uint64(1) << (nextItemScheduleIndex % 64)
+		if mergeableItemIndex > -1 {
+			items[mergeableItemIndex] = items[mergeableItemIndex].mergeWith(nextItem)
+			itemSources[mergeableItemIndex] |= nextItemSource
 		} else {
 			items = append(items, nextItem)
+			itemSources = append(itemSources, nextItemSource)
 		}
 	}
 
 	return &AggregateSchedule{
 		Headers: headers,
 		Items:   items,
-	}
+	}, itemSources
 }
 
 func (a *ScheduleItem) EqualIgnoringGroups(b *ScheduleItem) bool {
@@ -112,16 +128,85 @@ func (a *ScheduleItem) EqualIgnoringGroups(b *ScheduleItem) bool {
 	return true
 }
 
+// IsSameClass is like EqualIgnoringGroups, but also matches items of the same class coming from schedules of different types
+func (a *ScheduleItem) IsSameClass(b *ScheduleItem) bool {
+	if !a.lecturersIncomplete && !b.lecturersIncomplete {
+		return a.EqualIgnoringGroups(b)
+	}
+
+	if !a.Start.Equal(b.Start) || !a.End.Equal(b.End) || a.Subject != b.Subject || a.Type != b.Type || a.Extra != b.Extra {
+		return false
+	}
+
+	// room schedules never include links to online rooms
+	if a.RoomName != b.RoomName || (a.RoomUrl != b.RoomUrl && a.RoomUrl != "" && b.RoomUrl != "") {
+		return false
+	}
+
+	// two lecturer schedules can both describe a class taught together, otherwise the lecturer has to be one of the listed ones
+	if a.lecturersIncomplete && b.lecturersIncomplete {
+		return true
+	}
+
+	incompleteItem, completeItem := a, b
+	if b.lecturersIncomplete {
+		incompleteItem, completeItem = b, a
+	}
+
+	for _, lecturer := range incompleteItem.Lecturers {
+		if !slices.ContainsFunc(completeItem.Lecturers, func(other ScheduleItemLecturer) bool {
+			return other.Name == lecturer.Name
+		}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mergeWith returns a copy of the item, with everything b knows about the class that a does not
+func (a *ScheduleItem) mergeWith(b *ScheduleItem) *ScheduleItem {
+	mergedItem := a.ShallowCopy()
+
+	mergedItem.Groups = append(make([]string, 0, len(a.Groups)+len(b.Groups)), a.Groups...)
+	for _, group := range b.Groups {
+		if !slices.Contains(mergedItem.Groups, group) {
+			mergedItem.Groups = append(mergedItem.Groups, group)
+		}
+	}
+
+	if mergedItem.RoomUrl == "" {
+		mergedItem.RoomUrl = b.RoomUrl
+	}
+
+	if a.lecturersIncomplete && !b.lecturersIncomplete {
+		mergedItem.Lecturers = b.Lecturers
+		mergedItem.lecturersIncomplete = false
+	} else if a.lecturersIncomplete && b.lecturersIncomplete {
+		mergedItem.Lecturers = append(make([]ScheduleItemLecturer, 0, len(a.Lecturers)+len(b.Lecturers)), a.Lecturers...)
+		for _, lecturer := range b.Lecturers {
+			if !slices.ContainsFunc(mergedItem.Lecturers, func(other ScheduleItemLecturer) bool {
+				return other.Name == lecturer.Name
+			}) {
+				mergedItem.Lecturers = append(mergedItem.Lecturers, lecturer)
+			}
+		}
+	}
+
+	return mergedItem
+}
+
 func (item *ScheduleItem) ShallowCopy() *ScheduleItem {
 	return &ScheduleItem{
-		Start:     item.Start,
-		End:       item.End,
-		Subject:   item.Subject,
-		Type:      item.Type,
-		Groups:    item.Groups,
-		Lecturers: item.Lecturers,
-		RoomName:  item.RoomName,
-		RoomUrl:   item.RoomUrl,
-		Extra:     item.Extra,
+		Start:               item.Start,
+		End:                 item.End,
+		Subject:             item.Subject,
+		Type:                item.Type,
+		Groups:              item.Groups,
+		Lecturers:           item.Lecturers,
+		RoomName:            item.RoomName,
+		RoomUrl:             item.RoomUrl,
+		Extra:               item.Extra,
+		lecturersIncomplete: item.lecturersIncomplete,
 	}
 }
@@ -0,0 +1,123 @@
+package uekschedule_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+// newFixtureTestClient creates a client calling UEK which responds with schedules by schedule key
+func newFixtureTestClient(schedules map[string]string) (*uekschedule.Client, error) {
+	return newTestClient(&testRoundTripper{schedules: schedules}, config.UEK{
+		MaxConcurrentRequests: 4,
+	}, nil)
+}
+
+var mixedScheduleFixtures = map[string]string{
+	"G:1": `<plan-zajec typ="G" id="1" nazwa="Group A">
+		<zajecia><termin>2025-10-06</termin><od-godz>08:00</od-godz><do-godz>09:30</do-godz><przedmiot>Algebra</przedmiot><typ>wykład</typ><nauczyciel moodle="11">dr Jan Kowalski</nauczyciel><nauczyciel moodle="12">dr Anna Nowak</nauczyciel><sala>Paw. A 101</sala></zajecia>
+		<zajecia><termin>2025-10-06</termin><od-godz>10:00</od-godz><do-godz>11:30</do-godz><przedmiot>Statystyka</przedmiot><typ>ćwiczenia</typ><nauczyciel moodle="13">dr Piotr Wiśniewski</nauczyciel><sala>Paw. A 102</sala></zajecia>
+	</plan-zajec>`,
+	"N:11": `<plan-zajec typ="N" id="11" idcel="11" nazwa="dr Jan Kowalski">
+		<zajecia><termin>2025-10-06</termin><od-godz>08:00</od-godz><do-godz>09:30</do-godz><przedmiot>Algebra</przedmiot><typ>wykład</typ><grupa>Group A, Group B</grupa><sala>Paw. A 101</sala></zajecia>
+		<zajecia><termin>2025-10-07</termin><od-godz>12:00</od-godz><do-godz>13:00</do-godz><przedmiot>Konsultacje</przedmiot><typ>konsultacje</typ><sala>Paw. A 200</sala></zajecia>
+	</plan-zajec>`,
+	"S:5": `<plan-zajec typ="S" id="5" nazwa="Paw. A 102">
+		<zajecia><termin>2025-10-06</termin><od-godz>10:00</od-godz><do-godz>11:30</do-godz><przedmiot>Statystyka</przedmiot><typ>ćwiczenia</typ><nauczyciel moodle="13">dr Piotr Wiśniewski</nauczyciel><grupa>Group A</grupa></zajecia>
+		<zajecia><termin>2025-10-06</termin><od-godz>10:00</od-godz><do-godz>11:30</do-godz><przedmiot>Statystyka</przedmiot><typ>ćwiczenia</typ><nauczyciel moodle="14">dr Ewa Zielińska</nauczyciel><grupa>Group C</grupa></zajecia>
+	</plan-zajec>`,
+}
+
+func TestGetAggregateScheduleMixedTypes(t *testing.T) {
+	client, err := newFixtureTestClient(mixedScheduleFixtures)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	aggregateSchedule, _, err := client.GetAggregateSchedule(context.Background(), uekschedule.UEKCallParams{}, []uekschedule.ScheduleKey{
+		{Type: uekschedule.ScheduleTypeGroup, Id: 1},
+		{Type: uekschedule.ScheduleTypeLecturer, Id: 11},
+		{Type: uekschedule.ScheduleTypeRoom, Id: 5},
+	}, uekschedule.PeriodSelection{})
+	if err != nil {
+		t.Errorf("Failed to get aggregate schedule: %s", err)
+		return
+	}
+
+	if len(aggregateSchedule.Headers) != 3 || aggregateSchedule.Headers[1].Type != uekschedule.ScheduleTypeLecturer {
+		t.Errorf("Unexpected headers: %+v", aggregateSchedule.Headers)
+	}
+
+	if len(aggregateSchedule.Items) != 4 {
+		t.Errorf("Unexpected item count, got: %d, want: %d", len(aggregateSchedule.Items), 4)
+		return
+	}
+
+	lecture := aggregateSchedule.Items[0]
+	if lecture.Subject != "Algebra" || len(lecture.Lecturers) != 2 || strings.Join(lecture.Groups, ",") != "Group A,Group B" {
+		t.Errorf("Lecture from group and lecturer schedules was not merged correctly: %+v", lecture)
+	}
+
+	exercisesA, exercisesC := aggregateSchedule.Items[1], aggregateSchedule.Items[2]
+	if exercisesA.Lecturers[0].Name != "dr Piotr Wiśniewski" || exercisesA.RoomName != "Paw. A 102" || strings.Join(exercisesA.Groups, ",") != "Group A" {
+		t.Errorf("Exercises from group and room schedules were not merged correctly: %+v", exercisesA)
+	}
+	if exercisesC.Lecturers[0].Name != "dr Ewa Zielińska" || strings.Join(exercisesC.Groups, ",") != "Group C" {
+		t.Errorf("Parallel exercises of another group were merged unexpectedly: %+v", exercisesC)
+	}
+
+	if aggregateSchedule.Items[3].Subject != "Konsultacje" {
+		t.Errorf("Unexpected last item: %+v", aggregateSchedule.Items[3])
+	}
+}
+
+func TestGetAggregateScheduleConflicts(t *testing.T) {
+	client, err := newFixtureTestClient(map[string]string{
+		"G:1": `<plan-zajec typ="G" id="1" nazwa="Group A">
+			<zajecia><termin>2025-10-06</termin><od-godz>08:00</od-godz><do-godz>09:30</do-godz><przedmiot>Algebra</przedmiot><typ>wykład</typ><sala>Paw. A 101</sala></zajecia>
+			<zajecia><termin>2025-10-06</termin><od-godz>10:00</od-godz><do-godz>11:30</do-godz><przedmiot>Statystyka</przedmiot><typ>ćwiczenia</typ><sala>Paw. A 102</sala></zajecia>
+			<zajecia><termin>2025-10-06</termin><od-godz>10:00</od-godz><do-godz>11:30</do-godz><przedmiot>Statystyka</przedmiot><typ>ćwiczenia</typ><sala>Paw. A 103</sala></zajecia>
+			<zajecia><termin>2025-10-07</termin><od-godz>12:00</od-godz><do-godz>13:30</do-godz><przedmiot>Ekonomia</przedmiot><typ>wykład</typ><sala>Paw. A 101</sala></zajecia>
+		</plan-zajec>`,
+		"G:2": `<plan-zajec typ="G" id="2" nazwa="Lektorat">
+			<zajecia><termin>2025-10-06</termin><od-godz>08:00</od-godz><do-godz>09:30</do-godz><przedmiot>Algebra</przedmiot><typ>wykład</typ><sala>Paw. A 101</sala></zajecia>
+			<zajecia><termin>2025-10-06</termin><od-godz>09:00</od-godz><do-godz>10:30</do-godz><przedmiot>Język angielski</przedmiot><typ>lektorat</typ><sala>Paw. A 102</sala></zajecia>
+			<zajecia><termin>2025-10-07</termin><od-godz>13:00</od-godz><do-godz>14:30</do-godz><przedmiot>Język angielski</przedmiot><typ>lektorat</typ><sala>&lt;a href="https://teams.microsoft.com/l/meetup-join/test"&gt;Platforma Moodle&lt;/a&gt;</sala></zajecia>
+		</plan-zajec>`,
+	})
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	aggregateSchedule, _, err := client.GetAggregateSchedule(context.Background(), uekschedule.UEKCallParams{}, []uekschedule.ScheduleKey{
+		{Type: uekschedule.ScheduleTypeGroup, Id: 1},
+		{Type: uekschedule.ScheduleTypeGroup, Id: 2},
+	}, uekschedule.PeriodSelection{})
+	if err != nil {
+		t.Errorf("Failed to get aggregate schedule: %s", err)
+		return
+	}
+
+	// shared lecture is listed by the language group itself and parallel classes of group A are listed by group A, so neither are conflicts
+	wantConflicts := []uekschedule.ScheduleConflict{
+		{FirstItemIdx: 1, SecondItemIdx: 2, Type: uekschedule.ScheduleConflictTypeSameRoom},
+		{FirstItemIdx: 1, SecondItemIdx: 3, Type: uekschedule.ScheduleConflictTypeDifferentRoom},
+		{FirstItemIdx: 4, SecondItemIdx: 5, Type: uekschedule.ScheduleConflictTypeOnlineOnSite},
+	}
+
+	if len(aggregateSchedule.Conflicts) != len(wantConflicts) {
+		t.Errorf("Unexpected conflicts, got: %+v, want: %+v", aggregateSchedule.Conflicts, wantConflicts)
+		return
+	}
+
+	for i := range wantConflicts {
+		if aggregateSchedule.Conflicts[i] != wantConflicts[i] {
+			t.Errorf("Unexpected conflict at index %d, got: %+v, want: %+v", i, aggregateSchedule.Conflicts[i], wantConflicts[i])
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package uekschedule
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type BreakerState string
+
+const (
+	BreakerStateClosed   BreakerState = "closed"
+	BreakerStateOpen     BreakerState = "open"
+	BreakerStateHalfOpen BreakerState = "half-open"
+)
+
+type BreakerStatus struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	OpenedAt            *time.Time   `json:"openedAt,omitempty"`
+}
+
+// circuitBreaker fails calls fast while UEK is down. After openDuration, a single probe attempt is let through, which closes the breaker on success
+type circuitBreaker struct {
+	failureThreshold    int
+	openDuration        time.Duration
+	logger              *slog.Logger
+	mu                  sync.Mutex
+	state               BreakerState
+	consecutiveFailures int
+	openedAt            time.Time
+	probeInFlight       bool
+}
+
+func newCircuitBreaker(failureThreshold int, openDuration time.Duration, logger *slog.Logger) *circuitBreaker {
+	return &circuitBreaker{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		logger:           logger,
+		state:            BreakerStateClosed,
+	}
+}
+
+func (cb *circuitBreaker) allow(now time.Time) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case BreakerStateOpen:
+		if now.Sub(cb.openedAt) < cb.openDuration {
+			return false
+		}
+		cb.setState(BreakerStateHalfOpen)
+		cb.probeInFlight = true
+		return true
+	case BreakerStateHalfOpen:
+		if cb.probeInFlight {
+			return false
+		}
+		cb.probeInFlight = true
+		return true
+	}
+
+	return true
+}
+
+// recordSuccess is called for every attempt which got a response from UEK, even an error one, it means UEK is up
+func (cb *circuitBreaker) recordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.consecutiveFailures = 0
+	cb.probeInFlight = false
+	if cb.state != BreakerStateClosed {
+		cb.setState(BreakerStateClosed)
+	}
+}
+
+func (cb *circuitBreaker) recordFailure(now time.Time) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.consecutiveFailures++
+	cb.probeInFlight = false
+	if cb.state == BreakerStateHalfOpen || (cb.state == BreakerStateClosed && cb.consecutiveFailures >= cb.failureThreshold) {
+		cb.openedAt = now
+		cb.setState(BreakerStateOpen)
+	}
+}
+
+// recordAbandoned is called when the caller gave up on an attempt, so that its result says nothing about UEK
+func (cb *circuitBreaker) recordAbandoned() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probeInFlight = false
+}
+
+func (cb *circuitBreaker) status() BreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	status := BreakerStatus{
+		State:               cb.state,
+		ConsecutiveFailures: cb.consecutiveFailures,
+	}
+	if cb.state != BreakerStateClosed {
+		openedAt := cb.openedAt
+		status.OpenedAt = &openedAt
+	}
+
+	return status
+}
+
+// setState has to be called with mu held
+func (cb *circuitBreaker) setState(state BreakerState) {
+	cb.logger.Warn("UEK circuit breaker state changed", slog.String("from", string(cb.state)), slog.String("to", string(state)), slog.Int("consecutiveFailures", cb.consecutiveFailures))
+	cb.state = state
+}
@@ -0,0 +1,136 @@
+package uekschedule
+
+import (
+	"sync"
+	"time"
+)
+
+type resourceKind int
+
+const (
+	resourceKindGroupings resourceKind = iota
+	resourceKindHeaders
+	resourceKindSchedule
+)
+
+type cacheEntryState int
+
+const (
+	cacheEntryStateMissing cacheEntryState = iota
+	cacheEntryStateFresh
+	cacheEntryStateStale
+	cacheEntryStateRevalidating
+)
+
+type responseCache struct {
+	mu                   sync.Mutex
+	entries              map[string]*responseCacheEntry
+	maxEntries           int
+	staleWhileRevalidate time.Duration
+}
+
+type responseCacheEntry struct {
+	res          *responseBody
+	freshUntil   time.Time
+	staleUntil   time.Time
+	revalidating bool
+}
+
+func newResponseCache(maxEntries int, staleWhileRevalidate time.Duration) *responseCache {
+	return &responseCache{
+		entries:              map[string]*responseCacheEntry{},
+		maxEntries:           maxEntries,
+		staleWhileRevalidate: staleWhileRevalidate,
+	}
+}
+
+// get returns the cached response and its state, a stale entry is marked as revalidating so that only one caller gets cacheEntryStateStale for it at a time
+func (rc *responseCache) get(key string, now time.Time) (*responseBody, cacheEntryState) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[key]
+	if !ok {
+		return nil, cacheEntryStateMissing
+	}
+
+	if now.Before(entry.freshUntil) {
+		return entry.res, cacheEntryStateFresh
+	}
+
+	if now.Before(entry.staleUntil) {
+		if entry.revalidating {
+			return entry.res, cacheEntryStateRevalidating
+		}
+		entry.revalidating = true
+		return entry.res, cacheEntryStateStale
+	}
+
+	delete(rc.entries, key)
+	return nil, cacheEntryStateMissing
+}
+
+func (rc *responseCache) put(key string, res *responseBody, ttl time.Duration, now time.Time) {
+	if ttl <= 0 {
+		return
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if _, ok := rc.entries[key]; !ok && len(rc.entries) >= rc.maxEntries {
+		rc.evict(now)
+	}
+
+	freshUntil := now.Add(ttl)
+	rc.entries[key] = &responseCacheEntry{
+		res:        res,
+		freshUntil: freshUntil,
+		staleUntil: freshUntil.Add(rc.staleWhileRevalidate),
+	}
+}
+
+func (rc *responseCache) finishRevalidation(key string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if entry, ok := rc.entries[key]; ok {
+		entry.revalidating = false
+	}
+}
+
+func (rc *responseCache) delete(key string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	delete(rc.entries, key)
+}
+
+func (rc *responseCache) len() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	return len(rc.entries)
+}
+
+// evict removes all entries that can no longer be served, and if that is not enough, the entry closest to expiring
+func (rc *responseCache) evict(now time.Time) {
+	var oldestKey string
+	var oldestEntry *responseCacheEntry
+
+	for key, entry := range rc.entries {
+		if !now.Before(entry.staleUntil) {
+			delete(rc.entries, key)
+			continue
+		}
+
+		if oldestEntry == nil || entry.staleUntil.Before(oldestEntry.staleUntil) {
+			oldestKey = key
+			oldestEntry = entry
+		}
+	}
+
+	if len(rc.entries) >= rc.maxEntries && oldestEntry != nil {
+		delete(rc.entries, oldestKey)
+	}
+}
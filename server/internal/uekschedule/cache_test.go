@@ -0,0 +1,119 @@
+package uekschedule_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+func TestCacheServesRepeatedCalls(t *testing.T) {
+	rt := &testRoundTripper{}
+	client, err := newTestClient(rt, config.UEK{
+		MaxConcurrentRequests: 1,
+		CacheMaxEntries:       10,
+		CacheGroupingsTTL:     time.Hour,
+	}, nil)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	for range 3 {
+		if _, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{BasicAuthHeaderValue: "a"}); err != nil {
+			t.Errorf("Failed to get groupings: %s", err)
+			return
+		}
+	}
+
+	if calls := rt.calls.Load(); calls != 1 {
+		t.Errorf("Unexpected upstream call count, got: %d, want: %d", calls, 1)
+	}
+}
+
+func TestCacheSeparatesCredentials(t *testing.T) {
+	rt := &testRoundTripper{}
+	client, err := newTestClient(rt, config.UEK{
+		MaxConcurrentRequests: 1,
+		CacheMaxEntries:       10,
+		CacheGroupingsTTL:     time.Hour,
+	}, nil)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	for _, basicAuthValue := range []string{"a", "b", "a"} {
+		if _, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{BasicAuthHeaderValue: basicAuthValue}); err != nil {
+			t.Errorf("Failed to get groupings: %s", err)
+			return
+		}
+	}
+
+	if calls := rt.calls.Load(); calls != 2 {
+		t.Errorf("Unexpected upstream call count, got: %d, want: %d", calls, 2)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	rt := &testRoundTripper{}
+	client, err := newTestClient(rt, config.UEK{
+		MaxConcurrentRequests:     1,
+		CacheMaxEntries:           10,
+		CacheGroupingsTTL:         time.Millisecond,
+		CacheStaleWhileRevalidate: time.Hour,
+	}, nil)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	if _, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{}); err != nil {
+		t.Errorf("Failed to get groupings: %s", err)
+		return
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	groupings, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{})
+	if err != nil {
+		t.Errorf("Failed to get stale groupings: %s", err)
+		return
+	}
+	if len(groupings) != 2 {
+		t.Errorf("Unexpected stale groupings count, got: %d, want: %d", len(groupings), 2)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for rt.calls.Load() != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if calls := rt.calls.Load(); calls != 2 {
+		t.Errorf("Stale entry was not revalidated in background, got calls: %d, want: %d", calls, 2)
+	}
+}
+
+func TestCacheDisabled(t *testing.T) {
+	rt := &testRoundTripper{}
+	client, err := newTestClient(rt, config.UEK{
+		MaxConcurrentRequests: 1,
+		CacheGroupingsTTL:     time.Hour,
+	}, nil)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	for range 2 {
+		if _, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{}); err != nil {
+			t.Errorf("Failed to get groupings: %s", err)
+			return
+		}
+	}
+
+	if calls := rt.calls.Load(); calls != 2 {
+		t.Errorf("Unexpected upstream call count, got: %d, want: %d", calls, 2)
+	}
+}
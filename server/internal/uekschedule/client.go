@@ -2,42 +2,117 @@ package uekschedule
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/metrics"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/tracing"
 )
 
 const baseUrl = "https://planzajec.uek.krakow.pl/index.php"
 
+const cacheRevalidationTimeout = 30 * time.Second
+
 type Client struct {
 	httpClient                     *http.Client
 	logger                         *slog.Logger
 	cfg                            config.UEK
 	maxConcurrentRequestsSemaphore chan struct{}
+	semaphoreWaiting               atomic.Int64
 	location                       *time.Location
+	cache                          *responseCache
+	inflight                       *inflightGroup
+	offlineStore                   *filestore.Store
+	encryption                     *encryption.Service
+	breaker                        *circuitBreaker
+	metrics                        *clientMetrics
 }
 
-func NewClient(httpClient *http.Client, logger *slog.Logger, cfg config.UEK) (*Client, error) {
+// offlineStore is optional, responses are not persisted without it, and encryptionService is required along with it. metricsRegistry is optional too
+func NewClient(httpClient *http.Client, logger *slog.Logger, cfg config.UEK, offlineStore *filestore.Store, encryptionService *encryption.Service, metricsRegistry *metrics.Registry) (*Client, error) {
 	if cfg.MaxConcurrentRequests < 1 {
 		return nil, fmt.Errorf(errPrefix + "max concurrent requests should be greater than 0")
 	}
 
+	if offlineStore != nil && encryptionService == nil {
+		return nil, fmt.Errorf(errPrefix + "encryption service is required to persist responses")
+	}
+
 	loc, err := time.LoadLocation("Europe/Warsaw")
 	if err != nil {
 		return nil, fmt.Errorf(errPrefix+"failed to load timezone data: %w", err)
 	}
 
-	return &Client{
+	if cfg.MaxRetries < 0 {
+		return nil, fmt.Errorf(errPrefix + "max retries should not be negative")
+	}
+
+	var cache *responseCache
+	if cfg.CacheMaxEntries > 0 {
+		cache = newResponseCache(cfg.CacheMaxEntries, cfg.CacheStaleWhileRevalidate)
+	}
+
+	var breaker *circuitBreaker
+	if cfg.BreakerFailureThreshold > 0 {
+		breaker = newCircuitBreaker(cfg.BreakerFailureThreshold, cfg.BreakerOpenDuration, logger)
+	}
+
+	c := &Client{
 		httpClient:                     httpClient,
 		cfg:                            cfg,
 		logger:                         logger,
 		maxConcurrentRequestsSemaphore: make(chan struct{}, cfg.MaxConcurrentRequests),
 		location:                       loc,
-	}, nil
+		cache:                          cache,
+		inflight:                       newInflightGroup(),
+		offlineStore:                   offlineStore,
+		encryption:                     encryptionService,
+		breaker:                        breaker,
+	}
+	c.metrics = newClientMetrics(metricsRegistry, c)
+
+	return c, nil
+}
+
+func (c *Client) Location() *time.Location {
+	return c.location
+}
+
+// BreakerStatus always reports a closed breaker if it is disabled
+func (c *Client) BreakerStatus() BreakerStatus {
+	if c.breaker == nil {
+		return BreakerStatus{
+			State: BreakerStateClosed,
+		}
+	}
+
+	return c.breaker.status()
+}
+
+// Probe checks if UEK responds, bypassing the cache and retries. It does not send credentials, UEK rejecting the request still means that it is up
+func (c *Client) Probe(ctx context.Context) error {
+	if c.BreakerStatus().State == BreakerStateOpen {
+		return ErrUpstreamUnavailable
+	}
+
+	const probeUrl = baseUrl + "?xml"
+	if _, err := c.fetchUEKOnce(ctx, UEKCallParams{}, probeUrl); err != nil && !errors.Is(err, ErrUnauthorized) {
+		return err
+	}
+
+	return nil
 }
 
 type responseBody struct {
@@ -77,10 +152,188 @@ type responseBody struct {
 
 type UEKCallParams struct {
 	BasicAuthHeaderValue string
-	ForwaredForHeader    string
+	// ForwaredForHeader is sent to UEK as X-Forwarded-For, it should be the client IP
+	ForwaredForHeader string
+	// Staleness is optional, it is marked when a response is served from offline storage
+	Staleness *Staleness
+}
+
+func (c *Client) callUEK(ctx context.Context, callParams UEKCallParams, kind resourceKind, targetUrl string) (*responseBody, error) {
+	ctx, span := tracing.StartSpan(ctx, "uekschedule.callUEK", tracing.SpanKindInternal, slog.String("url", targetUrl))
+	defer span.End()
+
+	callKey := createCallKey(callParams, targetUrl)
+
+	if c.cache != nil {
+		cachedRes, cacheEntryState := c.cache.get(callKey, time.Now())
+		switch cacheEntryState {
+		case cacheEntryStateFresh, cacheEntryStateRevalidating:
+			c.metrics.cacheLookups.Inc(cacheLookupResultHit)
+			span.SetAttrs(slog.String("cacheResult", cacheLookupResultHit))
+			return cachedRes, nil
+		case cacheEntryStateStale:
+			c.metrics.cacheLookups.Inc(cacheLookupResultStale)
+			span.SetAttrs(slog.String("cacheResult", cacheLookupResultStale))
+			go c.revalidateCacheEntry(callParams, kind, callKey, targetUrl)
+			return cachedRes, nil
+		}
+		c.metrics.cacheLookups.Inc(cacheLookupResultMiss)
+		span.SetAttrs(slog.String("cacheResult", cacheLookupResultMiss))
+	}
+
+	res, err := c.inflight.do(ctx, callKey, func(ctx context.Context) (*responseBody, error) {
+		res, err := c.fetchUEK(ctx, callParams, targetUrl)
+		if err != nil {
+			return nil, err
+		}
+
+		now := time.Now()
+		if c.cache != nil {
+			c.cache.put(callKey, res, c.getCacheTTL(kind), now)
+		}
+		c.persistResponse(callKey, res, now)
+
+		return res, nil
+	})
+	if err != nil {
+		span.RecordError(err)
+
+		// credentials rejected by UEK must not unlock persisted responses
+		if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrNotFound) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		if storedRes, fetchedAt, ok := c.loadPersistedResponse(callKey, time.Now()); ok {
+			c.logger.WarnContext(ctx, "Serving persisted UEK response", slog.String("url", targetUrl), slog.Time("fetchedAt", fetchedAt), slog.Any("err", err))
+			callParams.Staleness.mark(fetchedAt)
+			c.metrics.offlineResponses.Inc()
+			span.SetAttrs(slog.Time("offlineFetchedAt", fetchedAt))
+			return storedRes, nil
+		}
+
+		return nil, err
+	}
+
+	return res, nil
 }
 
-func (c *Client) callUEK(ctx context.Context, callParams UEKCallParams, targetUrl string) (*responseBody, error) {
+// requests are separated by credential, so a response fetched with valid credentials is never shared with someone who did not authenticate with the same ones
+func createCallKey(callParams UEKCallParams, targetUrl string) string {
+	credentialHash := sha256.Sum256([]byte(callParams.BasicAuthHeaderValue))
+	return hex.EncodeToString(credentialHash[:]) + " " + targetUrl
+}
+
+func (c *Client) revalidateCacheEntry(callParams UEKCallParams, kind resourceKind, callKey string, targetUrl string) {
+	defer c.cache.finishRevalidation(callKey)
+
+	ctx, cancelCtx := context.WithTimeout(context.Background(), cacheRevalidationTimeout)
+	defer cancelCtx()
+
+	res, err := c.inflight.do(ctx, callKey, func(ctx context.Context) (*responseBody, error) {
+		return c.fetchUEK(ctx, callParams, targetUrl)
+	})
+	if err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			c.cache.delete(callKey)
+		}
+		c.logger.Debug("Failed to revalidate cached UEK response", slog.String("url", targetUrl), slog.Any("err", err))
+		return
+	}
+
+	now := time.Now()
+	c.cache.put(callKey, res, c.getCacheTTL(kind), now)
+	c.persistResponse(callKey, res, now)
+}
+
+func (c *Client) getCacheTTL(kind resourceKind) time.Duration {
+	switch kind {
+	case resourceKindGroupings:
+		return c.cfg.CacheGroupingsTTL
+	case resourceKindHeaders:
+		return c.cfg.CacheHeadersTTL
+	case resourceKindSchedule:
+		return c.cfg.CacheScheduleTTL
+	}
+
+	return 0
+}
+
+// fetchUEK retries transient failures with exponential backoff and jitter, unless the circuit breaker is open
+func (c *Client) fetchUEK(ctx context.Context, callParams UEKCallParams, targetUrl string) (*responseBody, error) {
+	for attempt := 0; ; attempt++ {
+		if c.breaker != nil && !c.breaker.allow(time.Now()) {
+			return nil, ErrUpstreamUnavailable
+		}
+
+		res, err := c.fetchUEKOnce(ctx, callParams, targetUrl)
+		_, isTransient := err.(*transientError)
+		if c.breaker != nil {
+			if ctx.Err() != nil {
+				c.breaker.recordAbandoned()
+			} else if isTransient {
+				c.breaker.recordFailure(time.Now())
+			} else {
+				c.breaker.recordSuccess()
+			}
+		}
+
+		if !isTransient || attempt >= c.cfg.MaxRetries || ctx.Err() != nil {
+			return res, err
+		}
+
+		retryDelay := c.getRetryDelay(attempt)
+		c.logger.DebugContext(ctx, "Retrying UEK call", slog.String("url", targetUrl), slog.Int("attempt", attempt+1), slog.String("retryDelay", retryDelay.String()), slog.Any("err", err))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// getRetryDelay doubles the delay with each attempt, and randomizes its upper half, so that retries of concurrent calls do not come in waves
+func (c *Client) getRetryDelay(attempt int) time.Duration {
+	retryDelay := min(c.cfg.RetryBaseDelay<<attempt, c.cfg.RetryMaxDelay)
+	if retryDelay <= 0 {
+		return 0
+	}
+
+	return retryDelay/2 + rand.N(retryDelay/2+1)
+}
+
+func (c *Client) fetchUEKOnce(ctx context.Context, callParams UEKCallParams, targetUrl string) (*responseBody, error) {
+	_, waitSpan := tracing.StartSpan(ctx, "uekschedule.waitForRequestSlot", tracing.SpanKindInternal)
+	c.semaphoreWaiting.Add(1)
+	select {
+	case c.maxConcurrentRequestsSemaphore <- struct{}{}:
+		c.semaphoreWaiting.Add(-1)
+		waitSpan.End()
+	case <-ctx.Done():
+		c.semaphoreWaiting.Add(-1)
+		waitSpan.RecordError(ctx.Err())
+		waitSpan.End()
+		return nil, ctx.Err()
+	}
+	defer func() {
+		<-c.maxConcurrentRequestsSemaphore
+	}()
+
+	// the timeout starts after acquiring the semaphore, waiting for other calls to finish is not a sign of UEK being slow
+	if c.cfg.RequestTimeout > 0 {
+		var cancelCtx context.CancelFunc
+		ctx, cancelCtx = context.WithTimeout(ctx, c.cfg.RequestTimeout)
+		defer cancelCtx()
+	}
+
+	ctx, requestSpan := tracing.StartSpan(ctx, "uek.request", tracing.SpanKindClient, slog.String("url", targetUrl))
+	res, err := c.doUEKRequest(ctx, callParams, targetUrl)
+	requestSpan.RecordError(err)
+	requestSpan.End()
+
+	return res, err
+}
+
+func (c *Client) doUEKRequest(ctx context.Context, callParams UEKCallParams, targetUrl string) (*responseBody, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetUrl, nil)
 	if err != nil {
 		return nil, fmt.Errorf(errPrefix+"failed to create request: %w", err)
@@ -97,30 +350,36 @@ func (c *Client) callUEK(ctx context.Context, callParams UEKCallParams, targetUr
 	}
 	req.Header.Set("Content-Type", "application/xml")
 
-	c.maxConcurrentRequestsSemaphore <- struct{}{}
-	defer func() {
-		<-c.maxConcurrentRequestsSemaphore
-	}()
-
-	c.logger.Debug("Calling UEK", slog.String("url", req.URL.String()), slog.String("forwardedFor", callParams.ForwaredForHeader))
+	c.logger.DebugContext(ctx, "Calling UEK", slog.String("url", req.URL.String()), slog.String("forwardedFor", callParams.ForwaredForHeader))
+	startTime := time.Now()
 	res, err := c.httpClient.Do(req)
+	c.metrics.upstreamRequestDuration.Observe(time.Since(startTime).Seconds())
 	if err != nil {
-		return nil, fmt.Errorf(errPrefix+"failed to do request: %w", err)
+		c.metrics.upstreamRequests.Inc("error")
+		return nil, &transientError{kind: ErrUpstreamUnavailable, err: fmt.Errorf(errPrefix+"failed to do request: %w", err)}
 	}
 	defer res.Body.Close()
+	c.metrics.upstreamRequests.Inc(strconv.Itoa(res.StatusCode))
+	tracing.SpanFromContext(ctx).SetAttrs(slog.Int("http.response.status_code", res.StatusCode))
 
-	switch res.StatusCode {
-	case http.StatusOK:
+	switch {
+	case res.StatusCode == http.StatusOK:
 		break
-	case http.StatusUnauthorized:
+	case res.StatusCode == http.StatusUnauthorized:
 		return nil, ErrUnauthorized
+	case res.StatusCode == http.StatusNotFound:
+		return nil, ErrNotFound
+	case res.StatusCode == http.StatusTooManyRequests:
+		return nil, &transientError{kind: ErrUpstreamRateLimited, err: fmt.Errorf(errPrefix+"unexpected status code: %d", res.StatusCode)}
+	case res.StatusCode >= 500:
+		return nil, &transientError{kind: ErrUpstreamUnavailable, err: fmt.Errorf(errPrefix+"unexpected status code: %d", res.StatusCode)}
 	default:
 		return nil, fmt.Errorf(errPrefix+"unexpected status code: %d", res.StatusCode)
 	}
 
 	resBody := &responseBody{}
 	if err = xml.NewDecoder(res.Body).Decode(resBody); err != nil {
-		return nil, fmt.Errorf(errPrefix+"failed to decode xml response: %w", err)
+		return nil, &ParseError{ItemIdx: -1, Err: fmt.Errorf("failed to decode xml: %w", err)}
 	}
 
 	return resBody, nil
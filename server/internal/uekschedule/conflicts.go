@@ -0,0 +1,61 @@
+package uekschedule
+
+type ScheduleConflictType string
+
+const (
+	ScheduleConflictTypeSameRoom      ScheduleConflictType = "same-room"
+	ScheduleConflictTypeDifferentRoom ScheduleConflictType = "different-room"
+	ScheduleConflictTypeOnlineOnSite  ScheduleConflictType = "online-on-site"
+	ScheduleConflictTypeOnline        ScheduleConflictType = "online"
+)
+
+// ScheduleConflict refers to two overlapping items by their indexes in AggregateSchedule.Items
+type ScheduleConflict struct {
+	FirstItemIdx  int                  `json:"firstItemIdx"`
+	SecondItemIdx int                  `json:"secondItemIdx"`
+	Type          ScheduleConflictType `json:"type"`
+}
+
+// detectConflicts finds overlapping pairs of items sorted by start time.
+// Pairs which are both listed by one of the schedules are skipped, the overlap is not caused by combining schedules then (e.g. parallel classes of subgroups)
+func detectConflicts(items []*ScheduleItem, itemSources []uint64) []ScheduleConflict {
+	conflicts := []ScheduleConflict{}
+
+	for i, item := range items {
+		if !item.OccupiesTime() {
+			continue
+		}
+
+		for j := i + 1; j < len(items) && items[j].Start.Before(item.End); j++ {
+			otherItem := items[j]
+			if !otherItem.OccupiesTime() || !otherItem.End.After(otherItem.Start) || itemSources[i]&itemSources[j] != 0 {
+				continue
+			}
+
+			conflicts = append(conflicts, ScheduleConflict{
+				FirstItemIdx:  i,
+				SecondItemIdx: j,
+				Type:          getConflictType(item, otherItem),
+			})
+		}
+	}
+
+	return conflicts
+}
+
+func getConflictType(a *ScheduleItem, b *ScheduleItem) ScheduleConflictType {
+	aIsOnline, bIsOnline := a.IsOnline(), b.IsOnline()
+	if aIsOnline && bIsOnline {
+		return ScheduleConflictTypeOnline
+	}
+
+	if aIsOnline != bIsOnline {
+		return ScheduleConflictTypeOnlineOnSite
+	}
+
+	if a.RoomName != "" && a.RoomName == b.RoomName {
+		return ScheduleConflictTypeSameRoom
+	}
+
+	return ScheduleConflictTypeDifferentRoom
+}
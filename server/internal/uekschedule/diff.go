@@ -0,0 +1,135 @@
+package uekschedule
+
+import (
+	"slices"
+	"time"
+)
+
+type ScheduleItemChange string
+
+const (
+	ScheduleItemChangeTime      ScheduleItemChange = "time"
+	ScheduleItemChangeRoom      ScheduleItemChange = "room"
+	ScheduleItemChangeLecturers ScheduleItemChange = "lecturers"
+	ScheduleItemChangeGroups    ScheduleItemChange = "groups"
+	ScheduleItemChangeExtra     ScheduleItemChange = "extra"
+)
+
+type ScheduleDiff struct {
+	Added    []*ScheduleItem          `json:"added"`
+	Removed  []*ScheduleItem          `json:"removed"`
+	Modified []*ScheduleItemDiffEntry `json:"modified"`
+}
+
+type ScheduleItemDiffEntry struct {
+	Before  *ScheduleItem        `json:"before"`
+	After   *ScheduleItem        `json:"after"`
+	Changes []ScheduleItemChange `json:"changes"`
+}
+
+func (d *ScheduleDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// DiffScheduleItems matches items of two versions of a schedule, results keep the order of the input lists.
+// Matching goes from the strictest identity to the loosest, so that a class is only reported as moved if nothing closer to it was found:
+// 1. same class (ignoring groups), 2. same start, end, subject and type, 3. same start, subject and type, 4. same subject and type on the same day
+func DiffScheduleItems(before []*ScheduleItem, after []*ScheduleItem) *ScheduleDiff {
+	diff := &ScheduleDiff{
+		Added:    []*ScheduleItem{},
+		Removed:  []*ScheduleItem{},
+		Modified: []*ScheduleItemDiffEntry{},
+	}
+
+	matchedBefore := make([]bool, len(before))
+	matchedAfter := make([]bool, len(after))
+	matchedAfterIdxByBeforeIdx := make([]int, len(before))
+
+	matchers := []func(a *ScheduleItem, b *ScheduleItem) bool{
+		(*ScheduleItem).EqualIgnoringGroups,
+		func(a *ScheduleItem, b *ScheduleItem) bool {
+			return a.Compare(b) == 0
+		},
+		func(a *ScheduleItem, b *ScheduleItem) bool {
+			return a.Start.Equal(b.Start) && a.Subject == b.Subject && a.Type == b.Type
+		},
+		func(a *ScheduleItem, b *ScheduleItem) bool {
+			return a.Subject == b.Subject && a.Type == b.Type && isSameDay(a.Start, b.Start)
+		},
+	}
+
+	for _, matcher := range matchers {
+		for i, beforeItem := range before {
+			if matchedBefore[i] {
+				continue
+			}
+
+			for j, afterItem := range after {
+				if matchedAfter[j] || !matcher(beforeItem, afterItem) {
+					continue
+				}
+
+				matchedBefore[i] = true
+				matchedAfter[j] = true
+				matchedAfterIdxByBeforeIdx[i] = j
+				break
+			}
+		}
+	}
+
+	for i, beforeItem := range before {
+		if !matchedBefore[i] {
+			diff.Removed = append(diff.Removed, beforeItem)
+			continue
+		}
+
+		afterItem := after[matchedAfterIdxByBeforeIdx[i]]
+		if changes := beforeItem.detectChanges(afterItem); len(changes) > 0 {
+			diff.Modified = append(diff.Modified, &ScheduleItemDiffEntry{
+				Before:  beforeItem,
+				After:   afterItem,
+				Changes: changes,
+			})
+		}
+	}
+
+	for j, afterItem := range after {
+		if !matchedAfter[j] {
+			diff.Added = append(diff.Added, afterItem)
+		}
+	}
+
+	return diff
+}
+
+func (a *ScheduleItem) detectChanges(b *ScheduleItem) []ScheduleItemChange {
+	changes := []ScheduleItemChange{}
+
+	if !a.Start.Equal(b.Start) || !a.End.Equal(b.End) {
+		changes = append(changes, ScheduleItemChangeTime)
+	}
+
+	if a.RoomName != b.RoomName || a.RoomUrl != b.RoomUrl {
+		changes = append(changes, ScheduleItemChangeRoom)
+	}
+
+	if !slices.Equal(a.Lecturers, b.Lecturers) {
+		changes = append(changes, ScheduleItemChangeLecturers)
+	}
+
+	if !slices.Equal(a.Groups, b.Groups) {
+		changes = append(changes, ScheduleItemChangeGroups)
+	}
+
+	if a.Extra != b.Extra {
+		changes = append(changes, ScheduleItemChangeExtra)
+	}
+
+	return changes
+}
+
+func isSameDay(a time.Time, b time.Time) bool {
+	aYear, aMonth, aDay := a.Date()
+	bYear, bMonth, bDay := b.In(a.Location()).Date()
+	return aYear == bYear && aMonth == bMonth && aDay == bDay
+}
@@ -0,0 +1,69 @@
+package uekschedule_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+func createTestItem(day int, startHour int, subject string, roomName string) *uekschedule.ScheduleItem {
+	start := time.Date(2025, time.October, day, startHour, 0, 0, 0, time.UTC)
+	return &uekschedule.ScheduleItem{
+		Start:     start,
+		End:       start.Add(90 * time.Minute),
+		Subject:   subject,
+		Type:      "wykład",
+		Groups:    []string{"Group A"},
+		Lecturers: []uekschedule.ScheduleItemLecturer{{Name: "dr Jan Kowalski"}},
+		RoomName:  roomName,
+	}
+}
+
+func TestDiffScheduleItems(t *testing.T) {
+	unchanged := createTestItem(6, 8, "Algebra", "A 101")
+	roomChangedBefore, roomChangedAfter := createTestItem(6, 10, "Statystyka", "A 101"), createTestItem(6, 10, "Statystyka", "B 202")
+	movedBefore, movedAfter := createTestItem(7, 8, "Ekonomia", "A 101"), createTestItem(7, 12, "Ekonomia", "A 101")
+	removed := createTestItem(8, 8, "Finanse", "A 101")
+	added := createTestItem(9, 8, "Marketing", "A 101")
+	extraAfter := createTestItem(10, 8, "Prawo", "A 101")
+	extraAfter.Extra = "Zajęcia odwołane"
+
+	diff := uekschedule.DiffScheduleItems(
+		[]*uekschedule.ScheduleItem{unchanged, roomChangedBefore, movedBefore, removed, createTestItem(10, 8, "Prawo", "A 101")},
+		[]*uekschedule.ScheduleItem{unchanged, roomChangedAfter, movedAfter, added, extraAfter},
+	)
+
+	if len(diff.Added) != 1 || diff.Added[0] != added {
+		t.Errorf("Unexpected added items: %+v", diff.Added)
+	}
+
+	if len(diff.Removed) != 1 || diff.Removed[0] != removed {
+		t.Errorf("Unexpected removed items: %+v", diff.Removed)
+	}
+
+	if len(diff.Modified) != 3 {
+		t.Errorf("Unexpected modified item count, got: %d, want: %d", len(diff.Modified), 3)
+		return
+	}
+
+	wantChanges := [][]uekschedule.ScheduleItemChange{
+		{uekschedule.ScheduleItemChangeRoom},
+		{uekschedule.ScheduleItemChangeTime},
+		{uekschedule.ScheduleItemChangeExtra},
+	}
+	for i, entry := range diff.Modified {
+		if !slices.Equal(entry.Changes, wantChanges[i]) {
+			t.Errorf("Unexpected changes for %s, got: %v, want: %v", entry.After.Subject, entry.Changes, wantChanges[i])
+		}
+	}
+}
+
+func TestDiffScheduleItemsIdentical(t *testing.T) {
+	items := []*uekschedule.ScheduleItem{createTestItem(6, 8, "Algebra", "A 101"), createTestItem(6, 10, "Statystyka", "A 101")}
+
+	if diff := uekschedule.DiffScheduleItems(items, items); !diff.IsEmpty() {
+		t.Errorf("Diff of identical items is not empty: %+v", diff)
+	}
+}
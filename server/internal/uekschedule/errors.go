@@ -1,7 +1,52 @@
 package uekschedule
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 const errPrefix = "uekschedule: "
 
 var ErrUnauthorized = errors.New(errPrefix + "bad auth header")
+
+// ErrUpstreamUnavailable covers connection errors, timeouts, 5xx responses and calls rejected by the open circuit breaker
+var ErrUpstreamUnavailable = errors.New(errPrefix + "uek is unavailable")
+var ErrUpstreamRateLimited = errors.New(errPrefix + "uek rate limit exceeded")
+var ErrNotFound = errors.New(errPrefix + "schedule not found")
+var ErrInvalidPeriod = errors.New(errPrefix + "invalid period")
+
+// ParseError is returned when UEK responds with something that cannot be understood, ItemIdx is -1 if the error is not about a specific schedule item
+type ParseError struct {
+	ItemIdx int
+	Err     error
+}
+
+func (e *ParseError) Error() string {
+	if e.ItemIdx < 0 {
+		return fmt.Sprintf(errPrefix+"failed to parse response: %s", e.Err)
+	}
+
+	return fmt.Sprintf(errPrefix+"failed to parse response: %s at item index %d", e.Err, e.ItemIdx)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// transientError marks failures worth retrying, it matches kind with errors.Is
+type transientError struct {
+	kind error
+	err  error
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+func (e *transientError) Is(target error) bool {
+	return target == e.kind
+}
@@ -0,0 +1,69 @@
+package uekschedule_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+func TestScheduleErrors(t *testing.T) {
+	client, err := newFixtureTestClient(map[string]string{
+		"G:1": `<plan-zajec typ="G" id="1" nazwa="Group A">
+			<zajecia><termin>2025-10-06</termin><od-godz>08:00</od-godz><do-godz>09:30</do-godz><przedmiot>Algebra</przedmiot><typ>wykład</typ><sala>Paw. A 101</sala></zajecia>
+			<zajecia><termin>2025-10-06</termin><od-godz>12:00</od-godz><do-godz>10:00</do-godz><przedmiot>Statystyka</przedmiot><typ>ćwiczenia</typ><sala>Paw. A 102</sala></zajecia>
+		</plan-zajec>`,
+		"G:2": `<plan-zajec/>`,
+		"G:3": `<plan-zajec`,
+	})
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	_, _, err = client.GetSchedule(context.Background(), uekschedule.UEKCallParams{}, uekschedule.ScheduleTypeGroup, 1, 0)
+	if parseErr := (*uekschedule.ParseError)(nil); !errors.As(err, &parseErr) || parseErr.ItemIdx != 1 {
+		t.Errorf("Expected parse error at item index 1, got: %v", err)
+	}
+
+	if _, _, err := client.GetSchedule(context.Background(), uekschedule.UEKCallParams{}, uekschedule.ScheduleTypeGroup, 2, 0); !errors.Is(err, uekschedule.ErrNotFound) {
+		t.Errorf("Expected not found error for empty schedule, got: %v", err)
+	}
+
+	_, _, err = client.GetSchedule(context.Background(), uekschedule.UEKCallParams{}, uekschedule.ScheduleTypeGroup, 3, 0)
+	if parseErr := (*uekschedule.ParseError)(nil); !errors.As(err, &parseErr) || parseErr.ItemIdx != -1 {
+		t.Errorf("Expected parse error for malformed response, got: %v", err)
+	}
+
+	if _, _, err := client.GetSchedule(context.Background(), uekschedule.UEKCallParams{}, uekschedule.ScheduleTypeGroup, 4, 0); !errors.Is(err, uekschedule.ErrNotFound) {
+		t.Errorf("Expected not found error for 404 response, got: %v", err)
+	}
+}
+
+func TestUpstreamErrors(t *testing.T) {
+	rt := &testRoundTripper{}
+	client, err := newTestClient(rt, config.UEK{
+		MaxConcurrentRequests: 1,
+	}, nil)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	for _, tc := range []struct {
+		statusCode  int
+		expectedErr error
+	}{
+		{http.StatusTooManyRequests, uekschedule.ErrUpstreamRateLimited},
+		{http.StatusBadGateway, uekschedule.ErrUpstreamUnavailable},
+		{http.StatusUnauthorized, uekschedule.ErrUnauthorized},
+	} {
+		rt.statusCode.Store(int32(tc.statusCode))
+		if _, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{}); !errors.Is(err, tc.expectedErr) {
+			t.Errorf("Unexpected error for status code %d, got: %v, want: %v", tc.statusCode, err, tc.expectedErr)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package uekschedule
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	maxFilterRules         = 50
+	maxFilterPatternLength = 200
+)
+
+// ItemRule matches items for which every set field matches, so that e.g. a rule with a subject and a type matches only the lecture of a subject.
+// Values are compared ignoring case, or as regular expressions if Regex is set. Lecturer and group match if any of the item lecturers or groups match
+type ItemRule struct {
+	Subject  string `json:"subject,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Lecturer string `json:"lecturer,omitempty"`
+	Room     string `json:"room,omitempty"`
+	Group    string `json:"group,omitempty"`
+	// Weekday is 1 for Monday through 7 for Sunday, 0 matches every day
+	Weekday int  `json:"weekday,omitempty"`
+	Regex   bool `json:"regex,omitempty"`
+}
+
+// ItemFilterRules are the serializable form of ItemFilter.
+// Items are kept if they match any include rule, or there are none, and do not match any exclude rule
+type ItemFilterRules struct {
+	Include []ItemRule `json:"include,omitempty"`
+	Exclude []ItemRule `json:"exclude,omitempty"`
+}
+
+func (r ItemFilterRules) IsEmpty() bool {
+	return len(r.Include) == 0 && len(r.Exclude) == 0
+}
+
+// ItemFilter is safe for concurrent use, a nil filter keeps every item
+type ItemFilter struct {
+	include        []*itemMatcher
+	exclude        []*itemMatcher
+	hiddenSubjects map[string]struct{}
+}
+
+type itemMatcher struct {
+	subject  stringMatcher
+	itemType stringMatcher
+	lecturer stringMatcher
+	room     stringMatcher
+	group    stringMatcher
+	weekday  int
+}
+
+// stringMatcher is nil when the rule does not set the field
+type stringMatcher func(s string) bool
+
+func (r ItemFilterRules) Compile() (*ItemFilter, error) {
+	if len(r.Include)+len(r.Exclude) > maxFilterRules {
+		return nil, fmt.Errorf(errPrefix+"filter should have at most %d rules", maxFilterRules)
+	}
+
+	filter := &ItemFilter{}
+	for _, rule := range r.Include {
+		matcher, err := rule.compile()
+		if err != nil {
+			return nil, err
+		}
+		filter.include = append(filter.include, matcher)
+	}
+	for _, rule := range r.Exclude {
+		matcher, err := rule.compile()
+		if err != nil {
+			return nil, err
+		}
+		filter.exclude = append(filter.exclude, matcher)
+	}
+
+	return filter, nil
+}
+
+// CompileHidingSubjects is like Compile, but also hides subjects, which predate filter rules.
+// They are matched exactly like they used to be, and do not count towards the rule limit, so that existing urls hiding many subjects keep working
+func (r ItemFilterRules) CompileHidingSubjects(hiddenSubjects []string) (*ItemFilter, error) {
+	filter, err := r.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(hiddenSubjects) > 0 {
+		filter.hiddenSubjects = make(map[string]struct{}, len(hiddenSubjects))
+		for _, subject := range hiddenSubjects {
+			filter.hiddenSubjects[subject] = struct{}{}
+		}
+	}
+
+	return filter, nil
+}
+
+func (rule ItemRule) compile() (*itemMatcher, error) {
+	if rule.Weekday < 0 || rule.Weekday > 7 {
+		return nil, fmt.Errorf(errPrefix+"filter rule weekday should be between 1 and 7: %d", rule.Weekday)
+	}
+
+	matcher := &itemMatcher{
+		weekday: rule.Weekday,
+	}
+	for _, field := range []struct {
+		value   string
+		matcher *stringMatcher
+	}{
+		{value: rule.Subject, matcher: &matcher.subject},
+		{value: rule.Type, matcher: &matcher.itemType},
+		{value: rule.Lecturer, matcher: &matcher.lecturer},
+		{value: rule.Room, matcher: &matcher.room},
+		{value: rule.Group, matcher: &matcher.group},
+	} {
+		if field.value == "" {
+			continue
+		}
+
+		if !rule.Regex {
+			*field.matcher = func(s string) bool {
+				return strings.EqualFold(s, field.value)
+			}
+			continue
+		}
+
+		if len(field.value) > maxFilterPatternLength {
+			return nil, fmt.Errorf(errPrefix+"filter rule pattern should be at most %d characters long", maxFilterPatternLength)
+		}
+
+		re, err := regexp.Compile("(?i)" + field.value)
+		if err != nil {
+			return nil, fmt.Errorf(errPrefix+"invalid filter rule pattern: %w", err)
+		}
+		*field.matcher = re.MatchString
+	}
+
+	// a rule without conditions would match every item, which is more likely a mistake than intended
+	if matcher.subject == nil && matcher.itemType == nil && matcher.lecturer == nil && matcher.room == nil && matcher.group == nil && matcher.weekday == 0 {
+		return nil, fmt.Errorf(errPrefix + "filter rule should have at least one condition")
+	}
+
+	return matcher, nil
+}
+
+func (m *itemMatcher) matches(item *ScheduleItem) bool {
+	if m.subject != nil && !m.subject(item.Subject) {
+		return false
+	}
+
+	if m.itemType != nil && !m.itemType(item.Type) {
+		return false
+	}
+
+	if m.lecturer != nil && !slices.ContainsFunc(item.Lecturers, func(lecturer ScheduleItemLecturer) bool {
+		return m.lecturer(lecturer.Name)
+	}) {
+		return false
+	}
+
+	if m.room != nil && !m.room(item.RoomName) {
+		return false
+	}
+
+	if m.group != nil && !slices.ContainsFunc(item.Groups, m.group) {
+		return false
+	}
+
+	if m.weekday != 0 {
+		// item times are in the timezone of UEK, time.Weekday starts with Sunday as 0
+		weekday := int(item.Start.Weekday())
+		if weekday == 0 {
+			weekday = 7
+		}
+		if weekday != m.weekday {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Keeps tells if the item passes the filter
+func (f *ItemFilter) Keeps(item *ScheduleItem) bool {
+	if f == nil {
+		return true
+	}
+
+	if _, ok := f.hiddenSubjects[item.Subject]; ok {
+		return false
+	}
+
+	if len(f.include) > 0 && !slices.ContainsFunc(f.include, func(m *itemMatcher) bool {
+		return m.matches(item)
+	}) {
+		return false
+	}
+
+	return !slices.ContainsFunc(f.exclude, func(m *itemMatcher) bool {
+		return m.matches(item)
+	})
+}
+
+// Filter returns a copy of the schedule with items which pass the filter, conflicts with removed items are removed along with them
+func (a *AggregateSchedule) Filter(filter *ItemFilter) *AggregateSchedule {
+	if filter == nil {
+		return a
+	}
+
+	filtered := &AggregateSchedule{
+		Headers:   a.Headers,
+		Items:     make([]*ScheduleItem, 0, len(a.Items)),
+		Conflicts: []ScheduleConflict{},
+	}
+
+	newItemIdxs := make([]int, len(a.Items))
+	for i, item := range a.Items {
+		if !filter.Keeps(item) {
+			newItemIdxs[i] = -1
+			continue
+		}
+
+		newItemIdxs[i] = len(filtered.Items)
+		filtered.Items = append(filtered.Items, item)
+	}
+
+	for _, conflict := range a.Conflicts {
+		firstItemIdx, secondItemIdx := newItemIdxs[conflict.FirstItemIdx], newItemIdxs[conflict.SecondItemIdx]
+		if firstItemIdx == -1 || secondItemIdx == -1 {
+			continue
+		}
+
+		filtered.Conflicts = append(filtered.Conflicts, ScheduleConflict{
+			FirstItemIdx:  firstItemIdx,
+			SecondItemIdx: secondItemIdx,
+			Type:          conflict.Type,
+		})
+	}
+
+	return filtered
+}
@@ -0,0 +1,149 @@
+package uekschedule_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+func TestAggregateScheduleFilter(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Errorf("Failed to load location: %s", err)
+		return
+	}
+
+	at := func(day int, hour int) time.Time {
+		return time.Date(2025, time.October, day, hour, 0, 0, 0, loc)
+	}
+	createItem := func(day int, hour int, subject string, itemType string, lecturer string) *uekschedule.ScheduleItem {
+		return &uekschedule.ScheduleItem{
+			Start:   at(day, hour),
+			End:     at(day, hour+1),
+			Subject: subject,
+			Type:    itemType,
+			Lecturers: []uekschedule.ScheduleItemLecturer{
+				{Name: lecturer},
+			},
+			Groups: []string{"Group A"},
+		}
+	}
+
+	// 6th of October 2025 is a monday
+	aggregateSchedule := &uekschedule.AggregateSchedule{
+		Items: []*uekschedule.ScheduleItem{
+			createItem(6, 8, "Algebra", "wykład", "dr Jan Kowalski"),
+			createItem(6, 8, "Statystyka", "ćwiczenia", "dr Anna Nowak"),
+			createItem(6, 10, "Algebra", "ćwiczenia", "dr Anna Nowak"),
+			createItem(7, 8, "Język angielski", "lektorat", "mgr Piotr Wiśniewski"),
+			createItem(7, 8, "Algebra", "ćwiczenia", "dr Jan Kowalski"),
+		},
+		Conflicts: []uekschedule.ScheduleConflict{
+			{FirstItemIdx: 0, SecondItemIdx: 1, Type: uekschedule.ScheduleConflictTypeSameRoom},
+			{FirstItemIdx: 3, SecondItemIdx: 4, Type: uekschedule.ScheduleConflictTypeSameRoom},
+		},
+	}
+
+	for _, tc := range []struct {
+		name              string
+		rules             uekschedule.ItemFilterRules
+		expectedItemIdxs  []int
+		expectedConflicts []uekschedule.ScheduleConflict
+	}{
+		{
+			name: "lecture of a subject excluded",
+			rules: uekschedule.ItemFilterRules{
+				Exclude: []uekschedule.ItemRule{{Subject: "algebra", Type: "Wykład"}},
+			},
+			expectedItemIdxs: []int{1, 2, 3, 4},
+			expectedConflicts: []uekschedule.ScheduleConflict{
+				{FirstItemIdx: 2, SecondItemIdx: 3, Type: uekschedule.ScheduleConflictTypeSameRoom},
+			},
+		},
+		{
+			name: "lecturer included",
+			rules: uekschedule.ItemFilterRules{
+				Include: []uekschedule.ItemRule{{Lecturer: "Nowak$", Regex: true}},
+			},
+			expectedItemIdxs:  []int{1, 2},
+			expectedConflicts: []uekschedule.ScheduleConflict{},
+		},
+		{
+			name: "weekday and class type",
+			rules: uekschedule.ItemFilterRules{
+				Include: []uekschedule.ItemRule{{Weekday: 2}},
+				Exclude: []uekschedule.ItemRule{{Type: "lektorat"}},
+			},
+			expectedItemIdxs:  []int{4},
+			expectedConflicts: []uekschedule.ScheduleConflict{},
+		},
+	} {
+		filter, err := tc.rules.Compile()
+		if err != nil {
+			t.Errorf("%s: failed to compile filter: %s", tc.name, err)
+			return
+		}
+
+		filtered := aggregateSchedule.Filter(filter)
+		if len(filtered.Items) != len(tc.expectedItemIdxs) {
+			t.Errorf("%s: unexpected item count, got: %d, want: %d", tc.name, len(filtered.Items), len(tc.expectedItemIdxs))
+			return
+		}
+		for i, itemIdx := range tc.expectedItemIdxs {
+			if filtered.Items[i] != aggregateSchedule.Items[itemIdx] {
+				t.Errorf("%s: unexpected item at %d, got: %+v, want: %+v", tc.name, i, filtered.Items[i], aggregateSchedule.Items[itemIdx])
+				return
+			}
+		}
+
+		if len(filtered.Conflicts) != len(tc.expectedConflicts) {
+			t.Errorf("%s: unexpected conflicts, got: %+v, want: %+v", tc.name, filtered.Conflicts, tc.expectedConflicts)
+			return
+		}
+		for i := range tc.expectedConflicts {
+			if filtered.Conflicts[i] != tc.expectedConflicts[i] {
+				t.Errorf("%s: unexpected conflicts, got: %+v, want: %+v", tc.name, filtered.Conflicts, tc.expectedConflicts)
+				return
+			}
+		}
+	}
+
+	if len(aggregateSchedule.Items) != 5 || len(aggregateSchedule.Conflicts) != 2 {
+		t.Errorf("Filtering should not modify the original schedule")
+		return
+	}
+}
+
+func TestItemFilterRulesCompileInvalid(t *testing.T) {
+	for _, rules := range []uekschedule.ItemFilterRules{
+		{Exclude: []uekschedule.ItemRule{{}}},
+		{Exclude: []uekschedule.ItemRule{{Regex: true}}},
+		{Include: []uekschedule.ItemRule{{Weekday: 8}}},
+		{Include: []uekschedule.ItemRule{{Subject: "(", Regex: true}}},
+	} {
+		if _, err := rules.Compile(); err == nil {
+			t.Errorf("Expected an error for rules: %+v", rules)
+			return
+		}
+	}
+}
+
+func TestItemFilterHiddenSubjects(t *testing.T) {
+	hiddenSubjects := []string{"Algebra"}
+	for i := range 100 {
+		hiddenSubjects = append(hiddenSubjects, "Subject "+strconv.Itoa(i))
+	}
+
+	filter, err := uekschedule.ItemFilterRules{}.CompileHidingSubjects(hiddenSubjects)
+	if err != nil {
+		t.Errorf("Hidden subjects should not count towards the rule limit, got: %s", err)
+		return
+	}
+
+	if filter.Keeps(&uekschedule.ScheduleItem{Subject: "Algebra"}) || !filter.Keeps(&uekschedule.ScheduleItem{Subject: "Statystyka"}) {
+		t.Errorf("Only hidden subjects should be filtered out")
+		return
+	}
+}
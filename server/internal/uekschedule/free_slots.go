@@ -0,0 +1,98 @@
+package uekschedule
+
+import (
+	"fmt"
+	"time"
+)
+
+type FreeSlot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type FreeSlotParams struct {
+	From time.Time
+	To   time.Time
+	// DayStart and DayEnd limit slots to working hours, as offsets from local midnight
+	DayStart    time.Duration
+	DayEnd      time.Duration
+	MinDuration time.Duration
+	Location    *time.Location
+}
+
+func (p FreeSlotParams) Validate() error {
+	if !p.From.Before(p.To) {
+		return fmt.Errorf(errPrefix + "from should be before to")
+	}
+
+	if p.DayStart < 0 || p.DayEnd > 24*time.Hour || p.DayStart >= p.DayEnd {
+		return fmt.Errorf(errPrefix+"invalid working hours: %s-%s", p.DayStart, p.DayEnd)
+	}
+
+	if p.MinDuration <= 0 {
+		return fmt.Errorf(errPrefix + "min duration should be greater than 0")
+	}
+
+	if p.Location == nil {
+		return fmt.Errorf(errPrefix + "missing location")
+	}
+
+	return nil
+}
+
+// FindFreeSlots sweeps through items sorted by start time and returns gaps within working hours of every day in range, which are at least MinDuration long
+func FindFreeSlots(items []*ScheduleItem, params FreeSlotParams) []FreeSlot {
+	freeSlots := []FreeSlot{}
+	addFreeSlotIfLongEnough := func(start time.Time, end time.Time) {
+		if end.Sub(start) >= params.MinDuration {
+			freeSlots = append(freeSlots, FreeSlot{
+				Start: start,
+				End:   end,
+			})
+		}
+	}
+
+	from, to := params.From.In(params.Location), params.To.In(params.Location)
+	firstItemIdx := 0
+	for day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, params.Location); day.Before(to); day = day.AddDate(0, 0, 1) {
+		// time.Date instead of Add keeps working hours in wall clock time on days with DST changes
+		windowStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, int(params.DayStart), params.Location)
+		windowEnd := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, int(params.DayEnd), params.Location)
+		if windowStart.Before(from) {
+			windowStart = from
+		}
+		if windowEnd.After(to) {
+			windowEnd = to
+		}
+		if !windowStart.Before(windowEnd) {
+			continue
+		}
+
+		// items are sorted by start, so the ones which ended before this window can only be skipped while at the front
+		for firstItemIdx < len(items) && !items[firstItemIdx].End.After(windowStart) {
+			firstItemIdx++
+		}
+
+		freeFrom := windowStart
+		for _, item := range items[firstItemIdx:] {
+			if !item.Start.Before(windowEnd) {
+				break
+			}
+
+			if !item.OccupiesTime() || !item.End.After(freeFrom) {
+				continue
+			}
+
+			if item.Start.After(freeFrom) {
+				addFreeSlotIfLongEnough(freeFrom, item.Start)
+			}
+			freeFrom = item.End
+		}
+
+		if freeFrom.Before(windowEnd) {
+			addFreeSlotIfLongEnough(freeFrom, windowEnd)
+		}
+	}
+
+	return freeSlots
+}
@@ -0,0 +1,65 @@
+package uekschedule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+func TestFindFreeSlots(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Errorf("Failed to load location: %s", err)
+		return
+	}
+
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2025, time.October, day, hour, minute, 0, 0, loc)
+	}
+	createItem := func(start time.Time, end time.Time, itemType string) *uekschedule.ScheduleItem {
+		return &uekschedule.ScheduleItem{
+			Start:   start,
+			End:     end,
+			Subject: "Algebra",
+			Type:    itemType,
+		}
+	}
+
+	// items of different schedules overlap and one class of the first day was moved away
+	items := []*uekschedule.ScheduleItem{
+		createItem(at(6, 8, 0), at(6, 11, 30), "wykład"),
+		createItem(at(6, 9, 45), at(6, 11, 15), "ćwiczenia"),
+		createItem(at(6, 12, 0), at(6, 12, 45), "ćwiczenia"),
+		createItem(at(6, 13, 15), at(6, 15, 0), "przeniesienie zajęć"),
+		createItem(at(6, 15, 0), at(6, 17, 0), "ćwiczenia"),
+		createItem(at(7, 7, 0), at(7, 9, 0), "wykład"),
+		createItem(at(7, 17, 30), at(7, 21, 0), "wykład"),
+	}
+
+	freeSlots := uekschedule.FindFreeSlots(items, uekschedule.FreeSlotParams{
+		From:        at(6, 0, 0),
+		To:          at(8, 0, 0),
+		DayStart:    8 * time.Hour,
+		DayEnd:      18 * time.Hour,
+		MinDuration: time.Hour,
+		Location:    loc,
+	})
+
+	wantFreeSlots := []uekschedule.FreeSlot{
+		{Start: at(6, 12, 45), End: at(6, 15, 0)},
+		{Start: at(6, 17, 0), End: at(6, 18, 0)},
+		{Start: at(7, 9, 0), End: at(7, 17, 30)},
+	}
+
+	if len(freeSlots) != len(wantFreeSlots) {
+		t.Errorf("Unexpected free slots, got: %+v, want: %+v", freeSlots, wantFreeSlots)
+		return
+	}
+
+	for i := range freeSlots {
+		if !freeSlots[i].Start.Equal(wantFreeSlots[i].Start) || !freeSlots[i].End.Equal(wantFreeSlots[i].End) {
+			t.Errorf("Unexpected free slot at index %d, got: %+v, want: %+v", i, freeSlots[i], wantFreeSlots[i])
+		}
+	}
+}
@@ -12,7 +12,7 @@ type Grouping struct {
 
 func (c *Client) GetGroupings(ctx context.Context, callParams UEKCallParams) ([]Grouping, error) {
 	const groupingsUrl = baseUrl + "?xml"
-	res, err := c.callUEK(ctx, callParams, groupingsUrl)
+	res, err := c.callUEK(ctx, callParams, resourceKindGroupings, groupingsUrl)
 	if err != nil {
 		return nil, err
 	}
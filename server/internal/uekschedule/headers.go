@@ -9,12 +9,13 @@ import (
 )
 
 type ScheduleHeader struct {
-	Id   int    `json:"id"`
-	Name string `json:"name"`
+	Id   int          `json:"id"`
+	Name string       `json:"name"`
+	Type ScheduleType `json:"type,omitempty"`
 }
 
 func (c *Client) GetHeaders(ctx context.Context, callParams UEKCallParams, scheduleType ScheduleType, groupingName string) ([]ScheduleHeader, error) {
-	res, err := c.callUEK(ctx, callParams, fmt.Sprintf("%s?typ=%s&grupa=%s&xml", baseUrl, scheduleType, url.QueryEscape(groupingName)))
+	res, err := c.callUEK(ctx, callParams, resourceKindHeaders, fmt.Sprintf("%s?typ=%s&grupa=%s&xml", baseUrl, scheduleType, url.QueryEscape(groupingName)))
 	if err != nil {
 		return nil, err
 	}
@@ -43,6 +44,7 @@ func (res *responseBody) extractHeaders(requestedScheduleType ScheduleType) []Sc
 		headers = append(headers, ScheduleHeader{
 			Id:   headerId,
 			Name: headerName,
+			Type: requestedScheduleType,
 		})
 	}
 
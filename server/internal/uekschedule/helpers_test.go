@@ -0,0 +1,97 @@
+package uekschedule_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/bufferutil"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const testGroupingsResponse = `<plan-zajec><grupowanie typ="G" grupa="Grouping 1"/><grupowanie typ="S" grupa="Grouping 2"/></plan-zajec>`
+
+// testRoundTripper stands in for UEK, it responds with groupings unless a schedule is requested, and rejects the credentials "bad"
+type testRoundTripper struct {
+	// schedules are responses by schedule key, e.g. "G:1", regardless of the requested period
+	schedules map[string]string
+	// schedulesByPeriod are responses by period, regardless of the requested schedule
+	schedulesByPeriod map[string]string
+	// release blocks requests until it is closed, if it is set
+	release chan struct{}
+	// statusCode replaces every response if it is not 0
+	statusCode atomic.Int32
+	// failureCount is how many of the next requests fail as if UEK was unavailable
+	failureCount atomic.Int32
+
+	calls            atomic.Int32
+	mu               sync.Mutex
+	requestedPeriods []string
+}
+
+func (rt *testRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.calls.Add(1)
+
+	if rt.release != nil {
+		select {
+		case <-rt.release:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	if statusCode := int(rt.statusCode.Load()); statusCode != 0 {
+		return createTestResponse(statusCode, ""), nil
+	}
+
+	if failureCount := rt.failureCount.Load(); failureCount > 0 && rt.failureCount.CompareAndSwap(failureCount, failureCount-1) {
+		return createTestResponse(http.StatusBadGateway, ""), nil
+	}
+
+	if req.Header.Get("Authorization") == "Basic bad" {
+		return createTestResponse(http.StatusUnauthorized, ""), nil
+	}
+
+	queryParams := req.URL.Query()
+	if queryParams.Get("typ") == "" {
+		return createTestResponse(http.StatusOK, testGroupingsResponse), nil
+	}
+
+	period := queryParams.Get("okres")
+	rt.mu.Lock()
+	rt.requestedPeriods = append(rt.requestedPeriods, period)
+	rt.mu.Unlock()
+
+	body, ok := rt.schedules[queryParams.Get("typ")+":"+queryParams.Get("id")]
+	if rt.schedulesByPeriod != nil {
+		body, ok = rt.schedulesByPeriod[period]
+	}
+	if !ok {
+		return createTestResponse(http.StatusNotFound, ""), nil
+	}
+
+	return createTestResponse(http.StatusOK, body), nil
+}
+
+func createTestResponse(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func newTestClient(rt *testRoundTripper, cfg config.UEK, offlineStore *filestore.Store) (*uekschedule.Client, error) {
+	encryptionService, err := encryption.NewService(encryption.Key{Id: "1", Value: []byte("g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI="), OwnerHashValue: []byte("owner-g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI=")}, nil, bufferutil.NewBufferPool(8*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	return uekschedule.NewClient(&http.Client{Transport: rt}, slog.New(slog.DiscardHandler), cfg, offlineStore, encryptionService, nil)
+}
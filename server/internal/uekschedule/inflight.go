@@ -0,0 +1,74 @@
+package uekschedule
+
+import (
+	"context"
+	"sync"
+)
+
+// inflightGroup deduplicates identical concurrent calls, the shared call is only canceled once every caller waiting on it gives up
+type inflightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*inflightCall
+}
+
+type inflightCall struct {
+	done      chan struct{}
+	res       *responseBody
+	err       error
+	waiters   int
+	cancelCtx context.CancelFunc
+}
+
+func newInflightGroup() *inflightGroup {
+	return &inflightGroup{
+		calls: map[string]*inflightCall{},
+	}
+}
+
+func (g *inflightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (*responseBody, error)) (*responseBody, error) {
+	g.mu.Lock()
+	call, ok := g.calls[key]
+	if !ok {
+		callCtx, cancelCallCtx := context.WithCancel(context.WithoutCancel(ctx))
+		call = &inflightCall{
+			done:      make(chan struct{}),
+			cancelCtx: cancelCallCtx,
+		}
+		g.calls[key] = call
+
+		go func() {
+			defer cancelCallCtx()
+
+			call.res, call.err = fn(callCtx)
+
+			g.mu.Lock()
+			g.forget(key, call)
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.res, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancelCtx()
+			// callers arriving later should start a new call instead of joining the canceled one
+			g.forget(key, call)
+		}
+		g.mu.Unlock()
+
+		return nil, ctx.Err()
+	}
+}
+
+func (g *inflightGroup) forget(key string, call *inflightCall) {
+	if g.calls[key] == call {
+		delete(g.calls, key)
+	}
+}
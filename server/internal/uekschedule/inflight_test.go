@@ -0,0 +1,128 @@
+package uekschedule_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+func newBlockingTestClient() (*uekschedule.Client, *testRoundTripper, error) {
+	rt := &testRoundTripper{
+		release: make(chan struct{}),
+	}
+	client, err := newTestClient(rt, config.UEK{
+		MaxConcurrentRequests: 4,
+	}, nil)
+
+	return client, rt, err
+}
+
+func waitForCalls(rt *testRoundTripper, calls int32) {
+	deadline := time.Now().Add(time.Second)
+	for rt.calls.Load() < calls && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestInflightCoalescesIdenticalCalls(t *testing.T) {
+	client, rt, err := newBlockingTestClient()
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	const callerCount = 5
+	errs := make(chan error, callerCount)
+	for range callerCount {
+		go func() {
+			_, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{BasicAuthHeaderValue: "good"})
+			errs <- err
+		}()
+	}
+
+	waitForCalls(rt, 1)
+	time.Sleep(10 * time.Millisecond)
+	close(rt.release)
+
+	for range callerCount {
+		if err := <-errs; err != nil {
+			t.Errorf("Failed to get groupings: %s", err)
+			return
+		}
+	}
+
+	if calls := rt.calls.Load(); calls != 1 {
+		t.Errorf("Unexpected upstream call count, got: %d, want: %d", calls, 1)
+	}
+}
+
+func TestInflightSeparatesCredentials(t *testing.T) {
+	client, rt, err := newBlockingTestClient()
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	var goodErr, badErr error
+	wg.Go(func() {
+		_, goodErr = client.GetGroupings(context.Background(), uekschedule.UEKCallParams{BasicAuthHeaderValue: "good"})
+	})
+	wg.Go(func() {
+		_, badErr = client.GetGroupings(context.Background(), uekschedule.UEKCallParams{BasicAuthHeaderValue: "bad"})
+	})
+
+	waitForCalls(rt, 2)
+	close(rt.release)
+	wg.Wait()
+
+	if goodErr != nil {
+		t.Errorf("Failed to get groupings with good credentials: %s", goodErr)
+	}
+
+	if !errors.Is(badErr, uekschedule.ErrUnauthorized) {
+		t.Errorf("Unexpected error for bad credentials, got: %v, want: %s", badErr, uekschedule.ErrUnauthorized)
+	}
+}
+
+func TestInflightWaiterCancellation(t *testing.T) {
+	client, rt, err := newBlockingTestClient()
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	canceledCtx, cancelCtx := context.WithCancel(context.Background())
+	canceledErrCh := make(chan error, 1)
+	go func() {
+		_, err := client.GetGroupings(canceledCtx, uekschedule.UEKCallParams{})
+		canceledErrCh <- err
+	}()
+	waitForCalls(rt, 1)
+
+	waiterErrCh := make(chan error, 1)
+	go func() {
+		_, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{})
+		waiterErrCh <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	cancelCtx()
+	if err := <-canceledErrCh; !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error for canceled caller, got: %v, want: %s", err, context.Canceled)
+	}
+
+	close(rt.release)
+	if err := <-waiterErrCh; err != nil {
+		t.Errorf("Remaining waiter failed after other caller was canceled: %s", err)
+	}
+
+	if calls := rt.calls.Load(); calls != 1 {
+		t.Errorf("Unexpected upstream call count, got: %d, want: %d", calls, 1)
+	}
+}
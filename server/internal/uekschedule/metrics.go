@@ -0,0 +1,49 @@
+package uekschedule
+
+import (
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/metrics"
+)
+
+const (
+	cacheLookupResultHit   = "hit"
+	cacheLookupResultStale = "stale"
+	cacheLookupResultMiss  = "miss"
+)
+
+// clientMetrics are nil-safe, every metric ignores updates if the client was created without a registry
+type clientMetrics struct {
+	upstreamRequests        *metrics.Counter
+	upstreamRequestDuration *metrics.Histogram
+	cacheLookups            *metrics.Counter
+	offlineResponses        *metrics.Counter
+}
+
+func newClientMetrics(registry *metrics.Registry, c *Client) *clientMetrics {
+	cm := &clientMetrics{
+		upstreamRequests:        registry.NewCounter("uekpz4_uek_requests_total", "Requests made to UEK by status code, error if no response was received.", "code"),
+		upstreamRequestDuration: registry.NewHistogram("uekpz4_uek_request_duration_seconds", "Time to receive response headers from UEK, not including time spent waiting for a free request slot.", metrics.DurationBuckets),
+		cacheLookups:            registry.NewCounter("uekpz4_uek_cache_lookups_total", "Response cache lookups by result, stale responses are served while being revalidated.", "result"),
+		offlineResponses:        registry.NewCounter("uekpz4_uek_offline_responses_total", "Persisted responses served because UEK was unavailable."),
+	}
+
+	registry.NewGauge("uekpz4_uek_requests_in_flight", "Requests to UEK holding a request slot.").SetFunc(func() float64 {
+		return float64(len(c.maxConcurrentRequestsSemaphore))
+	})
+	registry.NewGauge("uekpz4_uek_requests_queued", "Requests to UEK waiting for a free request slot.").SetFunc(func() float64 {
+		return float64(c.semaphoreWaiting.Load())
+	})
+	registry.NewGauge("uekpz4_uek_cache_entries", "Responses in the response cache.").SetFunc(func() float64 {
+		if c.cache == nil {
+			return 0
+		}
+		return float64(c.cache.len())
+	})
+	registry.NewGauge("uekpz4_uek_breaker_open", "Whether the UEK circuit breaker is failing calls fast, 1 if open or half-open.").SetFunc(func() float64 {
+		if c.BreakerStatus().State == BreakerStateClosed {
+			return 0
+		}
+		return 1
+	})
+
+	return cm
+}
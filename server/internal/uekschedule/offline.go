@@ -0,0 +1,159 @@
+package uekschedule
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const offlineStoreKeyPrefix = "uek-responses/"
+
+const offlineStorePruneInterval = time.Hour
+
+// Staleness collects the oldest time at which responses served from offline storage during one request were fetched
+type Staleness struct {
+	mu        sync.Mutex
+	fetchedAt time.Time
+}
+
+// FetchedAt is zero if every response came from UEK or the cache
+func (s *Staleness) FetchedAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.fetchedAt
+}
+
+func (s *Staleness) mark(fetchedAt time.Time) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fetchedAt.IsZero() || fetchedAt.Before(s.fetchedAt) {
+		s.fetchedAt = fetchedAt
+	}
+}
+
+// the body is encrypted, since responses hold schedules only meant for whoever owns the credentials
+type storedResponse struct {
+	FetchedAt     time.Time `json:"fetchedAt"`
+	EncryptedBody string    `json:"encryptedBody"`
+}
+
+// call keys include credentials and long urls, hashing keeps file names short and does not leak them
+func createOfflineStoreKey(callKey string) string {
+	callKeyHash := sha256.Sum256([]byte(callKey))
+	return offlineStoreKeyPrefix + hex.EncodeToString(callKeyHash[:])
+}
+
+func (c *Client) persistResponse(callKey string, res *responseBody, now time.Time) {
+	if c.offlineStore == nil {
+		return
+	}
+
+	encodedRes, err := json.Marshal(res)
+	if err != nil {
+		c.logger.Warn("Failed to encode UEK response", slog.Any("err", err))
+		return
+	}
+
+	encryptedRes, err := c.encryption.EncryptText(string(encodedRes))
+	if err != nil {
+		c.logger.Warn("Failed to encrypt UEK response", slog.Any("err", err))
+		return
+	}
+
+	if err := c.offlineStore.Put(createOfflineStoreKey(callKey), &storedResponse{
+		FetchedAt:     now,
+		EncryptedBody: encryptedRes,
+	}); err != nil {
+		c.logger.Warn("Failed to persist UEK response", slog.Any("err", err))
+	}
+}
+
+func (c *Client) loadPersistedResponse(callKey string, now time.Time) (*responseBody, time.Time, bool) {
+	if c.offlineStore == nil {
+		return nil, time.Time{}, false
+	}
+
+	storeKey := createOfflineStoreKey(callKey)
+	storedRes := &storedResponse{}
+	if ok, err := c.offlineStore.Get(storeKey, storedRes); err != nil {
+		c.logger.Warn("Failed to load persisted UEK response", slog.Any("err", err))
+		return nil, time.Time{}, false
+	} else if !ok {
+		return nil, time.Time{}, false
+	}
+
+	if now.Sub(storedRes.FetchedAt) > c.cfg.OfflineFallbackMaxAge {
+		if err := c.offlineStore.Delete(storeKey); err != nil {
+			c.logger.Warn("Failed to delete expired UEK response", slog.Any("err", err))
+		}
+		return nil, time.Time{}, false
+	}
+
+	// responses encrypted with a key which was since removed cannot be served either
+	res := &responseBody{}
+	if decryptedRes, err := c.encryption.DecryptText(storedRes.EncryptedBody); err != nil || json.Unmarshal([]byte(decryptedRes), res) != nil {
+		if err := c.offlineStore.Delete(storeKey); err != nil {
+			c.logger.Warn("Failed to delete undecryptable UEK response", slog.Any("err", err))
+		}
+		return nil, time.Time{}, false
+	}
+
+	return res, storedRes.FetchedAt, true
+}
+
+// RunOfflineStorePruning deletes expired responses until ctx is canceled, every credential and url has its own file, so they would pile up otherwise
+func (c *Client) RunOfflineStorePruning(ctx context.Context) {
+	if c.offlineStore == nil {
+		return
+	}
+
+	ticker := time.NewTicker(offlineStorePruneInterval)
+	defer ticker.Stop()
+
+	for {
+		c.PruneOfflineStore(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) PruneOfflineStore(now time.Time) {
+	if c.offlineStore == nil {
+		return
+	}
+
+	storeKeys, err := c.offlineStore.Keys(offlineStoreKeyPrefix)
+	if err != nil {
+		c.logger.Warn("Failed to list persisted UEK responses", slog.Any("err", err))
+		return
+	}
+
+	for _, storeKey := range storeKeys {
+		// the body is not needed to tell if the response expired
+		storedRes := &struct {
+			FetchedAt time.Time `json:"fetchedAt"`
+		}{}
+		if ok, err := c.offlineStore.Get(storeKey, storedRes); err == nil && (!ok || now.Sub(storedRes.FetchedAt) <= c.cfg.OfflineFallbackMaxAge) {
+			continue
+		}
+
+		// responses which cannot be decoded are of no use either
+		if err := c.offlineStore.Delete(storeKey); err != nil {
+			c.logger.Warn("Failed to delete expired UEK response", slog.Any("err", err))
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package uekschedule_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+func TestOfflineFallback(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+
+	rt := &testRoundTripper{}
+	client, err := newTestClient(rt, config.UEK{
+		MaxConcurrentRequests: 1,
+		OfflineFallbackMaxAge: time.Hour,
+	}, store)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	getGroupings := func(basicAuthValue string) ([]uekschedule.Grouping, *uekschedule.Staleness, error) {
+		staleness := &uekschedule.Staleness{}
+		groupings, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{
+			BasicAuthHeaderValue: basicAuthValue,
+			Staleness:            staleness,
+		})
+		return groupings, staleness, err
+	}
+
+	if _, staleness, err := getGroupings("a"); err != nil || !staleness.FetchedAt().IsZero() {
+		t.Errorf("Unexpected result while UEK is available, staleness: %v, err: %v", staleness.FetchedAt(), err)
+		return
+	}
+
+	storeKeys, err := store.Keys("uek-responses/")
+	if err != nil || len(storeKeys) != 1 {
+		t.Errorf("Unexpected persisted responses, got: %v, err: %v", storeKeys, err)
+		return
+	}
+
+	storedRes := json.RawMessage{}
+	if _, err := store.Get(storeKeys[0], &storedRes); err != nil || strings.Contains(string(storedRes), "Grouping 1") {
+		t.Errorf("Persisted response should be encrypted, got: %s, err: %v", storedRes, err)
+		return
+	}
+
+	rt.statusCode.Store(http.StatusServiceUnavailable)
+
+	groupings, staleness, err := getGroupings("a")
+	if err != nil || len(groupings) != 2 || staleness.FetchedAt().IsZero() {
+		t.Errorf("Persisted response was not served, groupings: %+v, staleness: %v, err: %v", groupings, staleness.FetchedAt(), err)
+	}
+
+	if _, _, err := getGroupings("b"); err == nil {
+		t.Errorf("Persisted response was served to different credentials")
+	}
+
+	rt.statusCode.Store(http.StatusUnauthorized)
+
+	if _, _, err := getGroupings("a"); err != uekschedule.ErrUnauthorized {
+		t.Errorf("Unexpected error for rejected credentials: %v", err)
+	}
+}
+
+func TestOfflineStorePruning(t *testing.T) {
+	store, err := filestore.New(t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create store: %s", err)
+		return
+	}
+
+	rt := &testRoundTripper{}
+	client, err := newTestClient(rt, config.UEK{
+		MaxConcurrentRequests: 1,
+		OfflineFallbackMaxAge: time.Hour,
+	}, store)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	// the second client shares the store, but every response is expired for it
+	expiringClient, err := newTestClient(rt, config.UEK{
+		MaxConcurrentRequests: 1,
+		OfflineFallbackMaxAge: time.Nanosecond,
+	}, store)
+	if err != nil {
+		t.Errorf("Failed to create expiring client: %s", err)
+		return
+	}
+
+	checkPersistedResponseCount := func(msg string, want int) bool {
+		storeKeys, err := store.Keys("uek-responses/")
+		if err != nil || len(storeKeys) != want {
+			t.Errorf("%s, got: %d, want: %d, err: %v", msg, len(storeKeys), want, err)
+			return false
+		}
+		return true
+	}
+
+	for _, basicAuthValue := range []string{"a", "b"} {
+		if _, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{BasicAuthHeaderValue: basicAuthValue}); err != nil {
+			t.Errorf("Failed to get groupings: %s", err)
+			return
+		}
+	}
+	if !checkPersistedResponseCount("Unexpected persisted response count", 2) {
+		return
+	}
+
+	client.PruneOfflineStore(time.Now())
+	if !checkPersistedResponseCount("Responses which did not expire should not be pruned", 2) {
+		return
+	}
+
+	rt.statusCode.Store(http.StatusServiceUnavailable)
+	if _, err := expiringClient.GetGroupings(context.Background(), uekschedule.UEKCallParams{BasicAuthHeaderValue: "a"}); err == nil {
+		t.Errorf("Expired response should not be served")
+		return
+	}
+	if !checkPersistedResponseCount("Expired response should have been deleted when read", 1) {
+		return
+	}
+
+	expiringClient.PruneOfflineStore(time.Now())
+	checkPersistedResponseCount("Expired responses should have been pruned", 0)
+}
@@ -16,12 +16,12 @@ func (res *responseBody) extractPeriods(loc *time.Location) ([]SchedulePeriod, e
 	for i, originalPeriod := range res.Okres {
 		start, err := time.ParseInLocation("2006-01-02 15:04", fmt.Sprintf("%s 00:00", originalPeriod.Od), loc)
 		if err != nil {
-			return nil, fmt.Errorf(errPrefix+"failed to parse period start date at index %d: %w", i, err)
+			return nil, &ParseError{ItemIdx: -1, Err: fmt.Errorf("failed to parse period start date at index %d: %w", i, err)}
 		}
 
 		end, err := time.ParseInLocation("2006-01-02 15:04", fmt.Sprintf("%s 23:59", originalPeriod.Do), loc)
 		if err != nil {
-			return nil, fmt.Errorf(errPrefix+"failed to parse period end date at index %d: %w", i, err)
+			return nil, &ParseError{ItemIdx: -1, Err: fmt.Errorf("failed to parse period end date at index %d: %w", i, err)}
 		}
 
 		periods = append(periods, SchedulePeriod{
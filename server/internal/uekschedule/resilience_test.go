@@ -0,0 +1,99 @@
+package uekschedule_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+// newFlakyTestClient creates a client calling UEK which fails the first failureCount requests
+func newFlakyTestClient(cfg config.UEK, failureCount int32) (*uekschedule.Client, *testRoundTripper, error) {
+	rt := &testRoundTripper{}
+	rt.failureCount.Store(failureCount)
+	client, err := newTestClient(rt, cfg, nil)
+
+	return client, rt, err
+}
+
+func TestRetriesTransientFailures(t *testing.T) {
+	client, rt, err := newFlakyTestClient(config.UEK{
+		MaxConcurrentRequests: 1,
+		MaxRetries:            2,
+		RetryBaseDelay:        time.Millisecond,
+		RetryMaxDelay:         time.Millisecond,
+	}, 2)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	if _, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{}); err != nil {
+		t.Errorf("Failed to get groupings: %s", err)
+	}
+
+	if rt.calls.Load() != 3 {
+		t.Errorf("Unexpected request count, got: %d, want: %d", rt.calls.Load(), 3)
+	}
+}
+
+func TestCircuitBreakerFailsFast(t *testing.T) {
+	client, rt, err := newFlakyTestClient(config.UEK{
+		MaxConcurrentRequests:   1,
+		BreakerFailureThreshold: 2,
+		BreakerOpenDuration:     50 * time.Millisecond,
+	}, 2)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	for range 2 {
+		if _, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{}); err == nil {
+			t.Errorf("Expected an error from failing upstream")
+		}
+	}
+
+	if _, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{}); !errors.Is(err, uekschedule.ErrUpstreamUnavailable) {
+		t.Errorf("Unexpected error while breaker is open: %v", err)
+	}
+
+	if rt.calls.Load() != 2 || client.BreakerStatus().State != uekschedule.BreakerStateOpen {
+		t.Errorf("Breaker did not open, request count: %d, status: %+v", rt.calls.Load(), client.BreakerStatus())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err := client.GetGroupings(context.Background(), uekschedule.UEKCallParams{}); err != nil {
+		t.Errorf("Probe request failed: %s", err)
+	}
+
+	if client.BreakerStatus().State != uekschedule.BreakerStateClosed {
+		t.Errorf("Breaker did not close after successful probe: %+v", client.BreakerStatus())
+	}
+}
+
+func TestProbe(t *testing.T) {
+	rt := &testRoundTripper{}
+	client, err := newTestClient(rt, config.UEK{
+		MaxConcurrentRequests: 1,
+	}, nil)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	rt.statusCode.Store(http.StatusUnauthorized)
+	if err := client.Probe(context.Background()); err != nil {
+		t.Errorf("Probe failed although UEK responded: %s", err)
+	}
+
+	rt.statusCode.Store(http.StatusBadGateway)
+	if err := client.Probe(context.Background()); !errors.Is(err, uekschedule.ErrUpstreamUnavailable) {
+		t.Errorf("Unexpected probe error while UEK is unavailable: %v", err)
+	}
+}
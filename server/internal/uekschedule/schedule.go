@@ -25,6 +25,8 @@ type ScheduleItem struct {
 	RoomName  string                 `json:"roomName,omitempty"`
 	RoomUrl   string                 `json:"roomUrl,omitempty"`
 	Extra     string                 `json:"extra,omitempty"`
+	// lecturersIncomplete is set for items from lecturer schedules, which only list the lecturer whose schedule it is
+	lecturersIncomplete bool
 }
 
 type ScheduleItemLecturer struct {
@@ -51,8 +53,18 @@ func (a *ScheduleItem) Compare(b *ScheduleItem) int {
 	return strings.Compare(a.Type, b.Type)
 }
 
+// OccupiesTime is false for items which only mark the old slot of a moved class
+func (item *ScheduleItem) OccupiesTime() bool {
+	return item.Type != "przeniesienie zajęć"
+}
+
+// IsOnline matches what the web client shows as online classes
+func (item *ScheduleItem) IsOnline() bool {
+	return item.RoomUrl != "" || item.RoomName == "Platforma Moodle"
+}
+
 func (c *Client) GetSchedule(ctx context.Context, callParams UEKCallParams, scheduleType ScheduleType, scheduleId int, periodIdx int) (*Schedule, []SchedulePeriod, error) {
-	res, err := c.callUEK(ctx, callParams, fmt.Sprintf("%s?typ=%s&id=%d&okres=%d&xml", baseUrl, scheduleType, scheduleId, periodIdx+1))
+	res, err := c.callUEK(ctx, callParams, resourceKindSchedule, fmt.Sprintf("%s?typ=%s&id=%d&okres=%d&xml", baseUrl, scheduleType, scheduleId, periodIdx+1))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -62,28 +74,38 @@ func (c *Client) GetSchedule(ctx context.Context, callParams UEKCallParams, sche
 		return nil, nil, err
 	}
 
+	// whatever UEK responds with for a period past the list, it is not the requested one
+	if len(periods) > 0 && periodIdx >= len(periods) {
+		return nil, nil, fmt.Errorf("%w: period index %d out of %d periods", ErrInvalidPeriod, periodIdx, len(periods))
+	}
+
 	return schedule, periods, nil
 }
 
 var scheduleItemRoomLinkRegex = regexp.MustCompile(`^<a href="(.+)">(.+)<\/a>$`)
 
 func (res *responseBody) extractSchedule(requestedScheduleType ScheduleType, requestedScheduleId int, loc *time.Location) (*Schedule, []SchedulePeriod, error) {
+	// UEK responds with an empty document for schedules that do not exist
+	if res.Typ == "" && res.Id == "" {
+		return nil, nil, ErrNotFound
+	}
+
 	if res.Typ != requestedScheduleType {
-		return nil, nil, fmt.Errorf(errPrefix+"received different schedule type than requested: %s", res.Typ)
+		return nil, nil, &ParseError{ItemIdx: -1, Err: fmt.Errorf("received different schedule type than requested: %s", res.Typ)}
 	}
 
 	receivedScheduleId, err := strconv.Atoi(res.Id)
 	if err != nil {
-		return nil, nil, fmt.Errorf(errPrefix+"cannot parse schedule id as number: %w", err)
+		return nil, nil, &ParseError{ItemIdx: -1, Err: fmt.Errorf("cannot parse schedule id as number: %w", err)}
 	}
 
 	if receivedScheduleId != requestedScheduleId {
-		return nil, nil, fmt.Errorf(errPrefix+"received different schedule id than requested: %d", receivedScheduleId)
+		return nil, nil, &ParseError{ItemIdx: -1, Err: fmt.Errorf("received different schedule id than requested: %d", receivedScheduleId)}
 	}
 
 	scheduleName := strings.TrimSpace(res.Nazwa)
 	if scheduleName == "" {
-		return nil, nil, fmt.Errorf(errPrefix + "missing schedule name")
+		return nil, nil, &ParseError{ItemIdx: -1, Err: fmt.Errorf("missing schedule name")}
 	}
 
 	groupsFromSchedule := []string{scheduleName}
@@ -95,7 +117,7 @@ func (res *responseBody) extractSchedule(requestedScheduleType ScheduleType, req
 
 	if scheduleMoodleCourseIdRaw := strings.TrimSpace(res.Idcel); scheduleMoodleCourseIdRaw != "" {
 		if lecturersFromSchedule[0].MoodleCourseId, err = parseMoodleId(scheduleMoodleCourseIdRaw); err != nil {
-			return nil, nil, fmt.Errorf(errPrefix+"%w", err)
+			return nil, nil, &ParseError{ItemIdx: -1, Err: err}
 		}
 	}
 
@@ -138,6 +160,7 @@ func (res *responseBody) extractSchedule(requestedScheduleType ScheduleType, req
 
 			if res.Typ == ScheduleTypeLecturer {
 				item.Lecturers = lecturersFromSchedule
+				item.lecturersIncomplete = true
 			} else {
 				item.Lecturers = make([]ScheduleItemLecturer, 0, len(resItem.Nauczyciel))
 				for j, resItemLecturer := range resItem.Nauczyciel {
@@ -179,7 +202,7 @@ func (res *responseBody) extractSchedule(requestedScheduleType ScheduleType, req
 			items = append(items, item)
 			return nil
 		}(); err != nil {
-			return nil, nil, fmt.Errorf(errPrefix+"%w at item index %d", err, i)
+			return nil, nil, &ParseError{ItemIdx: i, Err: err}
 		}
 	}
 
@@ -196,6 +219,7 @@ func (res *responseBody) extractSchedule(requestedScheduleType ScheduleType, req
 		Header: ScheduleHeader{
 			Id:   receivedScheduleId,
 			Name: scheduleName,
+			Type: res.Typ,
 		},
 		Items: items,
 	}, periods, nil
@@ -0,0 +1,53 @@
+package uekschedule
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ScheduleKey identifies a single schedule of any type
+type ScheduleKey struct {
+	Type ScheduleType `json:"type"`
+	Id   int          `json:"id"`
+}
+
+func (sk ScheduleKey) Validate() error {
+	return sk.Type.Validate()
+}
+
+func (sk ScheduleKey) String() string {
+	return string(sk.Type) + ":" + strconv.Itoa(sk.Id)
+}
+
+func (a ScheduleKey) Compare(b ScheduleKey) int {
+	if typeCompareResult := strings.Compare(string(a.Type), string(b.Type)); typeCompareResult != 0 {
+		return typeCompareResult
+	}
+
+	return cmp.Compare(a.Id, b.Id)
+}
+
+// ParseScheduleKey parses the format returned by ScheduleKey.String, e.g. "G:123"
+func ParseScheduleKey(raw string) (ScheduleKey, error) {
+	rawType, rawId, ok := strings.Cut(strings.TrimSpace(raw), ":")
+	if !ok {
+		return ScheduleKey{}, fmt.Errorf(errPrefix+"invalid schedule key: %s", raw)
+	}
+
+	scheduleType := ScheduleType(rawType)
+	if err := scheduleType.Validate(); err != nil {
+		return ScheduleKey{}, err
+	}
+
+	scheduleId, err := strconv.Atoi(rawId)
+	if err != nil {
+		return ScheduleKey{}, fmt.Errorf(errPrefix+"invalid schedule id in schedule key: %w", err)
+	}
+
+	return ScheduleKey{
+		Type: scheduleType,
+		Id:   scheduleId,
+	}, nil
+}
@@ -0,0 +1,148 @@
+package uekschedule
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/tracing"
+	"golang.org/x/sync/errgroup"
+)
+
+// PeriodSelection picks which part of a schedule to fetch, either a single UEK period or an explicit date range that can span any number of periods
+type PeriodSelection struct {
+	PeriodIdx int
+	// From is inclusive, To is exclusive, both have to be set for the range to be used
+	From time.Time
+	To   time.Time
+}
+
+func (ps PeriodSelection) HasRange() bool {
+	return !ps.From.IsZero() && !ps.To.IsZero()
+}
+
+func (ps PeriodSelection) Validate() error {
+	if ps.HasRange() {
+		if !ps.From.Before(ps.To) {
+			return fmt.Errorf("%w: range start must be before range end", ErrInvalidPeriod)
+		}
+		return nil
+	}
+
+	if ps.PeriodIdx < 0 {
+		return fmt.Errorf("%w: negative period index: %d", ErrInvalidPeriod, ps.PeriodIdx)
+	}
+
+	return nil
+}
+
+func (c *Client) getScheduleForPeriodSelection(ctx context.Context, callParams UEKCallParams, scheduleType ScheduleType, scheduleId int, periodSelection PeriodSelection) (*Schedule, []SchedulePeriod, error) {
+	ctx, span := tracing.StartSpan(ctx, "uekschedule.getSchedule", tracing.SpanKindInternal, slog.String("scheduleType", string(scheduleType)), slog.Int("scheduleId", scheduleId))
+	defer span.End()
+
+	if err := periodSelection.Validate(); err != nil {
+		span.RecordError(err)
+		return nil, nil, err
+	}
+
+	var schedule *Schedule
+	var periods []SchedulePeriod
+	var err error
+	if periodSelection.HasRange() {
+		schedule, periods, err = c.GetScheduleInRange(ctx, callParams, scheduleType, scheduleId, periodSelection.From, periodSelection.To)
+	} else {
+		schedule, periods, err = c.GetSchedule(ctx, callParams, scheduleType, scheduleId, periodSelection.PeriodIdx)
+	}
+	span.RecordError(err)
+
+	return schedule, periods, err
+}
+
+// GetScheduleInRange fetches every UEK period needed to cover the range and returns items overlapping it, from is inclusive and to is exclusive
+func (c *Client) GetScheduleInRange(ctx context.Context, callParams UEKCallParams, scheduleType ScheduleType, scheduleId int, from time.Time, to time.Time) (*Schedule, []SchedulePeriod, error) {
+	// the first period has to be fetched anyway to know what periods are there
+	firstPeriodSchedule, periods, err := c.GetSchedule(ctx, callParams, scheduleType, scheduleId, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	periodIdxs := selectPeriodIdxsCoveringRange(periods, from, to)
+	periodSchedules := make([]*Schedule, len(periodIdxs))
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	for i, periodIdx := range periodIdxs {
+		if periodIdx == 0 {
+			periodSchedules[i] = firstPeriodSchedule
+			continue
+		}
+
+		eg.Go(func() error {
+			schedule, _, err := c.GetSchedule(egCtx, callParams, scheduleType, scheduleId, periodIdx)
+			if err != nil {
+				return err
+			}
+
+			periodSchedules[i] = schedule
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return nil, nil, err
+	}
+
+	// periods can overlap, merging takes care of items present in more than one of them
+	mergedSchedule, _ := mergeSchedules(periodSchedules)
+
+	return &Schedule{
+		Header: firstPeriodSchedule.Header,
+		Items:  trimItemsToRange(mergedSchedule.Items, from, to),
+	}, periods, nil
+}
+
+// selectPeriodIdxsCoveringRange prefers the shortest single period containing the whole range, and falls back to every period overlapping it
+func selectPeriodIdxsCoveringRange(periods []SchedulePeriod, from time.Time, to time.Time) []int {
+	bestCoveringPeriodIdx := -1
+	overlappingPeriodIdxs := []int{}
+
+	for i, period := range periods {
+		// period end is the last minute of its last day
+		periodEnd := period.End.Add(time.Minute)
+		if !period.Start.Before(to) || !periodEnd.After(from) {
+			continue
+		}
+		overlappingPeriodIdxs = append(overlappingPeriodIdxs, i)
+
+		if !period.Start.After(from) && !periodEnd.Before(to) {
+			if bestCoveringPeriodIdx == -1 || period.End.Sub(period.Start) < periods[bestCoveringPeriodIdx].End.Sub(periods[bestCoveringPeriodIdx].Start) {
+				bestCoveringPeriodIdx = i
+			}
+		}
+	}
+
+	if bestCoveringPeriodIdx != -1 {
+		return []int{bestCoveringPeriodIdx}
+	}
+
+	return overlappingPeriodIdxs
+}
+
+func trimItemsToRange(items []*ScheduleItem, from time.Time, to time.Time) []*ScheduleItem {
+	trimmedItems := make([]*ScheduleItem, 0, len(items))
+	for _, item := range items {
+		if item.End.After(from) && item.Start.Before(to) {
+			trimmedItems = append(trimmedItems, item)
+		}
+	}
+
+	return trimmedItems
+}
+
+func (ps PeriodSelection) LogValue() slog.Value {
+	if ps.HasRange() {
+		return slog.GroupValue(slog.Time("from", ps.From), slog.Time("to", ps.To))
+	}
+
+	return slog.GroupValue(slog.Int("periodIdx", ps.PeriodIdx))
+}
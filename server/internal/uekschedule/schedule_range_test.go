@@ -0,0 +1,84 @@
+package uekschedule_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const testSchedulePeriods = `<okres od="2025-10-01" do="2026-02-28"/><okres od="2026-03-01" do="2026-09-30"/><okres od="2026-03-01" do="2026-03-15"/>`
+
+var testScheduleResponsesByPeriod = map[string]string{
+	"1": `<plan-zajec typ="G" id="123" nazwa="Group A">` + testSchedulePeriods + `
+		<zajecia><termin>2026-02-20</termin><od-godz>08:00</od-godz><do-godz>09:30</do-godz><przedmiot>Winter</przedmiot><typ>wykład</typ></zajecia>
+		<zajecia><termin>2026-02-27</termin><od-godz>08:00</od-godz><do-godz>09:30</do-godz><przedmiot>Boundary</przedmiot><typ>wykład</typ></zajecia>
+	</plan-zajec>`,
+	"2": `<plan-zajec typ="G" id="123" nazwa="Group A">` + testSchedulePeriods + `
+		<zajecia><termin>2026-02-27</termin><od-godz>08:00</od-godz><do-godz>09:30</do-godz><przedmiot>Boundary</przedmiot><typ>wykład</typ></zajecia>
+		<zajecia><termin>2026-03-05</termin><od-godz>10:00</od-godz><do-godz>11:30</do-godz><przedmiot>Summer</przedmiot><typ>ćwiczenia</typ></zajecia>
+		<zajecia><termin>2026-04-05</termin><od-godz>10:00</od-godz><do-godz>11:30</do-godz><przedmiot>Out of range</przedmiot><typ>ćwiczenia</typ></zajecia>
+	</plan-zajec>`,
+	"3": `<plan-zajec typ="G" id="123" nazwa="Group A">` + testSchedulePeriods + `
+		<zajecia><termin>2026-03-05</termin><od-godz>10:00</od-godz><do-godz>11:30</do-godz><przedmiot>Summer</przedmiot><typ>ćwiczenia</typ></zajecia>
+	</plan-zajec>`,
+}
+
+func TestGetScheduleInRangeSpansPeriods(t *testing.T) {
+	rt := &testRoundTripper{schedulesByPeriod: testScheduleResponsesByPeriod}
+	client, err := newTestClient(rt, config.UEK{
+		MaxConcurrentRequests: 2,
+	}, nil)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	from := time.Date(2026, time.February, 21, 0, 0, 0, 0, client.Location())
+	to := time.Date(2026, time.March, 10, 0, 0, 0, 0, client.Location())
+
+	schedule, periods, err := client.GetScheduleInRange(context.Background(), uekschedule.UEKCallParams{}, uekschedule.ScheduleTypeGroup, 123, from, to)
+	if err != nil {
+		t.Errorf("Failed to get schedule in range: %s", err)
+		return
+	}
+
+	if len(periods) != 3 {
+		t.Errorf("Unexpected period count, got: %d, want: %d", len(periods), 3)
+	}
+
+	gotSubjects := []string{}
+	for _, item := range schedule.Items {
+		gotSubjects = append(gotSubjects, item.Subject)
+	}
+	wantSubjects := []string{"Boundary", "Summer"}
+	if strings.Join(gotSubjects, ",") != strings.Join(wantSubjects, ",") {
+		t.Errorf("Unexpected items, got: %v, want: %v", gotSubjects, wantSubjects)
+	}
+}
+
+func TestGetScheduleInRangePrefersSingleCoveringPeriod(t *testing.T) {
+	rt := &testRoundTripper{schedulesByPeriod: testScheduleResponsesByPeriod}
+	client, err := newTestClient(rt, config.UEK{
+		MaxConcurrentRequests: 2,
+	}, nil)
+	if err != nil {
+		t.Errorf("Failed to create client: %s", err)
+		return
+	}
+
+	from := time.Date(2026, time.March, 1, 0, 0, 0, 0, client.Location())
+	to := time.Date(2026, time.March, 10, 0, 0, 0, 0, client.Location())
+
+	if _, _, err := client.GetScheduleInRange(context.Background(), uekschedule.UEKCallParams{}, uekschedule.ScheduleTypeGroup, 123, from, to); err != nil {
+		t.Errorf("Failed to get schedule in range: %s", err)
+		return
+	}
+
+	if got := strings.Join(rt.requestedPeriods, ","); got != "1,3" {
+		t.Errorf("Unexpected requested periods, got: %s, want: %s", got, "1,3")
+	}
+}
@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var ErrForbiddenTarget = errors.New(errPrefix + "target address is not public")
+
+// NewHTTPClient creates a client for delivering notifications, which refuses to connect to addresses which are not public unless allowPrivateTargets is set.
+// Addresses are checked when connecting rather than when subscribing, so that DNS cannot resolve to something else later, and redirects are not followed
+func NewHTTPClient(timeout time.Duration, allowPrivateTargets bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+	}
+	if !allowPrivateTargets {
+		dialer.Control = func(network string, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !isPublicAddr(addrPort.Addr()) {
+				return ErrForbiddenTarget
+			}
+
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would connect to the target instead of the dialer
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// blockedPrefixes are the special purpose ranges of IANA which are not reachable from the internet, or reach something else than the address says.
+// They are listed explicitly, since netip only knows some of them, e.g. not the shared address space used by internal networks of hosting providers
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.88.99.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/127"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("fec0::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// nat64Prefix translates the IPv4 address in the last 4 bytes, which decides if the address is public
+var nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+func isPublicAddr(addr netip.Addr) bool {
+	// prefixes never contain addresses with a zone
+	addr = addr.Unmap().WithZone("")
+	if !addr.IsValid() {
+		return false
+	}
+
+	if nat64Prefix.Contains(addr) {
+		addrBuff := addr.As16()
+		return isPublicAddr(netip.AddrFrom4([4]byte(addrBuff[12:])))
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const SignatureHeader = "X-UEKPZ4-Signature"
+const TimestampHeader = "X-UEKPZ4-Timestamp"
+
+const maxChatMessageLength = 1900
+
+type Format string
+
+const (
+	// FormatJSON sends the whole diff, for custom integrations
+	FormatJSON Format = "json"
+	// FormatDiscord sends a text message in Discord webhook format
+	FormatDiscord Format = "discord"
+	// FormatSlack sends a text message in Slack incoming webhook format, which is also understood by Matrix hookshot
+	FormatSlack Format = "slack"
+)
+
+func (f Format) IsValid() bool {
+	return f == FormatJSON || f == FormatDiscord || f == FormatSlack
+}
+
+type Notification struct {
+	SubscriptionId string                       `json:"subscriptionId"`
+	Schedules      []uekschedule.ScheduleHeader `json:"schedules"`
+	DetectedAt     time.Time                    `json:"detectedAt"`
+	*uekschedule.ScheduleDiff
+}
+
+// Notifier delivers notifications about schedule changes to subscription targets
+type Notifier interface {
+	Notify(ctx context.Context, subscription *Subscription, notification *Notification) error
+}
+
+type HTTPNotifier struct {
+	httpClient  *http.Client
+	maxAttempts int
+	retryDelay  time.Duration
+	location    *time.Location
+}
+
+func NewHTTPNotifier(httpClient *http.Client, maxAttempts int, retryDelay time.Duration, location *time.Location) *HTTPNotifier {
+	return &HTTPNotifier{
+		httpClient:  httpClient,
+		maxAttempts: max(maxAttempts, 1),
+		retryDelay:  retryDelay,
+		location:    location,
+	}
+}
+
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Notify retries with exponential backoff on connection errors, 5xx and 429 responses
+func (n *HTTPNotifier) Notify(ctx context.Context, subscription *Subscription, notification *Notification) error {
+	body, err := n.createBody(subscription.Format, notification)
+	if err != nil {
+		return fmt.Errorf(errPrefix+"failed to create body: %w", err)
+	}
+
+	retryDelay := n.retryDelay
+	for attempt := 1; ; attempt++ {
+		err := n.send(ctx, subscription, body)
+		if err == nil {
+			return nil
+		}
+
+		if _, ok := err.(*retryableError); !ok || attempt == n.maxAttempts {
+			return fmt.Errorf(errPrefix+"failed to deliver notification after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryDelay):
+		}
+		retryDelay *= 2
+	}
+}
+
+func (n *HTTPNotifier) send(ctx context.Context, subscription *Subscription, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.TargetUrl, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(subscription.Secret, timestamp, body))
+
+	res, err := n.httpClient.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrForbiddenTarget) {
+			return err
+		}
+		return &retryableError{err: fmt.Errorf("failed to do request: %w", err)}
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+
+	err = fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	if res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests {
+		return &retryableError{err: err}
+	}
+
+	return err
+}
+
+// Sign computes the hex encoded HMAC-SHA256 of timestamp and body joined with a dot, receivers should reject old timestamps to prevent replays
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, timestamp)
+	io.WriteString(mac, ".")
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (n *HTTPNotifier) createBody(format Format, notification *Notification) ([]byte, error) {
+	switch format {
+	case FormatDiscord:
+		return json.Marshal(struct {
+			Content string `json:"content"`
+		}{
+			Content: n.createText(notification),
+		})
+	case FormatSlack:
+		return json.Marshal(struct {
+			Text string `json:"text"`
+		}{
+			Text: n.createText(notification),
+		})
+	default:
+		return json.Marshal(notification)
+	}
+}
+
+func (n *HTTPNotifier) createText(notification *Notification) string {
+	textBuilder := strings.Builder{}
+	textBuilder.WriteString("Schedule changed:")
+	for i, header := range notification.Schedules {
+		if i != 0 {
+			textBuilder.WriteString(",")
+		}
+		textBuilder.WriteString(" ")
+		textBuilder.WriteString(header.Name)
+	}
+	textBuilder.WriteString("\n")
+
+	for _, item := range notification.Added {
+		textBuilder.WriteString("+ " + n.describeItem(item) + "\n")
+	}
+	for _, item := range notification.Removed {
+		textBuilder.WriteString("- " + n.describeItem(item) + "\n")
+	}
+	for _, entry := range notification.Modified {
+		changes := make([]string, 0, len(entry.Changes))
+		for _, change := range entry.Changes {
+			changes = append(changes, string(change))
+		}
+		textBuilder.WriteString(fmt.Sprintf("~ %s -> %s (%s)\n", n.describeItem(entry.Before), n.describeItem(entry.After), strings.Join(changes, ", ")))
+	}
+
+	text := textBuilder.String()
+	if len(text) > maxChatMessageLength {
+		text = strings.ToValidUTF8(text[:maxChatMessageLength], "") + "\n..."
+	}
+
+	return text
+}
+
+func (n *HTTPNotifier) describeItem(item *uekschedule.ScheduleItem) string {
+	descriptionBuilder := strings.Builder{}
+	descriptionBuilder.WriteString(fmt.Sprintf("%s-%s [%s] %s", item.Start.In(n.location).Format("2006-01-02 15:04"), item.End.In(n.location).Format("15:04"), item.Type, item.Subject))
+	if item.RoomName != "" {
+		descriptionBuilder.WriteString(" @ " + item.RoomName)
+	}
+	if item.Extra != "" {
+		descriptionBuilder.WriteString(" (" + item.Extra + ")")
+	}
+
+	return descriptionBuilder.String()
+}
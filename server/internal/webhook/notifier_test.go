@@ -0,0 +1,142 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/webhook"
+)
+
+func createTestNotification() *webhook.Notification {
+	start := time.Date(2025, time.October, 6, 8, 0, 0, 0, time.UTC)
+	return &webhook.Notification{
+		SubscriptionId: "test",
+		Schedules:      []uekschedule.ScheduleHeader{{Id: 1, Name: "Group A"}},
+		DetectedAt:     start,
+		ScheduleDiff: &uekschedule.ScheduleDiff{
+			Added: []*uekschedule.ScheduleItem{{
+				Start:   start,
+				End:     start.Add(90 * time.Minute),
+				Subject: "Algebra",
+				Type:    "wykład",
+			}},
+			Removed:  []*uekschedule.ScheduleItem{},
+			Modified: []*uekschedule.ScheduleItemDiffEntry{},
+		},
+	}
+}
+
+func TestHTTPNotifierSignsAndRetries(t *testing.T) {
+	const secret = "test-secret"
+	var requestCount atomic.Int32
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(webhook.SignatureHeader) != "sha256="+webhook.Sign(secret, r.Header.Get(webhook.TimestampHeader), body) {
+			t.Errorf("Invalid signature: %s", r.Header.Get(webhook.SignatureHeader))
+		}
+
+		if !json.Valid(body) {
+			t.Errorf("Body is not valid JSON: %s", body)
+		}
+
+		if requestCount.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer target.Close()
+
+	notifier := webhook.NewHTTPNotifier(target.Client(), 3, time.Millisecond, time.UTC)
+	if err := notifier.Notify(context.Background(), &webhook.Subscription{
+		Secret:    secret,
+		TargetUrl: target.URL,
+		Format:    webhook.FormatDiscord,
+	}, createTestNotification()); err != nil {
+		t.Errorf("Failed to notify: %s", err)
+		return
+	}
+
+	if requestCount.Load() != 2 {
+		t.Errorf("Unexpected request count, got: %d, want: %d", requestCount.Load(), 2)
+	}
+}
+
+func TestHTTPNotifierDoesNotRetryClientErrors(t *testing.T) {
+	var requestCount atomic.Int32
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer target.Close()
+
+	notifier := webhook.NewHTTPNotifier(target.Client(), 3, time.Millisecond, time.UTC)
+	if err := notifier.Notify(context.Background(), &webhook.Subscription{
+		TargetUrl: target.URL,
+		Format:    webhook.FormatJSON,
+	}, createTestNotification()); err == nil {
+		t.Errorf("Expected an error")
+	}
+
+	if requestCount.Load() != 1 {
+		t.Errorf("Unexpected request count, got: %d, want: %d", requestCount.Load(), 1)
+	}
+}
+
+func TestHTTPClientRejectsPrivateTargets(t *testing.T) {
+	var requestCount atomic.Int32
+
+	// httptest servers listen on loopback, which is what an attacker would target
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestCount.Add(1)
+	}))
+	defer target.Close()
+
+	notifier := webhook.NewHTTPNotifier(webhook.NewHTTPClient(time.Second, false), 3, time.Millisecond, time.UTC)
+	if err := notifier.Notify(context.Background(), &webhook.Subscription{
+		TargetUrl: target.URL,
+		Format:    webhook.FormatJSON,
+	}, createTestNotification()); !errors.Is(err, webhook.ErrForbiddenTarget) {
+		t.Errorf("Expected ErrForbiddenTarget, got: %v", err)
+		return
+	}
+
+	if requestCount.Load() != 0 {
+		t.Errorf("Private target should not have been requested, got: %d requests", requestCount.Load())
+	}
+}
+
+func TestHTTPClientDoesNotFollowRedirects(t *testing.T) {
+	var redirectedRequestCount atomic.Int32
+
+	redirectTarget := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirectedRequestCount.Add(1)
+	}))
+	defer redirectTarget.Close()
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, redirectTarget.URL, http.StatusTemporaryRedirect)
+	}))
+	defer target.Close()
+
+	notifier := webhook.NewHTTPNotifier(webhook.NewHTTPClient(time.Second, true), 1, time.Millisecond, time.UTC)
+	if err := notifier.Notify(context.Background(), &webhook.Subscription{
+		TargetUrl: target.URL,
+		Format:    webhook.FormatJSON,
+	}, createTestNotification()); err == nil {
+		t.Errorf("Redirect should not count as a successful delivery")
+		return
+	}
+
+	if redirectedRequestCount.Load() != 0 {
+		t.Errorf("Redirect should not have been followed, got: %d requests", redirectedRequestCount.Load())
+	}
+}
@@ -0,0 +1,359 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/snapshot"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+)
+
+const errPrefix = "webhook: "
+
+const storeKeyPrefix = "webhooks/"
+
+var ErrInvalidSubscription = errors.New(errPrefix + "invalid subscription")
+var ErrSubscriptionNotFound = errors.New(errPrefix + "subscription not found")
+var ErrTooManySubscriptions = errors.New(errPrefix + "too many subscriptions")
+
+type Subscription struct {
+	Id     string `json:"id"`
+	Secret string `json:"secret"`
+	// OwnerHash tells who can list and delete the subscription, see encryption.Service.HashOwner
+	OwnerHash string `json:"ownerHash"`
+	// EncryptedAuth is used to fetch schedules on behalf of the owner
+	EncryptedAuth  string                      `json:"encryptedAuth"`
+	TargetUrl      string                      `json:"targetUrl"`
+	Format         Format                      `json:"format"`
+	ScheduleKeys   []uekschedule.ScheduleKey   `json:"scheduleKeys"`
+	HiddenSubjects []string                    `json:"hiddenSubjects"`
+	Filter         uekschedule.ItemFilterRules `json:"filter"`
+	CreatedAt      time.Time                   `json:"createdAt"`
+	LastSnapshot   *snapshot.Snapshot          `json:"lastSnapshot,omitempty"`
+	// DisabledAt is set when polling cannot succeed until the owner changes the subscription, e.g. after UEK rejected the credentials
+	DisabledAt     *time.Time `json:"disabledAt,omitempty"`
+	DisabledReason string     `json:"disabledReason,omitempty"`
+}
+
+type CreateSubscriptionParams struct {
+	TargetUrl      string
+	Format         Format
+	ScheduleKeys   []uekschedule.ScheduleKey
+	HiddenSubjects []string
+	Filter         uekschedule.ItemFilterRules
+}
+
+// Service keeps a registry of webhook subscriptions and polls their schedules for changes
+type Service struct {
+	cfg         config.Webhook
+	uekSchedule *uekschedule.Client
+	encryption  *encryption.Service
+	store       *filestore.Store
+	notifier    Notifier
+	logger      *slog.Logger
+	// mu prevents the poller from bringing back subscriptions deleted while they were being polled
+	mu sync.Mutex
+}
+
+func NewService(cfg config.Webhook, uekScheduleClient *uekschedule.Client, encryptionService *encryption.Service, store *filestore.Store, notifier Notifier, logger *slog.Logger) (*Service, error) {
+	if cfg.PollInterval <= 0 {
+		return nil, fmt.Errorf(errPrefix + "poll interval should be greater than 0")
+	}
+
+	return &Service{
+		cfg:         cfg,
+		uekSchedule: uekScheduleClient,
+		encryption:  encryptionService,
+		store:       store,
+		notifier:    notifier,
+		logger:      logger,
+	}, nil
+}
+
+func (s *Service) CreateSubscription(basicAuthValue string, params CreateSubscriptionParams) (*Subscription, error) {
+	if err := s.validateTargetUrl(params.TargetUrl); err != nil {
+		return nil, err
+	}
+
+	if !params.Format.IsValid() || len(params.ScheduleKeys) == 0 {
+		return nil, ErrInvalidSubscription
+	}
+
+	if _, err := params.Filter.Compile(); err != nil {
+		return nil, errors.Join(ErrInvalidSubscription, err)
+	}
+
+	ownerHash, err := s.encryption.HashOwner(basicAuthValue)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidSubscription, err)
+	}
+
+	// the lock is held until the subscription is stored, so that concurrent calls cannot exceed the limit together
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existingSubscriptions, err := s.ListSubscriptions(basicAuthValue)
+	if err != nil {
+		return nil, err
+	}
+	if len(existingSubscriptions) >= s.cfg.MaxSubscriptionsPerUser {
+		return nil, ErrTooManySubscriptions
+	}
+
+	encryptedAuth, err := s.encryption.EncryptText(basicAuthValue)
+	if err != nil {
+		return nil, fmt.Errorf(errPrefix+"failed to encrypt auth: %w", err)
+	}
+
+	id, err := generateRandomHex(16)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := generateRandomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription := &Subscription{
+		Id:             id,
+		Secret:         secret,
+		OwnerHash:      ownerHash,
+		EncryptedAuth:  encryptedAuth,
+		TargetUrl:      params.TargetUrl,
+		Format:         params.Format,
+		ScheduleKeys:   params.ScheduleKeys,
+		HiddenSubjects: params.HiddenSubjects,
+		Filter:         params.Filter,
+		CreatedAt:      time.Now(),
+	}
+
+	if err := s.store.Put(storeKeyPrefix+subscription.Id, subscription); err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (s *Service) ListSubscriptions(basicAuthValue string) ([]*Subscription, error) {
+	subscriptions, err := s.getAllSubscriptions()
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(subscriptions, func(subscription *Subscription) bool {
+		return !s.encryption.IsOwner(subscription.OwnerHash, basicAuthValue)
+	}), nil
+}
+
+func (s *Service) DeleteSubscription(basicAuthValue string, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscription := &Subscription{}
+	ok, err := s.store.Get(storeKeyPrefix+id, subscription)
+	if err != nil {
+		return err
+	}
+
+	if !ok || !s.encryption.IsOwner(subscription.OwnerHash, basicAuthValue) {
+		return ErrSubscriptionNotFound
+	}
+
+	return s.store.Delete(storeKeyPrefix + id)
+}
+
+// Run polls subscriptions until ctx is canceled
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.PollSubscriptions(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PollSubscriptions notifies about changes of schedules of every subscription which is not disabled
+func (s *Service) PollSubscriptions(ctx context.Context) {
+	subscriptions, err := s.getAllSubscriptions()
+	if err != nil {
+		s.logger.Error("Failed to list webhook subscriptions", slog.Any("err", err))
+		return
+	}
+
+	// schedules are fetched one subscription at a time, the UEK client limits concurrency of requests within one anyway
+	for _, subscription := range subscriptions {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if subscription.DisabledAt != nil {
+			continue
+		}
+
+		err := s.pollSubscription(ctx, subscription)
+		switch {
+		case err == nil || errors.Is(err, context.Canceled):
+		case errors.Is(err, uekschedule.ErrUnauthorized):
+			// polling again with the same credentials could get the UEK account of the owner locked
+			s.logger.Warn("UEK rejected credentials of webhook subscription, disabling it", slog.String("subscriptionId", subscription.Id))
+			if err := s.disableSubscription(subscription.Id, "UEK rejected the credentials, create the subscription again with current ones"); err != nil {
+				s.logger.Error("Failed to disable webhook subscription", slog.String("subscriptionId", subscription.Id), slog.Any("err", err))
+			}
+		default:
+			s.logger.Error("Failed to poll webhook subscription", slog.String("subscriptionId", subscription.Id), slog.Any("err", err))
+		}
+	}
+}
+
+func (s *Service) pollSubscription(ctx context.Context, subscription *Subscription) error {
+	basicAuthValue, err := s.encryption.DecryptText(subscription.EncryptedAuth)
+	if err != nil {
+		return fmt.Errorf(errPrefix+"failed to decrypt auth: %w", err)
+	}
+
+	now := time.Now().In(s.uekSchedule.Location())
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	periodSelection := uekschedule.PeriodSelection{
+		From: today,
+		To:   today.AddDate(0, 0, s.cfg.DaysAhead+1),
+	}
+
+	itemFilter, err := subscription.Filter.CompileHidingSubjects(subscription.HiddenSubjects)
+	if err != nil {
+		return fmt.Errorf(errPrefix+"invalid filter: %w", err)
+	}
+
+	aggregateSchedule, _, err := s.uekSchedule.GetAggregateSchedule(ctx, uekschedule.UEKCallParams{
+		BasicAuthHeaderValue: basicAuthValue,
+	}, subscription.ScheduleKeys, periodSelection)
+	if err != nil {
+		return err
+	}
+
+	currentSnapshot := &snapshot.Snapshot{
+		TakenAt:   now,
+		CheckedAt: now,
+		From:      periodSelection.From,
+		To:        periodSelection.To,
+		Items:     aggregateSchedule.Filter(itemFilter).Items,
+	}
+
+	if subscription.LastSnapshot != nil {
+		diff := snapshot.DiffSnapshots(subscription.LastSnapshot, currentSnapshot)
+		if !diff.IsEmpty() {
+			// the snapshot is only replaced after successful delivery, so that failed notifications are retried on next poll
+			if err := s.notifier.Notify(ctx, subscription, &Notification{
+				SubscriptionId: subscription.Id,
+				Schedules:      aggregateSchedule.Headers,
+				DetectedAt:     now,
+				ScheduleDiff:   diff,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ok, err := s.store.Get(storeKeyPrefix+subscription.Id, &Subscription{}); err != nil || !ok {
+		return err
+	}
+
+	subscription.LastSnapshot = currentSnapshot
+	// stored credentials and owner hashes are moved to the active key as they are used, so that previous keys can eventually be dropped
+	if !s.encryption.IsEncryptedWithActiveKey(subscription.EncryptedAuth) {
+		if encryptedAuth, err := s.encryption.EncryptText(basicAuthValue); err == nil {
+			subscription.EncryptedAuth = encryptedAuth
+		}
+	}
+	if !s.encryption.IsOwnerHashedWithActiveKey(subscription.OwnerHash) {
+		if ownerHash, err := s.encryption.HashOwner(basicAuthValue); err == nil {
+			subscription.OwnerHash = ownerHash
+		}
+	}
+	return s.store.Put(storeKeyPrefix+subscription.Id, subscription)
+}
+
+func (s *Service) disableSubscription(id string, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscription := &Subscription{}
+	if ok, err := s.store.Get(storeKeyPrefix+id, subscription); err != nil || !ok {
+		return err
+	}
+
+	now := time.Now()
+	subscription.DisabledAt = &now
+	subscription.DisabledReason = reason
+	return s.store.Put(storeKeyPrefix+id, subscription)
+}
+
+func (s *Service) getAllSubscriptions() ([]*Subscription, error) {
+	keys, err := s.store.Keys(storeKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := make([]*Subscription, 0, len(keys))
+	for _, key := range keys {
+		subscription := &Subscription{}
+		if ok, err := s.store.Get(key, subscription); err != nil {
+			return nil, err
+		} else if ok {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+
+	return subscriptions, nil
+}
+
+func (s *Service) validateTargetUrl(rawTargetUrl string) error {
+	targetUrl, err := url.Parse(rawTargetUrl)
+	if err != nil || targetUrl.Host == "" {
+		return ErrInvalidSubscription
+	}
+
+	if targetUrl.Scheme != "https" && (targetUrl.Scheme != "http" || !s.cfg.AllowInsecureTargets) {
+		return ErrInvalidSubscription
+	}
+
+	// hostnames are checked when notifications are delivered, rejecting obvious cases early gives a clear error
+	if !s.cfg.AllowPrivateTargets {
+		if addr, err := netip.ParseAddr(targetUrl.Hostname()); (err == nil && !isPublicAddr(addr)) || strings.EqualFold(targetUrl.Hostname(), "localhost") {
+			return ErrInvalidSubscription
+		}
+	}
+
+	return nil
+}
+
+func generateRandomHex(byteCount int) (string, error) {
+	buff := make([]byte, byteCount)
+	if _, err := rand.Read(buff); err != nil {
+		return "", fmt.Errorf(errPrefix+"failed to generate random value: %w", err)
+	}
+
+	return hex.EncodeToString(buff), nil
+}
@@ -0,0 +1,176 @@
+package webhook_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/bufferutil"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/config"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/encryption"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/filestore"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/uekschedule"
+	"github.com/szczursonn/uek-planzajec-v4-server/internal/webhook"
+)
+
+type unauthorizedRoundTripper struct {
+	requestCount atomic.Int32
+}
+
+func (rt *unauthorizedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.requestCount.Add(1)
+	return &http.Response{
+		StatusCode: http.StatusUnauthorized,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+	}, nil
+}
+
+type noopNotifier struct{}
+
+func (noopNotifier) Notify(ctx context.Context, subscription *webhook.Subscription, notification *webhook.Notification) error {
+	return nil
+}
+
+const testBasicAuthValue = "dXNlcjpwYXNz"
+
+var testSubscriptionParams = webhook.CreateSubscriptionParams{
+	TargetUrl:    "https://example.com/webhook",
+	Format:       webhook.FormatJSON,
+	ScheduleKeys: []uekschedule.ScheduleKey{{Type: uekschedule.ScheduleTypeGroup, Id: 1}},
+}
+
+func createTestService(uekTransport http.RoundTripper, storeDir string) (*webhook.Service, error) {
+	uekClient, err := uekschedule.NewClient(&http.Client{Transport: uekTransport}, slog.New(slog.DiscardHandler), config.UEK{
+		MaxConcurrentRequests: 1,
+	}, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptionService, err := encryption.NewService(encryption.Key{Id: "1", Value: []byte("g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI="), OwnerHashValue: []byte("owner-g0ZH6qmSSVPSik/0N35xLl1ve1nWJHI=")}, nil, bufferutil.NewBufferPool(8*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := filestore.New(storeDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhook.NewService(config.Webhook{
+		PollInterval:            time.Hour,
+		MaxSubscriptionsPerUser: 1,
+	}, uekClient, encryptionService, store, noopNotifier{}, slog.New(slog.DiscardHandler))
+}
+
+func TestServiceDisablesSubscriptionWithRejectedCredentials(t *testing.T) {
+	rt := &unauthorizedRoundTripper{}
+	service, err := createTestService(rt, t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+
+	if _, err := service.CreateSubscription(testBasicAuthValue, testSubscriptionParams); err != nil {
+		t.Errorf("Failed to create subscription: %s", err)
+		return
+	}
+
+	service.PollSubscriptions(context.Background())
+	requestCount := rt.requestCount.Load()
+	if requestCount == 0 {
+		t.Errorf("Subscription was not polled")
+		return
+	}
+
+	service.PollSubscriptions(context.Background())
+	if rt.requestCount.Load() != requestCount {
+		t.Errorf("Rejected credentials should not be used again, got: %d requests, want: %d", rt.requestCount.Load(), requestCount)
+		return
+	}
+
+	subscriptions, err := service.ListSubscriptions(testBasicAuthValue)
+	if err != nil || len(subscriptions) != 1 || subscriptions[0].DisabledAt == nil || subscriptions[0].DisabledReason == "" {
+		t.Errorf("Subscription should have been disabled with a reason, got: %+v, err: %v", subscriptions, err)
+		return
+	}
+}
+
+func TestServiceLimitsConcurrentlyCreatedSubscriptions(t *testing.T) {
+	service, err := createTestService(&unauthorizedRoundTripper{}, t.TempDir())
+	if err != nil {
+		t.Errorf("Failed to create service: %s", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	var createdCount atomic.Int32
+	for range 8 {
+		wg.Go(func() {
+			if _, err := service.CreateSubscription(testBasicAuthValue, testSubscriptionParams); err == nil {
+				createdCount.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+
+	if createdCount.Load() != 1 {
+		t.Errorf("Unexpected created subscription count, got: %d, want: %d", createdCount.Load(), 1)
+		return
+	}
+}
+
+func TestServiceRejectsNonPublicTargets(t *testing.T) {
+	for _, tc := range []struct {
+		host     string
+		isPublic bool
+	}{
+		{host: "93.184.215.14", isPublic: true},
+		{host: "[2606:4700::6810:85e5]", isPublic: true},
+		{host: "[64:ff9b::808:808]", isPublic: true},
+		{host: "localhost", isPublic: false},
+		{host: "0.0.0.0", isPublic: false},
+		{host: "0.1.2.3", isPublic: false},
+		{host: "10.0.0.1", isPublic: false},
+		{host: "100.64.0.1", isPublic: false},
+		{host: "100.127.255.254", isPublic: false},
+		{host: "127.0.0.1", isPublic: false},
+		{host: "169.254.169.254", isPublic: false},
+		{host: "172.16.0.1", isPublic: false},
+		{host: "192.0.0.8", isPublic: false},
+		{host: "192.168.1.1", isPublic: false},
+		{host: "198.18.0.1", isPublic: false},
+		{host: "198.19.255.255", isPublic: false},
+		{host: "224.0.0.1", isPublic: false},
+		{host: "255.255.255.255", isPublic: false},
+		{host: "[::]", isPublic: false},
+		{host: "[::1]", isPublic: false},
+		{host: "[::ffff:10.0.0.1]", isPublic: false},
+		{host: "[64:ff9b::a00:1]", isPublic: false},
+		{host: "[64:ff9b::7f00:1]", isPublic: false},
+		{host: "[64:ff9b::6440:1]", isPublic: false},
+		{host: "[2002:a00:1::1]", isPublic: false},
+		{host: "[fd00::1]", isPublic: false},
+		{host: "[fdaa::2]", isPublic: false},
+		{host: "[fe80::1%25eth0]", isPublic: false},
+		{host: "[ff02::1]", isPublic: false},
+	} {
+		service, err := createTestService(&unauthorizedRoundTripper{}, t.TempDir())
+		if err != nil {
+			t.Errorf("Failed to create service: %s", err)
+			return
+		}
+
+		params := testSubscriptionParams
+		params.TargetUrl = "https://" + tc.host + "/webhook"
+		if _, err := service.CreateSubscription(testBasicAuthValue, params); (err == nil) != tc.isPublic {
+			t.Errorf("%s: unexpected result, got err: %v, want public: %t", tc.host, err, tc.isPublic)
+			return
+		}
+	}
+}
@@ -1,11 +1,15 @@
 import { useCallback, useEffect, useRef, useState } from 'preact/hooks';
 import * as z from 'zod/mini';
 import { UnexpectedStatusCodeError } from './common';
-import { encryptedBasicAuthGlobalState } from '../state/localStorage/encryptedBasicAuth';
+import {
+    encryptedBasicAuthGlobalState,
+    encryptedICalBasicAuthGlobalState,
+} from '../state/localStorage/encryptedBasicAuth';
 import { isAbortError } from '../errorUtils';
 
 const encryptBasicAuthResponseSchema = z.object({
     token: z.string().check(z.minLength(1)),
+    icalToken: z.string().check(z.minLength(1)),
 });
 
 export const useEncryptBasicAuth = () => {
@@ -34,8 +38,9 @@ export const useEncryptBasicAuth = () => {
                 throw new UnexpectedStatusCodeError(res.status);
             }
 
-            const token = encryptBasicAuthResponseSchema.parse(await res.json()).token;
+            const { token, icalToken } = encryptBasicAuthResponseSchema.parse(await res.json());
 
+            encryptedICalBasicAuthGlobalState.set(icalToken);
             encryptedBasicAuthGlobalState.set(token);
             setIsLoading(false);
         } catch (err) {
@@ -1,7 +1,7 @@
 import { useCurrentLocale } from '../../i18n/useCurrentLocale';
 import { UnexpectedStatusCodeError } from '../../api/common';
 import { formatError, isFetchError } from '../../errorUtils';
-import { encryptedBasicAuthGlobalState } from '../../state/localStorage/encryptedBasicAuth';
+import { logout } from '../../state/localStorage/encryptedBasicAuth';
 import { Icon } from './Icon';
 import { Button } from './Button';
 
@@ -24,7 +24,7 @@ export const ErrorAlert = ({ error, onRetry }: { error: unknown; onRetry?: () =>
                             class="max-w-48"
                             type="button"
                             text={currentLocale.getLabel('common.logoutCTA')}
-                            onClick={() => encryptedBasicAuthGlobalState.set('')}
+                            onClick={logout}
                         />
                         {retryButtonCmp}
                     </>
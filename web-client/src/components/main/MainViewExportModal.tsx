@@ -4,7 +4,10 @@ import { useCurrentLocale } from '../../i18n/useCurrentLocale';
 import { createICalURL } from '../../api/common';
 import { useGlobalScheduleQuery } from '../../api/globalScheduleQuery';
 import { updateQueryParams } from '../../state/queryParams/manager';
-import { encryptedBasicAuthGlobalState } from '../../state/localStorage/encryptedBasicAuth';
+import {
+    encryptedBasicAuthGlobalState,
+    encryptedICalBasicAuthGlobalState,
+} from '../../state/localStorage/encryptedBasicAuth';
 import { isExportModalOpenGlobalState } from '../../state/queryParams/exportModal';
 import { Button } from '../common/Button';
 import { Modal } from '../common/Modal';
@@ -17,6 +20,7 @@ const MainViewExportModal = () => {
     const query = useGlobalScheduleQuery();
     const [isCopySuccessIconVisible, setIsCopySuccessIconVisible] = useState(false);
     const encryptedBasicAuth = encryptedBasicAuthGlobalState.use();
+    const encryptedICalBasicAuth = encryptedICalBasicAuthGlobalState.use();
 
     useEffect(() => {
         if (!isCopySuccessIconVisible) {
@@ -47,7 +51,7 @@ const MainViewExportModal = () => {
               scheduleIds: query.params.scheduleIds,
               hiddenSubjects: query.params.hiddenSubjects,
               periodIdx: query.data.resolvedPeriodIdx,
-              encryptedBasicAuth,
+              encryptedBasicAuth: encryptedICalBasicAuth || encryptedBasicAuth,
           })
         : null;
 
@@ -1,7 +1,7 @@
 import clsx from 'clsx';
 import { useCurrentLocale } from '../../../i18n/useCurrentLocale';
 import { useGlobalScheduleQuery } from '../../../api/globalScheduleQuery';
-import { encryptedBasicAuthGlobalState } from '../../../state/localStorage/encryptedBasicAuth';
+import { logout } from '../../../state/localStorage/encryptedBasicAuth';
 import { MainViewHeaderSchedulePeriodSelector } from '../header/MainViewHeaderSchedulePeriodSelector';
 import { MainViewShareButton } from '../MainViewShareButton';
 import { Button } from '../../common/Button';
@@ -72,7 +72,7 @@ export const MainViewHeader = ({
                         class="text-x-err-300 focus-visible:outline-x-err-300 hover:underline"
                         type="button"
                         text={currentLocale.getLabel('common.logoutCTA')}
-                        onClick={() => encryptedBasicAuthGlobalState.set('')}
+                        onClick={logout}
                     />
                 </div>
             </div>
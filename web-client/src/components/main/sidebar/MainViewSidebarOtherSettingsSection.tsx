@@ -3,7 +3,7 @@ import { useCurrentLocale } from '../../../i18n/useCurrentLocale';
 import { highlightOnlineOnlyDaysGlobalState } from '../../../state/localStorage/highlightOnlineOnlyDays';
 import { showLongBreaksGlobalState } from '../../../state/localStorage/showLongBreaks';
 import { longBreakThresholdMinutesGlobalState } from '../../../state/localStorage/longBreakThreshold';
-import { encryptedBasicAuthGlobalState } from '../../../state/localStorage/encryptedBasicAuth';
+import { logout } from '../../../state/localStorage/encryptedBasicAuth';
 import { MainViewSidebarSection } from './MainViewSidebarSection';
 import { Button } from '../../common/Button';
 import { Checkbox } from '../../common/Checkbox';
@@ -54,7 +54,7 @@ export const MainViewSidebarOtherSettingsSection = () => {
                     class="text-x-err-300 hover:underline"
                     type="button"
                     text={currentLocale.getLabel('common.logoutCTA')}
-                    onClick={() => encryptedBasicAuthGlobalState.set('')}
+                    onClick={logout}
                 />
             </div>
         </MainViewSidebarSection>
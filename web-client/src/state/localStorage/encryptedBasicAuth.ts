@@ -1,3 +1,11 @@
 import { createStringLocalStorageState } from './manager';
 
 export const encryptedBasicAuthGlobalState = createStringLocalStorageState('encryptedBasicAuth');
+
+// iCal subscription URLs use a separate token, it is empty for tokens issued before tokens had audiences
+export const encryptedICalBasicAuthGlobalState = createStringLocalStorageState('encryptedICalBasicAuth');
+
+export const logout = () => {
+    encryptedBasicAuthGlobalState.set('');
+    encryptedICalBasicAuthGlobalState.set('');
+};